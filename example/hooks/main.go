@@ -33,7 +33,7 @@ func main() {
 	}
 
 	gocrud.Register(api, gocrud.NewSQLRepository[User](db), &gocrud.Config[User]{
-		BeforeGet: func(ctx context.Context, where *map[string]any, order *map[string]any, limit *int, skip *int) error {
+		BeforeGet: func(ctx context.Context, where *map[string]any, order *[]map[string]any, limit *int, skip *int) error {
 			if *limit > 50 {
 				*limit = 50
 			}
@@ -17,26 +17,48 @@ import (
 type Mode int
 
 const (
-	BulkSingle Mode = iota
+	Default Mode = iota
+	BulkSingle
 	Single
 	None
 )
 
+// or returns the mode, or the fallback mode when it is not set
+func (m Mode) or(fallback Mode) Mode {
+	if m == Default {
+		return fallback
+	}
+
+	return m
+}
+
+// Conflict defines the upsert of the posted resources by the db names of their fields
+type Conflict = repository.Conflict
+
 type Config[Model any] struct {
-	GetMode    Mode
-	PutMode    Mode
-	PostMode   Mode
-	DeleteMode Mode
+	GetMode       Mode
+	PutMode       Mode
+	PostMode      Mode
+	DeleteMode    Mode
+	PatchMode     Mode
+	AggregateMode Mode
+	FacetsMode    Mode
+	SeriesMode    Mode
+
+	// Upserts the posted resources, conflicting resources are updated instead of created
+	PostConflict *Conflict
 
-	BeforeGet    func(ctx context.Context, where *map[string]any, order *map[string]any, limit *int, skip *int) error
+	BeforeGet    func(ctx context.Context, where *map[string]any, order *[]map[string]any, limit *int, skip *int) error
 	BeforePut    func(ctx context.Context, models *[]Model) error
 	BeforePost   func(ctx context.Context, models *[]Model) error
 	BeforeDelete func(ctx context.Context, where *map[string]any) error
+	BeforePatch  func(ctx context.Context, where *map[string]any, patch *Model, fields *[]string) error
 
 	AfterGet    func(ctx context.Context, models *[]Model) error
 	AfterPut    func(ctx context.Context, models *[]Model) error
 	AfterPost   func(ctx context.Context, models *[]Model) error
 	AfterDelete func(ctx context.Context, models *[]Model) error
+	AfterPatch  func(ctx context.Context, models *[]Model) error
 }
 
 // Register sets up CRUD operations for the given API and repository based on the provided configuration.
@@ -47,27 +69,71 @@ func Register[Model any](api huma.API, repo repository.Repository[Model], config
 		BeforePut:    config.BeforePut,
 		BeforePost:   config.BeforePost,
 		BeforeDelete: config.BeforeDelete,
+		BeforePatch:  config.BeforePatch,
 		AfterGet:     config.AfterGet,
 		AfterPut:     config.AfterPut,
 		AfterPost:    config.AfterPost,
 		AfterDelete:  config.AfterDelete,
-	})
+		AfterPatch:   config.AfterPatch,
+	}, config.PostConflict, config.PutMode.or(BulkSingle) != None)
 
-	// Get path for operations
+	// Included records of the model are read with its get hooks
+	repository.SetGetHooks(config.BeforeGet, config.AfterGet)
+
+	// Get paths for operations, single resource paths end with the primary key segments
 	path := svc.GetPath()
+	key := svc.GetKeyPath()
+
+	// Register Aggregate operation, it's disabled by default
+	// Operations on static paths are registered first, so routers matching in order don't take them for single resource paths
+	if config.AggregateMode.or(None) <= BulkSingle {
+		slog.Debug("Registering Aggregate operation", slog.String("path", path+"/aggregate"))
+		huma.Register(api, huma.Operation{
+			OperationID: fmt.Sprintf("aggregate-%s", svc.GetName()),
+			Summary:     fmt.Sprintf("Aggregate %s", svc.GetName()),
+			Description: fmt.Sprintf("Computes count, sum, avg, min and max metrics of the %s resources. Supports filtering and grouping parameters.", svc.GetName()),
+			Path:        path + "/aggregate",
+			Method:      http.MethodGet,
+		}, svc.Aggregate)
+	}
+
+	// Register Facets operation, it's disabled by default
+	if config.FacetsMode.or(None) <= BulkSingle {
+		slog.Debug("Registering Facets operation", slog.String("path", path+"/facets"))
+		huma.Register(api, huma.Operation{
+			OperationID: fmt.Sprintf("facets-%s", svc.GetName()),
+			Summary:     fmt.Sprintf("Facets %s", svc.GetName()),
+			Description: fmt.Sprintf("Returns the distinct values of the %s fields with their counts, most frequent first. Supports filtering parameters.", svc.GetName()),
+			Path:        path + "/facets",
+			Method:      http.MethodGet,
+		}, svc.Facets)
+	}
+
+	// Register Series operation for the models having time fields, it's disabled by default
+	if config.SeriesMode.or(None) <= BulkSingle && len(svc.GetTimeFields()) > 0 {
+		slog.Debug("Registering Series operation", slog.String("path", path+"/series"))
+		huma.Register(api, huma.Operation{
+			OperationID: fmt.Sprintf("series-%s", svc.GetName()),
+			Summary:     fmt.Sprintf("Series %s", svc.GetName()),
+			Description: fmt.Sprintf("Returns the count or sum of the %s resources by time buckets, empty buckets are filled. Supports filtering parameters.", svc.GetName()),
+			Path:        path + "/series",
+			Method:      http.MethodGet,
+		}, svc.Series)
+	}
 
 	// Register Get operations
-	if config.GetMode <= Single {
-		slog.Debug("Registering GetSingle operation", slog.String("path", path+"/{id}"))
+	if config.GetMode.or(BulkSingle) <= Single {
+		slog.Debug("Registering GetSingle operation", slog.String("path", path+key))
 		huma.Register(api, huma.Operation{
 			OperationID: fmt.Sprintf("get-single-%s", svc.GetName()),
 			Summary:     fmt.Sprintf("Get single-%s", svc.GetName()),
 			Description: fmt.Sprintf("Retrieves a single %s by its unique identifier. Returns full resource representation.", svc.GetName()),
-			Path:        path + "/{id}",
+			Path:        path + key,
+			Parameters:  svc.GetKeyParams(),
 			Method:      http.MethodGet,
 		}, svc.GetSingle)
 	}
-	if config.GetMode <= BulkSingle {
+	if config.GetMode.or(BulkSingle) <= BulkSingle {
 		slog.Debug("Registering GetBulk operation", slog.String("path", path))
 		huma.Register(api, huma.Operation{
 			OperationID: fmt.Sprintf("get-bulk-%s", svc.GetName()),
@@ -79,17 +145,18 @@ func Register[Model any](api huma.API, repo repository.Repository[Model], config
 	}
 
 	// Register Put operations
-	if config.PutMode <= Single {
-		slog.Debug("Registering PutSingle operation", slog.String("path", path+"/{id}"))
+	if config.PutMode.or(BulkSingle) <= Single {
+		slog.Debug("Registering PutSingle operation", slog.String("path", path+key))
 		huma.Register(api, huma.Operation{
 			OperationID: fmt.Sprintf("put-single-%s", svc.GetName()),
 			Summary:     fmt.Sprintf("Put single-%s", svc.GetName()),
 			Description: fmt.Sprintf("Full update operation for a %s resource. Requires complete resource representation.", svc.GetName()),
-			Path:        path + "/{id}",
+			Path:        path + key,
+			Parameters:  svc.GetKeyParams(),
 			Method:      http.MethodPut,
 		}, svc.PutSingle)
 	}
-	if config.PutMode <= BulkSingle {
+	if config.PutMode.or(BulkSingle) <= BulkSingle {
 		slog.Debug("Registering PutBulk operation", slog.String("path", path))
 		huma.Register(api, huma.Operation{
 			OperationID: fmt.Sprintf("put-bulk-%s", svc.GetName()),
@@ -100,40 +167,100 @@ func Register[Model any](api huma.API, repo repository.Repository[Model], config
 		}, svc.PutBulk)
 	}
 
+	// Register Patch operations, they are disabled by default since PUT hooks don't run on them
+	if config.PatchMode.or(None) <= Single {
+		slog.Debug("Registering PatchSingle operation", slog.String("path", path+key))
+		huma.Register(api, huma.Operation{
+			OperationID: fmt.Sprintf("patch-single-%s", svc.GetName()),
+			Summary:     fmt.Sprintf("Patch single-%s", svc.GetName()),
+			Description: fmt.Sprintf("Partially updates a %s resource by its identifier with a JSON Merge Patch or JSON Patch, only the present fields are updated.", svc.GetName()),
+			Path:        path + key,
+			Parameters:  svc.GetKeyParams(),
+			Method:      http.MethodPatch,
+		}, svc.PatchSingle)
+	}
+	if config.PatchMode.or(None) <= BulkSingle {
+		slog.Debug("Registering PatchBulk operation", slog.String("path", path))
+		huma.Register(api, huma.Operation{
+			OperationID: fmt.Sprintf("patch-bulk-%s", svc.GetName()),
+			Summary:     fmt.Sprintf("Patch bulk-%s", svc.GetName()),
+			Description: fmt.Sprintf("Partially updates the filtered %s resources with the same JSON Merge Patch or JSON Patch.", svc.GetName()),
+			Path:        path,
+			Method:      http.MethodPatch,
+		}, svc.PatchBulk)
+	}
+
+	// Register Link operations of the many-to-many relations
+	if config.PutMode.or(BulkSingle) <= Single {
+		for _, name := range svc.GetLinks() {
+			slog.Debug("Registering Link operation", slog.String("path", path+"/{id}/"+name))
+			huma.Register(api, huma.Operation{
+				OperationID: fmt.Sprintf("link-%s-%s", svc.GetName(), name),
+				Summary:     fmt.Sprintf("Link %s-%s", svc.GetName(), name),
+				Description: fmt.Sprintf("Links the related %s to a %s resource. Already linked resources are skipped.", name, svc.GetName()),
+				Path:        path + "/{id}/" + name,
+				Method:      http.MethodPost,
+			}, svc.Link(name))
+
+			slog.Debug("Registering Unlink operation", slog.String("path", path+"/{id}/"+name+"/{related}"))
+			huma.Register(api, huma.Operation{
+				OperationID: fmt.Sprintf("unlink-%s-%s", svc.GetName(), name),
+				Summary:     fmt.Sprintf("Unlink %s-%s", svc.GetName(), name),
+				Description: fmt.Sprintf("Unlinks a related %s from a %s resource. The related resource itself is kept.", name, svc.GetName()),
+				Path:        path + "/{id}/" + name + "/{related}",
+				Method:      http.MethodDelete,
+			}, svc.Unlink(name))
+		}
+	}
+
 	// Register Post operations
-	if config.PostMode <= Single {
+	if config.PostMode.or(BulkSingle) <= Single {
 		slog.Debug("Registering PostSingle operation", slog.String("path", path+"/one"))
 		huma.Register(api, huma.Operation{
 			OperationID: fmt.Sprintf("post-single-%s", svc.GetName()),
 			Summary:     fmt.Sprintf("Post single-%s", svc.GetName()),
-			Description: fmt.Sprintf("Creates a new %s resource. Returns the created resource with generated identifier.", svc.GetName()),
+			Description: fmt.Sprintf("Creates a new %s resource. Returns the created resource with generated identifier. Upserts the resource when configured or preferred by resolution=merge-duplicates.", svc.GetName()),
 			Path:        path + "/one",
 			Method:      http.MethodPost,
 		}, svc.PostSingle)
 	}
-	if config.PostMode <= BulkSingle {
+	if config.PostMode.or(BulkSingle) <= BulkSingle {
 		slog.Debug("Registering PostBulk operation", slog.String("path", path))
 		huma.Register(api, huma.Operation{
 			OperationID: fmt.Sprintf("post-bulk-%s", svc.GetName()),
 			Summary:     fmt.Sprintf("Post bulk-%s", svc.GetName()),
-			Description: fmt.Sprintf("Batch creation operation for multiple %s resources. Returns created resources with generated identifiers.", svc.GetName()),
+			Description: fmt.Sprintf("Batch creation operation for multiple %s resources. Returns created resources with generated identifiers. Upserts the resources when configured or preferred by resolution=merge-duplicates.", svc.GetName()),
 			Path:        path,
 			Method:      http.MethodPost,
 		}, svc.PostBulk)
 	}
 
 	// Register Delete operations
-	if config.DeleteMode <= Single {
-		slog.Debug("Registering DeleteSingle operation", slog.String("path", path+"/{id}"))
+	if config.DeleteMode.or(BulkSingle) <= Single {
+		slog.Debug("Registering DeleteSingle operation", slog.String("path", path+key))
 		huma.Register(api, huma.Operation{
 			OperationID: fmt.Sprintf("delete-single-%s", svc.GetName()),
 			Summary:     fmt.Sprintf("Delete single-%s", svc.GetName()),
 			Description: fmt.Sprintf("Permanently removes a %s resource by its identifier. This operation cannot be undone.", svc.GetName()),
-			Path:        path + "/{id}",
+			Path:        path + key,
+			Parameters:  svc.GetKeyParams(),
 			Method:      http.MethodDelete,
 		}, svc.DeleteSingle)
+
+		// Register Restore operation for the soft deleted models
+		if svc.GetSoftDelete() {
+			slog.Debug("Registering Restore operation", slog.String("path", path+key+"/restore"))
+			huma.Register(api, huma.Operation{
+				OperationID: fmt.Sprintf("restore-%s", svc.GetName()),
+				Summary:     fmt.Sprintf("Restore %s", svc.GetName()),
+				Description: fmt.Sprintf("Restores a soft deleted %s resource by its identifier.", svc.GetName()),
+				Path:        path + key + "/restore",
+				Parameters:  svc.GetKeyParams(),
+				Method:      http.MethodPost,
+			}, svc.Restore)
+		}
 	}
-	if config.DeleteMode <= BulkSingle {
+	if config.DeleteMode.or(BulkSingle) <= BulkSingle {
 		slog.Debug("Registering DeleteBulk operation", slog.String("path", path))
 		huma.Register(api, huma.Operation{
 			OperationID: fmt.Sprintf("delete-bulk-%s", svc.GetName()),
@@ -145,6 +272,12 @@ func Register[Model any](api huma.API, repo repository.Repository[Model], config
 	}
 }
 
+// RegisterKeyGenerator adds a named key generator for the fields tagged with keygen, e.g. `keygen:"name"`.
+// The built-in generators are "uuidv7", "ulid" and "snowflake", custom generators must be registered before the repositories using them are created.
+func RegisterKeyGenerator(name string, generator func() any) {
+	repository.RegisterGenerator(name, generator)
+}
+
 // NewSQLRepository initializes a repository based on the SQL database driver.
 func NewSQLRepository[Model any](db *sql.DB) repository.Repository[Model] {
 	// Determine the database driver and initialize the appropriate repository
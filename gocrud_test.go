@@ -1,10 +1,19 @@
 package gocrud
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/danielgtaylor/huma/v2"
 	"github.com/danielgtaylor/huma/v2/humatest"
 	"github.com/stretchr/testify/assert"
 
@@ -14,10 +23,89 @@ import (
 var xdb *sql.DB
 
 type User struct {
-	_    struct{} `db:"users" json:"-"`
-	ID   *int     `db:"id" json:"id" required:"false"`
-	Name string   `db:"name" json:"name" required:"false" maxLength:"30" example:"David" doc:"User name"`
-	Age  int      `db:"age" json:"age" required:"false" minimum:"1" maximum:"120" example:"25" doc:"User age from 1 to 120"`
+	_         struct{}   `db:"users" json:"-"`
+	ID        *int       `db:"id" json:"id" required:"false"`
+	Name      string     `db:"name" json:"name" search:"true" required:"false" maxLength:"30" example:"David" doc:"User name"`
+	Age       int        `db:"age" json:"age" required:"false" minimum:"1" maximum:"120" example:"25" doc:"User age from 1 to 120"`
+	Documents []Document `db:"documents" src:"id" dest:"userId" table:"documents" json:"documents,omitempty" required:"false"`
+	Groups    []Group    `db:"groups" src:"id" dest:"id" table:"groups" through:"user_groups" through_src:"userId" through_dest:"groupId" json:"groups,omitempty" required:"false"`
+}
+
+type Group struct {
+	_    struct{}       `db:"groups" json:"-"`
+	ID   *int           `db:"id" json:"id" required:"false"`
+	Name string         `db:"name" json:"name" required:"false"`
+	Meta map[string]any `db:"meta,json" json:"meta,omitempty" required:"false"`
+	Tags []string       `db:"tags" json:"tags,omitempty" required:"false"`
+}
+
+type Level string
+
+func (Level) Values() []Level {
+	return []Level{"info", "warn", "error"}
+}
+
+type Event struct {
+	_     struct{}       `db:"events" json:"-"`
+	ID    *int           `db:"id" json:"id" required:"false"`
+	Name  sql.NullString `db:"name" json:"name" required:"false"`
+	Level Level          `db:"level" json:"level" required:"false"`
+	At    time.Time      `db:"at" json:"at" required:"false"`
+}
+
+type OrderLine struct {
+	_        struct{} `db:"order_lines" json:"-"`
+	OrderID  int      `db:"orderId" json:"orderId" key:"true"`
+	LineNo   int      `db:"lineNo" json:"lineNo" key:"true"`
+	Product  string   `db:"product" json:"product" required:"false"`
+	Quantity int      `db:"quantity" json:"quantity" required:"false"`
+}
+
+type Note struct {
+	_    struct{} `db:"notes" json:"-"`
+	ID   string   `db:"id" json:"id" keygen:"ulid" required:"false"`
+	Text string   `db:"text" json:"text" required:"false"`
+}
+
+type Task struct {
+	_         struct{}   `db:"tasks" json:"-" softdelete:"deletedAt"`
+	ID        *int       `db:"id" json:"id" required:"false"`
+	Title     string     `db:"title" json:"title" required:"false"`
+	DeletedAt *time.Time `db:"deletedAt" json:"deletedAt,omitempty" required:"false"`
+}
+
+type Page struct {
+	_       struct{} `db:"pages" json:"-"`
+	ID      *int     `db:"id" json:"id" required:"false"`
+	Title   string   `db:"title" json:"title" required:"false"`
+	Slug    *string  `db:"slug" json:"slug" required:"false"`
+	Version int      `db:"version" json:"version" version:"true" required:"false"`
+}
+
+type Product struct {
+	_       struct{} `db:"products" json:"-"`
+	ID      *int     `db:"id" json:"id" required:"false"`
+	SKU     string   `db:"sku" json:"sku"`
+	Name    string   `db:"name" json:"name" required:"false"`
+	Stock   int      `db:"stock" json:"stock" required:"false"`
+	Version int      `db:"version" json:"version" version:"true" required:"false"`
+}
+
+type Category struct {
+	_        struct{}   `db:"categories" json:"-"`
+	ID       *int       `db:"id" json:"id" required:"false"`
+	Name     string     `db:"name" json:"name" required:"false"`
+	ParentID *int       `db:"parentId" json:"parentId" required:"false"`
+	Parent   *Category  `db:"parent" src:"parentId" dest:"id" table:"categories" json:"parent,omitempty" required:"false"`
+	Children []Category `db:"children" src:"id" dest:"parentId" table:"categories" json:"children,omitempty" required:"false"`
+}
+
+type Document struct {
+	_      struct{} `db:"documents" json:"-"`
+	ID     *int     `db:"id" json:"id" required:"false"`
+	Title  string   `db:"title" json:"title" required:"false"`
+	UserID int      `db:"userId" json:"userId" required:"false"`
+	User   *User    `db:"user" src:"userId" dest:"id" table:"users" json:"user,omitempty" required:"false"`
 }
 
 func TestRegister(t *testing.T) {
@@ -35,10 +123,106 @@ func TestRegister(t *testing.T) {
 		panic(err)
 	}
 
+	// Create the documents table
+	_, err = db.Exec("CREATE TABLE documents (id INTEGER PRIMARY KEY AUTOINCREMENT, title TEXT, userId INTEGER)")
+	if err != nil {
+		panic(err)
+	}
+
+	// Create the groups and user_groups tables
+	_, err = db.Exec("CREATE TABLE groups (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, meta TEXT, tags TEXT)")
+	if err != nil {
+		panic(err)
+	}
+	_, err = db.Exec("CREATE TABLE user_groups (userId INTEGER, groupId INTEGER, PRIMARY KEY (userId, groupId))")
+	if err != nil {
+		panic(err)
+	}
+
+	// Create the events table
+	_, err = db.Exec("CREATE TABLE events (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, level TEXT, at DATETIME)")
+	if err != nil {
+		panic(err)
+	}
+
+	// Create the order_lines table
+	_, err = db.Exec("CREATE TABLE order_lines (orderId INTEGER, lineNo INTEGER, product TEXT, quantity INTEGER, PRIMARY KEY (orderId, lineNo))")
+	if err != nil {
+		panic(err)
+	}
+
+	// Create the notes table
+	_, err = db.Exec("CREATE TABLE notes (id TEXT PRIMARY KEY, text TEXT)")
+	if err != nil {
+		panic(err)
+	}
+
+	// Create the tasks table
+	_, err = db.Exec("CREATE TABLE tasks (id INTEGER PRIMARY KEY AUTOINCREMENT, title TEXT, deletedAt DATETIME)")
+	if err != nil {
+		panic(err)
+	}
+
+	// Create the pages table
+	_, err = db.Exec("CREATE TABLE pages (id INTEGER PRIMARY KEY AUTOINCREMENT, title TEXT, slug TEXT, version INTEGER)")
+	if err != nil {
+		panic(err)
+	}
+
+	// Create the products table
+	_, err = db.Exec("CREATE TABLE products (id INTEGER PRIMARY KEY AUTOINCREMENT, sku TEXT UNIQUE, name TEXT, stock INTEGER, version INTEGER)")
+	if err != nil {
+		panic(err)
+	}
+
+	// Create the categories table
+	_, err = db.Exec("CREATE TABLE categories (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, parentId INTEGER)")
+	if err != nil {
+		panic(err)
+	}
+
 	// Create a new Huma API
 	_, api := humatest.New(t)
 	repo := NewSQLRepository[User](xdb)
 	Register(api, repo, &Config[User]{})
+	Register(api, NewSQLRepository[Document](xdb), &Config[Document]{})
+	Register(api, NewSQLRepository[Group](xdb), &Config[Group]{})
+	Register(api, NewSQLRepository[Event](xdb), &Config[Event]{SeriesMode: BulkSingle})
+	Register(api, NewSQLRepository[OrderLine](xdb), &Config[OrderLine]{AggregateMode: BulkSingle, FacetsMode: BulkSingle})
+	Register(api, NewSQLRepository[Note](xdb), &Config[Note]{
+		PutMode: None,
+		BeforeGet: func(ctx context.Context, where *map[string]any, order *[]map[string]any, limit *int, skip *int) error {
+			(*where)["text"] = map[string]any{"_neq": "hidden"}
+			return nil
+		},
+	})
+	Register(api, NewSQLRepository[Task](xdb), &Config[Task]{})
+	patched := []string{}
+	Register(api, NewSQLRepository[Page](xdb), &Config[Page]{
+		PatchMode: BulkSingle,
+		BeforePatch: func(ctx context.Context, where *map[string]any, patch *Page, fields *[]string) error {
+			patched = *fields
+			*where = map[string]any{"_and": []any{*where, map[string]any{"title": map[string]any{"_neq": "Hidden"}}}}
+			return nil
+		},
+	})
+	Register(api, NewSQLRepository[Category](xdb), &Config[Category]{
+		BeforeGet: func(ctx context.Context, where *map[string]any, order *[]map[string]any, limit *int, skip *int) error {
+			*where = map[string]any{"_and": []any{*where, map[string]any{"name": map[string]any{"_neq": "Secret"}}}}
+			return nil
+		},
+	})
+	Register(api, NewSQLRepository[Product](xdb), &Config[Product]{
+		PostConflict: &Conflict{Fields: []string{"sku"}, Updates: []string{"stock"}},
+		BeforePut: func(ctx context.Context, models *[]Product) error {
+			for _, model := range *models {
+				if model.Stock > 100 {
+					return huma.Error422UnprocessableEntity("stock is too large")
+				}
+			}
+			return nil
+		},
+	})
 
 	t.Run("POST single", func(t *testing.T) {
 		// Create a new user
@@ -71,4 +255,941 @@ func TestRegister(t *testing.T) {
 			assert.Equal(t, result[i].Age, users[i].Age)
 		}
 	})
+
+	t.Run("GET bulk count", func(t *testing.T) {
+		resp := api.Get("/user?limit=2&skip=2&count=true")
+		assert.Equal(t, resp.Code, 200)
+		assert.Equal(t, "4", resp.Header().Get("X-Total-Count"))
+		assert.Contains(t, resp.Header().Get("Link"), `rel="first"`)
+		assert.Contains(t, resp.Header().Get("Link"), `rel="prev"`)
+		assert.NotContains(t, resp.Header().Get("Link"), `rel="next"`)
+
+		var result []User
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &result))
+		assert.Len(t, result, 2)
+	})
+
+	t.Run("GET bulk cursor", func(t *testing.T) {
+		resp := api.Get("/user?limit=2")
+		assert.Equal(t, resp.Code, 200)
+		assert.NotEmpty(t, resp.Header().Get("X-Next-Cursor"))
+		assert.Empty(t, resp.Header().Get("X-Prev-Cursor"))
+
+		var first []User
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &first))
+		assert.Len(t, first, 2)
+
+		resp = api.Get("/user?limit=2&after=" + resp.Header().Get("X-Next-Cursor"))
+		assert.Equal(t, resp.Code, 200)
+		assert.Empty(t, resp.Header().Get("X-Next-Cursor"))
+		assert.NotEmpty(t, resp.Header().Get("X-Prev-Cursor"))
+
+		var second []User
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &second))
+		assert.Len(t, second, 2)
+		assert.Less(t, *first[1].ID, *second[0].ID)
+
+		resp = api.Get("/user?limit=2&before=" + resp.Header().Get("X-Prev-Cursor"))
+		assert.Equal(t, resp.Code, 200)
+
+		var result []User
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &result))
+		assert.Equal(t, first, result)
+
+		resp = api.Get("/user?limit=2&after=invalid")
+		assert.Equal(t, resp.Code, 422)
+	})
+
+	t.Run("GET bulk order", func(t *testing.T) {
+		names := func(path string) []string {
+			resp := api.Get(path)
+			assert.Equal(t, resp.Code, 200)
+
+			var result []User
+			assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &result))
+
+			names := []string{}
+			for _, user := range result {
+				names = append(names, user.Name)
+			}
+			return names
+		}
+
+		assert.Equal(t, []string{"Charlie", "Bob", "Alice", "David"}, names("/user?order=-age,name"))
+		assert.Equal(t, []string{"David", "Alice", "Bob", "Charlie"}, names("/user?order="+url.QueryEscape(`[{"age":"ASC"},{"name":"DESC"}]`)))
+		assert.Equal(t, []string{"Alice", "David", "Bob", "Charlie"}, names("/user?order="+url.QueryEscape(`{"age":"ASC","name":"ASC"}`)))
+
+		resp := api.Get("/user?order=-unknown")
+		assert.Equal(t, resp.Code, 422)
+	})
+
+	t.Run("GET bulk order by relation", func(t *testing.T) {
+		documents := []Document{
+			{Title: "Doc1", UserID: 3},
+			{Title: "Doc2", UserID: 1},
+			{Title: "Doc3", UserID: 2},
+		}
+		resp := api.Post("/document", &documents)
+		assert.Equal(t, resp.Code, 200)
+
+		resp = api.Get("/document?order=" + url.QueryEscape(`[{"user.name":"ASC_NULLS_LAST"}]`))
+		assert.Equal(t, resp.Code, 200)
+
+		var result []Document
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &result))
+		assert.Len(t, result, 3)
+		assert.Equal(t, []int{2, 3, 1}, []int{result[0].UserID, result[1].UserID, result[2].UserID})
+	})
+
+	t.Run("GET fields", func(t *testing.T) {
+		resp := api.Get("/user?fields=name")
+		assert.Equal(t, resp.Code, 200)
+
+		var result []map[string]any
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &result))
+		assert.NotEmpty(t, result)
+		for _, user := range result {
+			assert.ElementsMatch(t, []string{"id", "name"}, slices.Collect(maps.Keys(user)))
+		}
+
+		resp = api.Get("/user/1?fields=age")
+		assert.Equal(t, resp.Code, 200)
+
+		var single map[string]any
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &single))
+		assert.ElementsMatch(t, []string{"id", "age"}, slices.Collect(maps.Keys(single)))
+
+		resp = api.Get("/user?fields=unknown")
+		assert.Equal(t, resp.Code, 422)
+	})
+
+	t.Run("GET include", func(t *testing.T) {
+		resp := api.Get("/user?include=documents&order=id")
+		assert.Equal(t, resp.Code, 200)
+
+		var users []User
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &users))
+		assert.Len(t, users, 4)
+		assert.Equal(t, "Doc2", users[0].Documents[0].Title)
+		assert.Equal(t, "Doc3", users[1].Documents[0].Title)
+		assert.Equal(t, "Doc1", users[2].Documents[0].Title)
+		assert.Empty(t, users[3].Documents)
+
+		resp = api.Get("/document/1?include=user.documents&fields=title")
+		assert.Equal(t, resp.Code, 200)
+
+		var document map[string]any
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &document))
+		assert.ElementsMatch(t, []string{"id", "title", "user"}, slices.Collect(maps.Keys(document)))
+		assert.Equal(t, "Bob", document["user"].(map[string]any)["name"])
+		assert.Len(t, document["user"].(map[string]any)["documents"], 1)
+
+		resp = api.Get("/user?include=unknown")
+		assert.Equal(t, resp.Code, 422)
+	})
+
+	t.Run("POST and PUT nested", func(t *testing.T) {
+		// Create a user with its documents
+		user := User{Name: "Eve", Age: 30, Documents: []Document{{Title: "Doc4"}, {Title: "Doc5"}}}
+		resp := api.Post("/user/one", &user)
+		assert.Equal(t, resp.Code, 200)
+
+		var created User
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &created))
+		assert.NotEmpty(t, created.ID)
+		assert.Len(t, created.Documents, 2)
+		for _, document := range created.Documents {
+			assert.NotEmpty(t, document.ID)
+			assert.Equal(t, *created.ID, document.UserID)
+		}
+
+		// Create a document with its user
+		document := Document{Title: "Doc6", User: &User{Name: "Frank", Age: 50}}
+		resp = api.Post("/document/one", &document)
+		assert.Equal(t, resp.Code, 200)
+
+		var owned Document
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &owned))
+		assert.NotEmpty(t, owned.User.ID)
+		assert.Equal(t, *owned.User.ID, owned.UserID)
+
+		// Update the user, updating the existing document and adding a new one
+		created.Name = "Eva"
+		created.Documents = []Document{{ID: created.Documents[0].ID, Title: "Doc4v2"}, {Title: "Doc7"}}
+		resp = api.Put("/user/"+fmt.Sprint(*created.ID), &created)
+		assert.Equal(t, resp.Code, 200)
+
+		resp = api.Get("/user/" + fmt.Sprint(*created.ID) + "?include=documents")
+		assert.Equal(t, resp.Code, 200)
+
+		var updated User
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &updated))
+		assert.Equal(t, "Eva", updated.Name)
+		assert.ElementsMatch(t, []string{"Doc4v2", "Doc5", "Doc7"}, []string{updated.Documents[0].Title, updated.Documents[1].Title, updated.Documents[2].Title})
+
+		// Failed nested writes are rolled back
+		missing := 9999
+		resp = api.Put("/user/"+fmt.Sprint(*created.ID), &User{ID: created.ID, Name: "Eve", Age: 30, Documents: []Document{{ID: &missing, Title: "Missing"}}})
+		assert.Equal(t, resp.Code, 422)
+
+		resp = api.Get("/user/" + fmt.Sprint(*created.ID))
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &updated))
+		assert.Equal(t, "Eva", updated.Name)
+
+		// Related entities of other entities are not updated by the nested writes
+		resp = api.Put("/user/"+fmt.Sprint(*created.ID), &User{ID: created.ID, Name: "Eva", Age: 30, Documents: []Document{{ID: owned.ID, Title: "Stolen"}}})
+		assert.Equal(t, resp.Code, 422)
+		resp = api.Put("/document/"+fmt.Sprint(*owned.ID), &Document{ID: owned.ID, Title: "Doc6", User: &User{ID: created.ID, Name: "Stolen", Age: 30}})
+		assert.Equal(t, resp.Code, 422)
+
+		var unchanged Document
+		resp = api.Get("/document/" + fmt.Sprint(*owned.ID) + "?include=user")
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &unchanged))
+		assert.Equal(t, "Doc6", unchanged.Title)
+		assert.Equal(t, owned.UserID, unchanged.UserID)
+		assert.Equal(t, "Frank", unchanged.User.Name)
+
+		resp = api.Get("/user/" + fmt.Sprint(*created.ID))
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &updated))
+		assert.Equal(t, "Eva", updated.Name)
+
+		// The key of the path is set on the body without a key
+		resp = api.Put("/user/"+fmt.Sprint(*created.ID), &User{Name: "Eva", Age: 30})
+		assert.Equal(t, resp.Code, 200)
+	})
+
+	t.Run("Link and unlink", func(t *testing.T) {
+		groups := []Group{{Name: "Admins"}, {Name: "Editors"}}
+		resp := api.Post("/group", &groups)
+		assert.Equal(t, resp.Code, 200)
+
+		// Link the groups twice, already linked groups are skipped
+		resp = api.Post("/user/1/groups", []string{"1", "2"})
+		assert.Equal(t, resp.Code, 204)
+		resp = api.Post("/user/1/groups", []string{"1"})
+		assert.Equal(t, resp.Code, 204)
+		resp = api.Post("/user/2/groups", []string{"2"})
+		assert.Equal(t, resp.Code, 204)
+
+		// Missing entities are not linked
+		resp = api.Post("/user/9999/groups", []string{"1"})
+		assert.Equal(t, resp.Code, 404)
+		resp = api.Delete("/user/9999/groups/1")
+		assert.Equal(t, resp.Code, 404)
+
+		resp = api.Get("/user/1?include=groups")
+		assert.Equal(t, resp.Code, 200)
+
+		var user User
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &user))
+		assert.Len(t, user.Groups, 2)
+
+		resp = api.Get("/user?where=" + url.QueryEscape(`{"groups":{"name":{"_eq":"Admins"}}}`))
+		assert.Equal(t, resp.Code, 200)
+
+		var users []User
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &users))
+		assert.Len(t, users, 1)
+		assert.Equal(t, 1, *users[0].ID)
+
+		// Unlink a group, unlinking it again is not found
+		resp = api.Delete("/user/1/groups/1")
+		assert.Equal(t, resp.Code, 204)
+		resp = api.Delete("/user/1/groups/1")
+		assert.Equal(t, resp.Code, 404)
+
+		resp = api.Get("/user/1?include=groups")
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &user))
+		assert.Len(t, user.Groups, 1)
+		assert.Equal(t, "Editors", user.Groups[0].Name)
+
+		// Create a user with new groups through the nested writes
+		resp = api.Post("/user/one", &User{Name: "Grace", Age: 28, Groups: []Group{{Name: "Viewers"}}})
+		assert.Equal(t, resp.Code, 200)
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &user))
+
+		resp = api.Get("/user?include=groups&where=" + url.QueryEscape(`{"groups":{"name":{"_eq":"Viewers"}}}`))
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &users))
+		assert.Len(t, users, 1)
+		assert.Equal(t, *user.ID, *users[0].ID)
+		assert.Equal(t, "Viewers", users[0].Groups[0].Name)
+	})
+
+	t.Run("GET bulk relation quantifiers", func(t *testing.T) {
+		ids := func(where string) []int {
+			resp := api.Get("/user?order=id&where=" + url.QueryEscape(where))
+			assert.Equal(t, resp.Code, 200)
+
+			var result []User
+			assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &result))
+
+			ids := []int{}
+			for _, user := range result {
+				ids = append(ids, *user.ID)
+			}
+			return ids
+		}
+
+		assert.Equal(t, []int{5}, ids(`{"documents":{"_some":{"title":{"_eq":"Doc5"}}}}`))
+		assert.Equal(t, []int{1, 2, 3, 4, 6, 7}, ids(`{"documents":{"_every":{"title":{"_like":"Doc_"}}}}`))
+		assert.Equal(t, []int{4, 7}, ids(`{"documents":{"_none":{}}}`))
+		assert.Equal(t, []int{5}, ids(`{"documents":{"_count":{"_gt":1}}}`))
+		assert.Equal(t, []int{3, 5, 6}, ids(`{"age":{"_gt":26},"documents":{"_count":{"_gte":1}}}`))
+		assert.Equal(t, []int{3, 4, 5, 6}, ids(`{"groups":{"_count":{"_eq":0}}}`))
+
+		resp := api.Get("/user?where=" + url.QueryEscape(`{"documents":{"_count":{"_gt":"many"}}}`))
+		assert.Equal(t, resp.Code, 422)
+	})
+
+	t.Run("GET bulk typed where", func(t *testing.T) {
+		resp := api.Get("/user?where=" + url.QueryEscape(`{"age":{"_gte":45,"_in":[45,50]},"name":{"_contains":"ar"}}`))
+		assert.Equal(t, resp.Code, 200)
+
+		var result []User
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &result))
+		assert.Len(t, result, 1)
+		assert.Equal(t, "Charlie", result[0].Name)
+
+		resp = api.Get("/user?where=" + url.QueryEscape(`{"age":{"_gt":"old"}}`))
+		assert.Equal(t, resp.Code, 422)
+		assert.Contains(t, resp.Body.String(), "age._gt")
+	})
+
+	t.Run("GET bulk search", func(t *testing.T) {
+		resp := api.Get("/user?q=li&count=true")
+		assert.Equal(t, resp.Code, 200)
+		assert.Equal(t, "2", resp.Header().Get("X-Total-Count"))
+
+		var result []User
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &result))
+		assert.Len(t, result, 2)
+		assert.Equal(t, "Alice", result[0].Name)
+		assert.Equal(t, "Charlie", result[1].Name)
+
+		resp = api.Get("/user?q=li&where=" + url.QueryEscape(`{"age":{"_gt":30}}`))
+		assert.Equal(t, resp.Code, 200)
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &result))
+		assert.Len(t, result, 1)
+		assert.Equal(t, "Charlie", result[0].Name)
+
+		resp = api.Get("/user?q=r&rank=true&order=-age&limit=1&count=true")
+		assert.Equal(t, resp.Code, 200)
+		assert.Contains(t, resp.Header().Get("Link"), "rank=true")
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &result))
+		assert.Len(t, result, 1)
+		assert.Equal(t, "Frank", result[0].Name)
+
+		resp = api.Get("/user?q=ar&rank=true&after=abc")
+		assert.Equal(t, resp.Code, 422)
+
+		// Words and punctuation are plain text, not query syntax
+		resp = api.Get("/user?rank=true&q=" + url.QueryEscape(`hello e-mail a"b foo:bar`))
+		assert.Equal(t, resp.Code, 200)
+		assert.Equal(t, "[]", strings.TrimSpace(resp.Body.String()))
+
+		resp = api.Get("/group?q=admins")
+		assert.Equal(t, resp.Code, 422)
+	})
+
+	t.Run("GET bulk json path", func(t *testing.T) {
+		groups := []Group{
+			{Name: "Owners", Meta: map[string]any{"plan": map[string]any{"tier": "pro", "seats": 5}, "active": true}},
+			{Name: "Guests", Meta: map[string]any{"plan": map[string]any{"tier": "free", "seats": 1}, "active": false}},
+		}
+		resp := api.Post("/group", &groups)
+		assert.Equal(t, resp.Code, 200)
+
+		resp = api.Get("/group?where=" + url.QueryEscape(`{"meta":{"_path":{"plan.tier":{"_eq":"pro"}}}}`))
+		assert.Equal(t, resp.Code, 200)
+
+		var result []Group
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &result))
+		assert.Len(t, result, 1)
+		assert.Equal(t, "Owners", result[0].Name)
+		assert.Equal(t, map[string]any{"tier": "pro", "seats": float64(5)}, result[0].Meta["plan"])
+
+		resp = api.Get("/group?where=" + url.QueryEscape(`{"meta":{"_path":{"plan.seats":{"_lt":3},"active":{"_eq":false}}}}`))
+		assert.Equal(t, resp.Code, 200)
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &result))
+		assert.Len(t, result, 1)
+		assert.Equal(t, "Guests", result[0].Name)
+
+		resp = api.Get("/group?where=" + url.QueryEscape(`{"meta":{"_is_null":true}}`))
+		assert.Equal(t, resp.Code, 200)
+
+		var empty []Group
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &empty))
+		assert.NotEmpty(t, empty)
+		assert.Nil(t, empty[0].Meta)
+
+		resp = api.Get("/group?where=" + url.QueryEscape(`{"meta":{"_eq":"pro"}}`))
+		assert.Equal(t, resp.Code, 422)
+	})
+
+	t.Run("GET bulk array", func(t *testing.T) {
+		groups := []Group{{Name: "Staff", Tags: []string{"a", "b"}}, {Name: "Interns", Tags: []string{"b"}}}
+		resp := api.Post("/group", &groups)
+		assert.Equal(t, resp.Code, 200)
+
+		find := func(where string) []Group {
+			resp := api.Get("/group?where=" + url.QueryEscape(where))
+			assert.Equal(t, resp.Code, 200)
+
+			var result []Group
+			assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &result))
+			return result
+		}
+
+		result := find(`{"tags":{"_contains":["a"]}}`)
+		assert.Len(t, result, 1)
+		assert.Equal(t, "Staff", result[0].Name)
+		assert.Equal(t, []string{"a", "b"}, result[0].Tags)
+
+		result = find(`{"tags":{"_contained_by":["b","c"]}}`)
+		assert.Len(t, result, 1)
+		assert.Equal(t, "Interns", result[0].Name)
+
+		result = find(`{"tags":{"_overlaps":["b","c"]}}`)
+		assert.Len(t, result, 2)
+
+		resp = api.Get("/group?where=" + url.QueryEscape(`{"tags":{"_eq":"a"}}`))
+		assert.Equal(t, resp.Code, 422)
+	})
+
+	t.Run("GET bulk scalar types", func(t *testing.T) {
+		events := []Event{
+			{Name: sql.NullString{String: "a", Valid: true}, Level: "info", At: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+			{Level: "warn", At: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+			{Name: sql.NullString{String: "c", Valid: true}, Level: "error", At: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		}
+		resp := api.Post("/event", &events)
+		assert.Equal(t, resp.Code, 200)
+
+		find := func(query string) []Event {
+			resp := api.Get("/event?" + query)
+			assert.Equal(t, resp.Code, 200)
+
+			var result []Event
+			assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &result))
+			return result
+		}
+
+		result := find("order=-at&where=" + url.QueryEscape(`{"at":{"_gte":"2024-02-01T00:00:00Z"}}`))
+		assert.Len(t, result, 2)
+		assert.Equal(t, Level("error"), result[0].Level)
+		assert.True(t, result[0].At.Equal(events[2].At))
+
+		result = find("where=" + url.QueryEscape(`{"name":{"_is_null":true}}`))
+		assert.Len(t, result, 1)
+		assert.False(t, result[0].Name.Valid)
+
+		result = find("where=" + url.QueryEscape(`{"name":{"_eq":"a"},"level":{"_in":["info","warn"]}}`))
+		assert.Len(t, result, 1)
+		assert.Equal(t, "a", result[0].Name.String)
+
+		resp = api.Get("/event?where=" + url.QueryEscape(`{"level":{"_eq":"debug"}}`))
+		assert.Equal(t, resp.Code, 422)
+	})
+
+	t.Run("Composite keys", func(t *testing.T) {
+		lines := []OrderLine{
+			{OrderID: 1, LineNo: 1, Product: "Pen", Quantity: 2},
+			{OrderID: 1, LineNo: 2, Product: "Ink", Quantity: 1},
+			{OrderID: 2, LineNo: 1, Product: "Pad", Quantity: 5},
+		}
+		resp := api.Post("/orderline", &lines)
+		assert.Equal(t, resp.Code, 200)
+
+		var created []OrderLine
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &created))
+		assert.Equal(t, lines, created)
+
+		// Single routes are addressed by the full key tuple
+		resp = api.Get("/orderline/1/2")
+		assert.Equal(t, resp.Code, 200)
+
+		var line OrderLine
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &line))
+		assert.Equal(t, lines[1], line)
+
+		resp = api.Put("/orderline/2/1", &OrderLine{Product: "Notepad", Quantity: 3})
+		assert.Equal(t, resp.Code, 200)
+
+		resp = api.Get("/orderline?order=" + url.QueryEscape(`[{"quantity":"ASC"}]`))
+		assert.Equal(t, resp.Code, 200)
+
+		var result []OrderLine
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &result))
+		assert.Equal(t, []OrderLine{lines[1], lines[0], {OrderID: 2, LineNo: 1, Product: "Notepad", Quantity: 3}}, result)
+
+		resp = api.Delete("/orderline/1/1")
+		assert.Equal(t, resp.Code, 200)
+
+		resp = api.Get("/orderline/1/1")
+		assert.Equal(t, resp.Code, 404)
+		resp = api.Get("/orderline/1/2")
+		assert.Equal(t, resp.Code, 200)
+
+		// The key segments are documented as path parameters
+		operation := api.OpenAPI().Paths["/orderline/{orderId}/{lineNo}"].Get
+		assert.Len(t, operation.Parameters, 6)
+		assert.Equal(t, "orderId", operation.Parameters[0].Name)
+		assert.Equal(t, "lineNo", operation.Parameters[1].Name)
+	})
+
+	t.Run("Key generators", func(t *testing.T) {
+		resp := api.Post("/note", &[]Note{{Text: "a"}, {ID: "custom", Text: "b"}})
+		assert.Equal(t, resp.Code, 200)
+
+		var created []Note
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &created))
+		assert.Len(t, created, 2)
+		assert.Len(t, created[0].ID, 26)
+		assert.Equal(t, "custom", created[1].ID)
+
+		resp = api.Get("/note/" + created[0].ID)
+		assert.Equal(t, resp.Code, 200)
+
+		var note Note
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &note))
+		assert.Equal(t, created[0], note)
+
+		// Resources without PUT operations are not merged on demand
+		resp = api.Post("/note/one", &Note{ID: "custom", Text: "c"}, "Prefer: resolution=merge-duplicates")
+		assert.NotEqual(t, resp.Code, 200)
+		assert.Empty(t, resp.Header().Get("Preference-Applied"))
+	})
+
+	t.Run("GET bulk links", func(t *testing.T) {
+		// The conditions added by the hook are not exposed in the links
+		resp := api.Get("/note?limit=1&count=true&where=" + url.QueryEscape(`{"text":{"_in":["a","b"]}}`))
+		assert.Equal(t, resp.Code, 200)
+		assert.Equal(t, "2", resp.Header().Get("X-Total-Count"))
+		assert.Contains(t, resp.Header().Get("Link"), url.QueryEscape(`{"text":{"_in":["a","b"]}}`))
+		assert.NotContains(t, resp.Header().Get("Link"), "hidden")
+	})
+
+	t.Run("GET aggregate", func(t *testing.T) {
+		resp := api.Post("/orderline", &[]OrderLine{
+			{OrderID: 3, LineNo: 1, Product: "Pen", Quantity: 2},
+			{OrderID: 3, LineNo: 2, Product: "Pen", Quantity: 4},
+			{OrderID: 3, LineNo: 3, Product: "Ink", Quantity: 1},
+		})
+		assert.Equal(t, resp.Code, 200)
+
+		aggregate := func(query string) []map[string]any {
+			resp := api.Get("/orderline/aggregate?where=" + url.QueryEscape(`{"orderId":{"_eq":3}}`) + query)
+			assert.Equal(t, resp.Code, 200)
+
+			var result []map[string]any
+			assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &result))
+			return result
+		}
+
+		assert.Equal(t, []map[string]any{{"count": 3.0}}, aggregate(""))
+		assert.Equal(t, []map[string]any{
+			{"product": "Ink", "count": 1.0, "sum:quantity": 1.0, "avg:quantity": 1.0, "max:quantity": 1.0},
+			{"product": "Pen", "count": 2.0, "sum:quantity": 6.0, "avg:quantity": 3.0, "max:quantity": 4.0},
+		}, aggregate("&group_by=product&metrics=count,sum:quantity,avg:quantity,max:quantity"))
+
+		resp = api.Get("/orderline/aggregate?metrics=sum:product")
+		assert.Equal(t, resp.Code, 422)
+		resp = api.Get("/orderline/aggregate?group_by=unknown")
+		assert.Equal(t, resp.Code, 422)
+
+		// The operation is opt-in, the path is taken for a single resource otherwise
+		resp = api.Get("/user/aggregate")
+		assert.Equal(t, resp.Code, 404)
+	})
+
+	t.Run("GET facets", func(t *testing.T) {
+		facets := func(query string) map[string][]map[string]any {
+			resp := api.Get("/orderline/facets?where=" + url.QueryEscape(`{"orderId":{"_eq":3}}`) + query)
+			assert.Equal(t, resp.Code, 200)
+
+			var result map[string][]map[string]any
+			assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &result))
+			return result
+		}
+
+		assert.Equal(t, map[string][]map[string]any{
+			"product":  {{"value": "Pen", "count": 2.0}, {"value": "Ink", "count": 1.0}},
+			"quantity": {{"value": 1.0, "count": 1.0}, {"value": 2.0, "count": 1.0}, {"value": 4.0, "count": 1.0}},
+		}, facets("&fields=product,quantity"))
+		assert.Equal(t, map[string][]map[string]any{
+			"product": {{"value": "Pen", "count": 2.0}},
+		}, facets("&fields=product&limit=1"))
+
+		resp := api.Get("/orderline/facets")
+		assert.Equal(t, resp.Code, 422)
+		resp = api.Get("/orderline/facets?fields=unknown")
+		assert.Equal(t, resp.Code, 422)
+
+		// The operation is opt-in, the path is taken for a single resource otherwise
+		resp = api.Get("/user/facets")
+		assert.Equal(t, resp.Code, 404)
+	})
+
+	t.Run("GET series", func(t *testing.T) {
+		type Bucket struct {
+			Bucket time.Time `json:"bucket"`
+			Value  float64   `json:"value"`
+		}
+
+		series := func(query string) []Bucket {
+			resp := api.Get("/event/series?field=at&" + query)
+			assert.Equal(t, resp.Code, 200)
+
+			var result []Bucket
+			assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &result))
+			return result
+		}
+
+		result := series("interval=month")
+		assert.Len(t, result, 3)
+		assert.True(t, result[0].Bucket.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)))
+		assert.Equal(t, []float64{1, 1, 1}, []float64{result[0].Value, result[1].Value, result[2].Value})
+
+		// Empty buckets are filled
+		result = series("interval=day&where=" + url.QueryEscape(`{"at":{"_gte":"2024-02-01T00:00:00Z"}}`))
+		assert.Len(t, result, 30)
+		assert.True(t, result[1].Bucket.Equal(time.Date(2024, 2, 2, 0, 0, 0, 0, time.UTC)))
+		assert.Equal(t, []float64{1, 0, 1}, []float64{result[0].Value, result[1].Value, result[29].Value})
+
+		// Times are truncated in the timezone, SQLite only supports timezones without daylight saving time
+		location, _ := time.LoadLocation("Etc/GMT+5")
+		result = series("interval=month&timezone=Etc/GMT%2B5")
+		assert.Len(t, result, 3)
+		assert.True(t, result[0].Bucket.Equal(time.Date(2023, 12, 1, 0, 0, 0, 0, location)))
+
+		resp := api.Get("/event/series?field=at&timezone=America/New_York")
+		assert.Equal(t, resp.Code, 422)
+
+		result = series("interval=week&metric=sum:id")
+		assert.Len(t, result, 9)
+		assert.Positive(t, result[0].Value)
+		assert.Zero(t, result[1].Value)
+
+		resp = api.Get("/event/series?field=name")
+		assert.Equal(t, resp.Code, 422)
+		resp = api.Get("/event/series?field=at&timezone=Mars/Base")
+		assert.Equal(t, resp.Code, 422)
+		resp = api.Get("/user/series?field=at")
+		assert.NotEqual(t, resp.Code, 200)
+
+		// The operation is opt-in, even for the models having time fields
+		resp = api.Get("/task/series?field=deletedAt")
+		assert.Equal(t, resp.Code, 404)
+	})
+	t.Run("Soft delete", func(t *testing.T) {
+		resp := api.Post("/task", &[]Task{{Title: "Write"}, {Title: "Review"}})
+		assert.Equal(t, resp.Code, 200)
+
+		resp = api.Delete("/task/1")
+		assert.Equal(t, resp.Code, 200)
+
+		var task Task
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &task))
+		assert.NotNil(t, task.DeletedAt)
+
+		// Deleted tasks are excluded by default
+		tasks := func(query string) []Task {
+			resp := api.Get("/task?" + query)
+			assert.Equal(t, resp.Code, 200)
+
+			var result []Task
+			assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &result))
+			return result
+		}
+
+		assert.Len(t, tasks(""), 1)
+		assert.Len(t, tasks("with_deleted=true"), 2)
+		assert.Len(t, tasks("only_deleted=true"), 1)
+		assert.Equal(t, "Write", tasks("only_deleted=true")[0].Title)
+
+		resp = api.Get("/task/1")
+		assert.Equal(t, resp.Code, 404)
+		resp = api.Get("/task/1?with_deleted=true")
+		assert.Equal(t, resp.Code, 200)
+		resp = api.Put("/task/1", &Task{ID: task.ID, Title: "Rewrite"})
+		assert.Equal(t, resp.Code, 404)
+		resp = api.Delete("/task/1")
+		assert.Equal(t, resp.Code, 404)
+
+		// Restored tasks are included again
+		resp = api.Post("/task/1/restore")
+		assert.Equal(t, resp.Code, 200)
+
+		var restored Task
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &restored))
+		assert.Nil(t, restored.DeletedAt)
+		assert.Len(t, tasks(""), 2)
+
+		resp = api.Post("/task/1/restore")
+		assert.Equal(t, resp.Code, 404)
+		resp = api.Get("/user?with_deleted=true")
+		assert.Equal(t, resp.Code, 422)
+		resp = api.Post("/user/1/restore")
+		assert.Equal(t, resp.Code, 404)
+	})
+	t.Run("Optimistic concurrency", func(t *testing.T) {
+		resp := api.Post("/page", &[]Page{{Title: "Home"}, {Title: "About"}})
+		assert.Equal(t, resp.Code, 200)
+
+		var pages []Page
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &pages))
+		assert.Equal(t, 1, pages[0].Version)
+
+		resp = api.Get("/page/1")
+		assert.Equal(t, resp.Code, 200)
+		assert.Equal(t, `"1"`, resp.Header().Get("ETag"))
+
+		// Versions are checked and incremented by the updates
+		resp = api.Put("/page/1", "If-Match: \"1\"", &Page{ID: pages[0].ID, Title: "Start"})
+		assert.Equal(t, resp.Code, 200)
+		assert.Equal(t, `"2"`, resp.Header().Get("ETag"))
+
+		resp = api.Put("/page/1", "If-Match: \"1\"", &Page{ID: pages[0].ID, Title: "Landing"})
+		assert.Equal(t, resp.Code, 412)
+		resp = api.Put("/page/1", &Page{ID: pages[0].ID, Title: "Landing", Version: 1})
+		assert.Equal(t, resp.Code, 412)
+		resp = api.Put("/page/1", &Page{ID: pages[0].ID, Title: "Landing"})
+		assert.Equal(t, resp.Code, 200)
+		id := 9
+		resp = api.Put("/page/9", "If-Match: \"1\"", &Page{ID: &id, Title: "Missing"})
+		assert.Equal(t, resp.Code, 404)
+
+		// Bulk updates with stale versions are rolled back and the conflicts are reported
+		resp = api.Put("/page", &[]Page{{ID: pages[0].ID, Title: "Home", Version: 3}, {ID: pages[1].ID, Title: "Team", Version: 5}, {ID: &id, Title: "Missing", Version: 1}})
+		assert.Equal(t, resp.Code, 412)
+		assert.Contains(t, resp.Body.String(), "body[1]")
+		assert.NotContains(t, resp.Body.String(), "body[0]")
+		assert.NotContains(t, resp.Body.String(), "body[2]")
+
+		resp = api.Get("/page/1")
+		assert.Equal(t, resp.Code, 200)
+		assert.Equal(t, `"3"`, resp.Header().Get("ETag"))
+		resp = api.Get("/user/1")
+		assert.Empty(t, resp.Header().Get("ETag"))
+	})
+	t.Run("PATCH", func(t *testing.T) {
+		slug := "docs"
+		resp := api.Post("/page/one", &Page{Title: "Docs", Slug: &slug})
+		assert.Equal(t, resp.Code, 200)
+
+		var page Page
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &page))
+		path := fmt.Sprintf("/page/%d", *page.ID)
+
+		patch := func(path string, contentType string, body string, headers ...any) (*Page, int) {
+			resp := api.Patch(path, append(headers, "Content-Type: "+contentType, strings.NewReader(body))...)
+
+			var result Page
+			json.Unmarshal(resp.Body.Bytes(), &result)
+			return &result, resp.Code
+		}
+
+		// Merge patches only update the present fields
+		result, code := patch(path, "application/merge-patch+json", `{"title":"Guide"}`)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, "Guide", result.Title)
+		assert.Equal(t, "docs", *result.Slug)
+		assert.Equal(t, 2, result.Version)
+		assert.Equal(t, []string{"title"}, patched)
+
+		// JSON Patch operations are applied when their tests pass
+		result, code = patch(path, "application/json-patch+json", `[{"op":"test","path":"/title","value":"Guide"},{"op":"remove","path":"/slug"}]`)
+		assert.Equal(t, 200, code)
+		assert.Nil(t, result.Slug)
+		assert.Equal(t, "Guide", result.Title)
+
+		// Moves and copies read the stored values, also when the source is assigned before the target
+		result, code = patch(path, "application/json-patch+json", `[{"op":"move","from":"/title","path":"/slug"},{"op":"add","path":"/title","value":"Guide"}]`)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, "Guide", *result.Slug)
+		assert.Equal(t, "Guide", result.Title)
+
+		result, code = patch(path, "application/json-patch+json", `[{"op":"remove","path":"/slug"},{"op":"copy","from":"/title","path":"/slug"}]`)
+		assert.Equal(t, 200, code)
+		assert.Equal(t, "Guide", *result.Slug)
+
+		// Operations can't read the properties written by the preceding operations
+		_, code = patch(path, "application/json-patch+json", `[{"op":"replace","path":"/title","value":"Fresh"},{"op":"copy","from":"/title","path":"/slug"}]`)
+		assert.Equal(t, 422, code)
+		_, code = patch(path, "application/json-patch+json", `[{"op":"replace","path":"/title","value":"Again"},{"op":"test","path":"/title","value":"Again"}]`)
+		assert.Equal(t, 422, code)
+
+		_, code = patch(path, "application/json-patch+json", `[{"op":"test","path":"/title","value":"Docs"},{"op":"replace","path":"/title","value":"Other"}]`)
+		assert.Equal(t, 409, code)
+		_, code = patch(path, "application/merge-patch+json", `{"title":"Other"}`, `If-Match: "1"`)
+		assert.Equal(t, 412, code)
+		_, code = patch(path, "application/merge-patch+json", `{"unknown":"value"}`)
+		assert.Equal(t, 422, code)
+		_, code = patch(path, "application/json-patch+json", `[{"op":"test","path":"/unknown","value":"value"},{"op":"replace","path":"/title","value":"Other"}]`)
+		assert.Equal(t, 422, code)
+		_, code = patch(path, "application/merge-patch+json", `{"title":1}`)
+		assert.Equal(t, 422, code)
+		_, code = patch("/page/999", "application/merge-patch+json", `{"title":"Other"}`)
+		assert.Equal(t, 404, code)
+
+		// Resources hidden by the hook are missing, whatever the preconditions
+		resp = api.Post("/page/one", Page{Title: "Hidden"})
+		assert.Equal(t, resp.Code, 200)
+
+		var hidden Page
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &hidden))
+		_, code = patch(fmt.Sprintf("/page/%d", *hidden.ID), "application/json-patch+json", `[{"op":"test","path":"/title","value":"Other"}]`)
+		assert.Equal(t, 404, code)
+		_, code = patch(fmt.Sprintf("/page/%d", *hidden.ID), "application/merge-patch+json", `{"title":"Other"}`, `If-Match: "5"`)
+		assert.Equal(t, 404, code)
+
+		// Bulk patches update the filtered resources
+		resp = api.Patch("/page?where="+url.QueryEscape(`{"title":{"_in":["Landing","Guide"]}}`), "Content-Type: application/merge-patch+json", strings.NewReader(`{"slug":"bulk"}`))
+		assert.Equal(t, resp.Code, 200)
+
+		var pages []Page
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &pages))
+		assert.Len(t, pages, 2)
+		for _, page := range pages {
+			assert.Equal(t, "bulk", *page.Slug)
+		}
+
+		// Bulk patches require a filter
+		resp = api.Patch("/page", "Content-Type: application/merge-patch+json", strings.NewReader(`{"slug":"all"}`))
+		assert.Equal(t, resp.Code, 422)
+
+		// The operations are opt-in
+		resp = api.Patch("/user/1", "Content-Type: application/merge-patch+json", strings.NewReader(`{"name":"Other"}`))
+		assert.Equal(t, resp.Code, 405)
+	})
+	t.Run("Upsert", func(t *testing.T) {
+		resp := api.Post("/product", []Product{{SKU: "A1", Name: "Apple", Stock: 1}, {SKU: "B2", Name: "Banana", Stock: 2}})
+		assert.Equal(t, resp.Code, 200)
+
+		var created []Product
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &created))
+		assert.Len(t, created, 2)
+
+		// Conflicting resources update the configured fields, the others are created
+		resp = api.Post("/product", []Product{{SKU: "A1", Name: "Apricot", Stock: 5}, {SKU: "C3", Name: "Cherry", Stock: 3}})
+		assert.Equal(t, resp.Code, 200)
+		assert.Empty(t, resp.Header().Get("Preference-Applied"))
+
+		var upserted []Product
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &upserted))
+		assert.Len(t, upserted, 2)
+		assert.Equal(t, *created[0].ID, *upserted[0].ID)
+		assert.Equal(t, "Apple", upserted[0].Name)
+		assert.Equal(t, 5, upserted[0].Stock)
+		assert.Equal(t, 2, upserted[0].Version)
+		assert.Equal(t, "Cherry", upserted[1].Name)
+		assert.Equal(t, 1, upserted[1].Version)
+
+		resp = api.Get("/product?count=true")
+		assert.Equal(t, resp.Code, 200)
+		assert.Equal(t, "3", resp.Header().Get("X-Total-Count"))
+
+		// Conflicting resources are updated only by their current version
+		resp = api.Post("/product", []Product{{SKU: "C3", Name: "Cherry", Stock: 4}, {SKU: "A1", Name: "Apricot", Stock: 6, Version: 1}})
+		assert.Equal(t, resp.Code, 412)
+		assert.Contains(t, resp.Body.String(), "body[1]")
+		resp = api.Post("/product/one", Product{SKU: "A1", Name: "Apricot", Stock: 600, Version: 2})
+		assert.Equal(t, resp.Code, 422)
+		resp = api.Post("/product/one", Product{SKU: "A1", Name: "Apricot", Stock: 6, Version: 2})
+		assert.Equal(t, resp.Code, 200)
+
+		var product Product
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &product))
+		assert.Equal(t, 6, product.Stock)
+		assert.Equal(t, 3, product.Version)
+
+		// Resources with natural keys are merged on demand
+		resp = api.Post("/orderline/one", OrderLine{OrderID: 7, LineNo: 1, Product: "Pen", Quantity: 1})
+		assert.Equal(t, resp.Code, 200)
+		resp = api.Post("/orderline/one", OrderLine{OrderID: 7, LineNo: 1, Product: "Pen", Quantity: 4}, "Prefer: return=representation, resolution=merge-duplicates")
+		assert.Equal(t, resp.Code, 200)
+		assert.Equal(t, "resolution=merge-duplicates", resp.Header().Get("Preference-Applied"))
+
+		var line OrderLine
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &line))
+		assert.Equal(t, 4, line.Quantity)
+
+		// Without the preference the duplicates fail
+		resp = api.Post("/orderline/one", OrderLine{OrderID: 7, LineNo: 1, Product: "Pen", Quantity: 2})
+		assert.NotEqual(t, resp.Code, 200)
+	})
+	t.Run("GET bulk cursor nulls", func(t *testing.T) {
+		resp := api.Post("/page", []Page{{Title: "Blank"}, {Title: "Empty"}})
+		assert.Equal(t, resp.Code, 200)
+
+		resp = api.Get("/page?count=true&limit=1")
+		assert.Equal(t, resp.Code, 200)
+		total, _ := strconv.Atoi(resp.Header().Get("X-Total-Count"))
+
+		// The cursors walk through the NULLs in every direction and placement
+		for _, direction := range []string{"ASC", "DESC", "ASC_NULLS_FIRST", "ASC_NULLS_LAST", "DESC_NULLS_FIRST", "DESC_NULLS_LAST"} {
+			order := url.QueryEscape(fmt.Sprintf(`[{"slug":"%s"}]`, direction))
+			ids, cursor := map[int]bool{}, ""
+			for range total + 1 {
+				resp := api.Get("/page?limit=1&order=" + order + "&after=" + cursor)
+				assert.Equal(t, resp.Code, 200)
+
+				var pages []Page
+				assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &pages))
+				for _, page := range pages {
+					ids[*page.ID] = true
+				}
+
+				if cursor = resp.Header().Get("X-Next-Cursor"); cursor == "" {
+					break
+				}
+			}
+			assert.Len(t, ids, total, direction)
+		}
+	})
+	t.Run("Self-referential relations", func(t *testing.T) {
+		resp := api.Post("/category", []Category{{Name: "Alpha"}, {Name: "Beta"}})
+		assert.Equal(t, resp.Code, 200)
+
+		var roots []Category
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &roots))
+		resp = api.Post("/category", []Category{{Name: "Child", ParentID: roots[0].ID}, {Name: "Child", ParentID: roots[1].ID}})
+		assert.Equal(t, resp.Code, 200)
+
+		ids := func(query string) []int {
+			resp := api.Get("/category?" + query)
+			assert.Equal(t, resp.Code, 200)
+
+			var categories []Category
+			assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &categories))
+			result := []int{}
+			for _, category := range categories {
+				result = append(result, *category.ID)
+			}
+			return result
+		}
+
+		// The parent is sorted by its own row, not by the sorted row
+		assert.Equal(t, []int{4, 3, 1, 2}, ids("order="+url.QueryEscape(`[{"parent.name":"DESC_NULLS_LAST"}]`)))
+
+		// The children are counted by the counted row
+		assert.Equal(t, []int{1, 2}, ids("where="+url.QueryEscape(`{"children":{"_count":{"_gt":0}}}`)))
+	})
+	t.Run("GET include hooks", func(t *testing.T) {
+		resp := api.Post("/category/one", Category{Name: "Root", Children: []Category{{Name: "Public"}, {Name: "Secret"}}})
+		assert.Equal(t, resp.Code, 200)
+
+		var root Category
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &root))
+		assert.Len(t, root.Children, 2)
+
+		// The hidden categories are hidden when they are included too
+		resp = api.Get(fmt.Sprintf("/category/%d?include=children", *root.ID))
+		assert.Equal(t, resp.Code, 200)
+
+		var category Category
+		assert.Empty(t, json.Unmarshal(resp.Body.Bytes(), &category))
+		assert.Len(t, category.Children, 1)
+		assert.Equal(t, "Public", category.Children[0].Name)
+	})
 }
@@ -3,57 +3,173 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"fmt"
 	"log/slog"
+	"maps"
+	"math"
 	"reflect"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Repository[Model any] interface {
-	Get(ctx context.Context, where *map[string]any, order *map[string]any, limit *int, skip *int) ([]Model, error)
+	Get(ctx context.Context, where *map[string]any, order *[]map[string]any, limit *int, skip *int, fields *[]string, include *[]string) ([]Model, error)
+	Count(ctx context.Context, where *map[string]any) (int, error)
+	Aggregate(ctx context.Context, where *map[string]any, group *[]string, metrics *[]string) ([]map[string]any, error)
+	Facets(ctx context.Context, where *map[string]any, fields *[]string, limit int) (map[string][]Facet, error)
+	Series(ctx context.Context, where *map[string]any, field string, interval string, location *time.Location, metric string) ([]Bucket, error)
 	Put(ctx context.Context, models *[]Model) ([]Model, error)
 	Post(ctx context.Context, models *[]Model) ([]Model, error)
+	Upsert(ctx context.Context, models *[]Model, conflict *Conflict) ([]Model, error)
 	Delete(ctx context.Context, where *map[string]any) ([]Model, error)
+	Restore(ctx context.Context, where *map[string]any) ([]Model, error)
+	Patch(ctx context.Context, where *map[string]any, patch *Patch[Model]) ([]Model, error)
+	Link(ctx context.Context, relation string, id string, ids []string) (int, error)
+	Unlink(ctx context.Context, relation string, id string, ids []string) (int, error)
+}
+
+// Facet is a distinct value of a field with the number of records having it
+type Facet struct {
+	Value any   `json:"value"`
+	Count int64 `json:"count"`
+}
+
+// Bucket is a time series interval with the count or the sum of its records
+type Bucket struct {
+	Time  time.Time `json:"bucket"`
+	Value float64   `json:"value"`
+}
+
+// Patch is a partial update of the records, only the listed fields are written
+type Patch[Model any] struct {
+	// Values of the set fields
+	Values Model
+	// Fields set to their values
+	Fields []string
+	// Fields set to the values of other fields, by target field
+	Copies map[string]string
+}
+
+// Conflict defines an upsert, the inserted records conflicting with the existing records update them instead
+type Conflict struct {
+	// Fields of the unique constraint detecting the conflicts, the primary keys by default
+	Fields []string
+	// Fields updated on conflict, all the inserted fields except the primary keys and the conflict fields by default
+	Updates []string
+}
+
+// ConflictError is returned when updated records have a stale version or upserted records are soft deleted, they are identified by their indexes
+type ConflictError struct {
+	Table   string
+	Indexes []int
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("stale version of %d records in %s", len(e.Indexes), e.Table)
+}
+
+// RelationError is returned when updated related records are not found or are related to other records
+type RelationError struct {
+	Table string
+}
+
+func (e *RelationError) Error() string {
+	return fmt.Sprintf("related record of %s not found", e.Table)
+}
+
+// TimezoneError is returned when the dialect can't convert the times to a timezone with daylight saving time
+type TimezoneError struct {
+	Name string
+}
+
+func (e *TimezoneError) Error() string {
+	return fmt.Sprintf("timezone %s with daylight saving time is not supported", e.Name)
 }
 
 type Field struct {
-	idx  int
-	name string
+	idx   int
+	name  string
+	json  bool
+	array bool
 }
 
 type Relation struct {
-	one   bool
-	src   string
-	dest  string
-	table string
+	idx         int
+	one         bool
+	src         string
+	dest        string
+	table       string
+	through     string
+	throughSrc  string
+	throughDest string
 }
 
 type SQLBuilder[Model any] struct {
 	table      string
+	softdelete string
+	version    string
 	keys       []string
+	natural    bool
 	fields     []Field
+	types      map[string]reflect.Type
+	searches   []string
+	fulltext   bool
+	quoted     bool
+	nullsFirst bool
 	relations  map[string]Relation
 	operations map[string]func(string, ...string) string
 	identifier func(string) string
 	parameter  func(reflect.Value, *[]any) string
-	generator  func(reflect.StructField, *[]any) string
+	generators map[string]func() any
+	arrays     func(reflect.Value) any
+	writer     SQLWriter[Model]
+	beforeGet  func(ctx context.Context, where *map[string]any, order *[]map[string]any, limit *int, skip *int) error
+	afterGet   func(ctx context.Context, models *[]Model) error
 }
 
 type SQLBuilderInterface interface {
 	Table() string
 	Where(where *map[string]any, args *[]any, run func(string) []string) string
+	Load(ctx context.Context, where *map[string]any, include *[]string, exec func(string, ...any) (*sql.Rows, error)) (reflect.Value, error)
+	Write(ctx context.Context, tx *sql.Tx, models reflect.Value, update bool) (reflect.Value, error)
+	SoftDelete() bool
+	Keyed(model reflect.Value) bool
+	Exists(ctx context.Context, tx *sql.Tx, model reflect.Value, where map[string]any) (bool, error)
+}
+
+// SQLWriter executes the dialect specific INSERT, UPDATE and upsert queries inside a transaction
+type SQLWriter[Model any] interface {
+	insert(ctx context.Context, tx *sql.Tx, models *[]Model) ([]Model, error)
+	update(ctx context.Context, tx *sql.Tx, models *[]Model) ([]Model, error)
+	upsert(ctx context.Context, tx *sql.Tx, models *[]Model, conflict *Conflict) ([]Model, error)
 }
 
 var registry = map[string]SQLBuilderInterface{}
 
-func NewSQLBuilder[Model any](operations map[string]func(string, ...string) string, identifier func(string) string, parameter func(reflect.Value, *[]any) string, generator func(reflect.StructField, *[]any) string) *SQLBuilder[Model] {
+// Operations matching text patterns, their operands are not bound to the field type
+var patterns = []string{"_like", "_nlike", "_ilike", "_nilike", "_starts_with", "_ends_with", "_contains"}
+
+// Operations comparing array fields, their operands are arrays of the field type
+var containments = []string{"_contains", "_contained_by", "_overlaps"}
+
+func NewSQLBuilder[Model any](operations map[string]func(string, ...string) string, identifier func(string) string, parameter func(reflect.Value, *[]any) string) *SQLBuilder[Model] {
 	// Reflect on the Model type to extract metadata
 	_type := reflect.TypeFor[Model]()
 
 	table := strings.ToLower(_type.Name())
+	softdelete := ""
+	version := ""
+	keys := []string{}
 	fields := []Field{}
+	types := map[string]reflect.Type{}
+	searches := []string{}
 	relations := map[string]Relation{}
-	operations_ := map[string]func(string, ...string) string{}
+	operations_ := maps.Clone(operations)
+	generators_ := map[string]func() any{}
 	for idx := range _type.NumField() {
 		_field := _type.Field(idx)
 
@@ -62,27 +178,70 @@ func NewSQLBuilder[Model any](operations map[string]func(string, ...string) stri
 			if tag := _field.Tag.Get("db"); tag != "" {
 				table = strings.Split(tag, ",")[0]
 			}
+			softdelete = _field.Tag.Get("softdelete")
 		} else {
 			// Other fields are model attributes
 			if tag := _field.Tag.Get("db"); tag != "" {
-				if _field.Tag.Get("json") == "-" {
-					// Relation field detected
-					relations[tag] = Relation{
-						one:   _field.Type.Kind() == reflect.Struct,
-						src:   _field.Tag.Get("src"),
-						dest:  _field.Tag.Get("dest"),
-						table: _field.Tag.Get("table"),
+				if _field.Tag.Get("table") != "" {
+					// Relation field detected, name it with the json tag or the db tag when hidden
+					name := strings.Split(_field.Tag.Get("json"), ",")[0]
+					if name == "" || name == "-" {
+						name = tag
 					}
-				} else {
+
+					relations[name] = Relation{
+						idx:         idx,
+						one:         _field.Type.Kind() == reflect.Struct || (_field.Type.Kind() == reflect.Pointer && _field.Type.Elem().Kind() == reflect.Struct),
+						src:         _field.Tag.Get("src"),
+						dest:        _field.Tag.Get("dest"),
+						table:       _field.Tag.Get("table"),
+						through:     _field.Tag.Get("through"),
+						throughSrc:  _field.Tag.Get("through_src"),
+						throughDest: _field.Tag.Get("through_dest"),
+					}
+				} else if _field.Tag.Get("json") != "-" {
 					// Primitive fields detected
 					name := strings.Split(tag, ",")[0]
-					fields = append(fields, Field{idx, name})
+					marshal := slices.Contains(strings.Split(tag, ",")[1:], "json")
+					array := !marshal && isArray(_field.Type)
+					fields = append(fields, Field{idx, name, marshal, array})
+					types[name] = _field.Type
+					if _field.Tag.Get("key") == "true" {
+						keys = append(keys, name)
+					}
+					if _field.Tag.Get("search") == "true" {
+						searches = append(searches, name)
+					}
+					if _field.Tag.Get("version") == "true" {
+						_type := _field.Type
+						for _type.Kind() == reflect.Pointer {
+							_type = _type.Elem()
+						}
+						if !slices.Contains([]reflect.Kind{reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64}, _type.Kind()) {
+							panic("unsupported version type " + _type.String())
+						}
+						version = name
+					}
+					if tag := _field.Tag.Get("keygen"); tag != "" {
+						generator, ok := generators[tag]
+						if !ok {
+							panic("unsupported key generator " + tag)
+						}
+						generators_[name] = generator
+					}
 
 					// Add base operations for the field
 					for key, value := range operations {
 						operations_[name+key] = value
 					}
 
+					// Add containment operations for the array field
+					if array {
+						for _, key := range containments {
+							operations_[name+key] = operations["_array"+key]
+						}
+					}
+
 					// Check if the field has a method named "Operations"
 					// Then add its custom defined operations for the field
 					if _method, ok := _field.Type.MethodByName("Operations"); ok {
@@ -98,17 +257,29 @@ func NewSQLBuilder[Model any](operations map[string]func(string, ...string) stri
 		}
 	}
 
-	slog.Debug("SQLBuilder initialized", slog.String("table", table), slog.Any("fields", fields), slog.Any("relations", relations))
+	// Fields tagged as keys form the natural primary key, provided by the client
+	// Otherwise the first field is the primary key, generated by the database
+	natural := len(keys) > 0
+	if !natural {
+		keys = []string{fields[0].name}
+	}
+
+	slog.Debug("SQLBuilder initialized", slog.String("table", table), slog.String("softdelete", softdelete), slog.String("version", version), slog.Any("keys", keys), slog.Any("fields", fields), slog.Any("relations", relations))
 
 	result := &SQLBuilder[Model]{
 		table:      table,
-		keys:       []string{fields[0].name},
+		softdelete: softdelete,
+		version:    version,
+		keys:       keys,
+		natural:    natural,
 		fields:     fields,
+		types:      types,
+		searches:   searches,
 		relations:  relations,
 		operations: operations_,
 		identifier: identifier,
 		parameter:  parameter,
-		generator:  generator,
+		generators: generators_,
 	}
 
 	registry[table] = result
@@ -116,6 +287,15 @@ func NewSQLBuilder[Model any](operations map[string]func(string, ...string) stri
 	return result
 }
 
+// SetGetHooks sets the get hooks of the registered model, they run when its records are included by other models
+func SetGetHooks[Model any](before func(ctx context.Context, where *map[string]any, order *[]map[string]any, limit *int, skip *int) error, after func(ctx context.Context, models *[]Model) error) {
+	for _, item := range registry {
+		if builder, ok := item.(*SQLBuilder[Model]); ok {
+			builder.beforeGet, builder.afterGet = before, after
+		}
+	}
+}
+
 // Returns the table name with proper identifier formatting
 func (b *SQLBuilder[Model]) Table() string {
 	slog.Debug("Fetching table name", slog.String("table", b.table))
@@ -133,8 +313,38 @@ func (b *SQLBuilder[Model]) Fields(prefix string) string {
 	return strings.Join(result, ",")
 }
 
+// Returns a copy of the builder narrowed to the selected fields
+// Primary keys and source fields of the included relations are always selected
+func (b *SQLBuilder[Model]) Select(fields *[]string, include *[]string) *SQLBuilder[Model] {
+	if fields == nil || len(*fields) <= 0 {
+		return b
+	}
+
+	selected := slices.Clone(*fields)
+	if include != nil {
+		for _, item := range *include {
+			name, _, _ := strings.Cut(item, ".")
+			if relation, ok := b.relations[name]; ok {
+				selected = append(selected, relation.src)
+			}
+		}
+	}
+
+	result := *b
+	result.fields = []Field{}
+	for _, field := range b.fields {
+		if slices.Contains(b.keys, field.name) || slices.Contains(selected, field.name) {
+			result.fields = append(result.fields, field)
+		}
+	}
+
+	slog.Debug("Selected fields", slog.Any("fields", result.fields))
+	return &result
+}
+
 // Constructs the VALUES clause for an INSERT query
-func (b *SQLBuilder[Model]) Values(values *[]Model, args *[]any, keys *[]any) (string, string) {
+// Fields having a key generator are filled in the models when they are not set, and versions start at 1
+func (b *SQLBuilder[Model]) Values(values *[]Model, args *[]any) (string, string) {
 	if values == nil {
 		return "", ""
 	}
@@ -142,37 +352,34 @@ func (b *SQLBuilder[Model]) Values(values *[]Model, args *[]any, keys *[]any) (s
 	// Generate the field names for the VALUES clause
 	fields := []string{}
 	for idx, field := range b.fields {
-		if idx == 0 {
-			// The first field is the primary key
-			if b.generator != nil {
-				// If a generator function is provided, primary key will be generated
-				fields = append(fields, b.identifier(field.name))
-			}
-		} else {
-			// Other fields are added to the VALUES clause
+		// The primary key generated by the database and the soft delete column are skipped
+		if !b.generated(idx, field) && field.name != b.softdelete {
 			fields = append(fields, b.identifier(field.name))
 		}
 	}
 
 	// Generate the field values for the VALUES clause
 	result := []string{}
-	for _, model := range *values {
-		_type := reflect.TypeOf(model)
-		_value := reflect.ValueOf(model)
+	for i := range *values {
+		_value := reflect.ValueOf(&(*values)[i]).Elem()
 
 		// Generate the values for the current model
 		items := []string{}
 		for idx, field := range b.fields {
-			if idx == 0 {
-				// The first field is the primary key
-				if b.generator != nil {
-					// If a generator function is provided, use it to generate the key
-					items = append(items, b.generator(_type.Field(field.idx), keys))
-				}
-			} else {
-				// Other fields are added to the VALUES clause
-				items = append(items, b.parameter(_value.Field(field.idx), args))
+			if b.generated(idx, field) || field.name == b.softdelete {
+				continue
+			}
+
+			// Fill the unset fields having a key generator
+			if generator, ok := b.generators[field.name]; ok && _value.Field(field.idx).IsZero() {
+				_field := _value.Field(field.idx)
+				assign(_field, bind(reflect.ValueOf(generator()), _field.Type()))
+			}
+			if field.name == b.version && _value.Field(field.idx).IsZero() {
+				assign(_value.Field(field.idx), reflect.ValueOf(1))
 			}
+
+			items = append(items, b.parameter(b.value(field, _value), args))
 		}
 
 		result = append(result, "("+strings.Join(items, ",")+")")
@@ -182,6 +389,19 @@ func (b *SQLBuilder[Model]) Values(values *[]Model, args *[]any, keys *[]any) (s
 	return strings.Join(fields, ","), strings.Join(result, ",")
 }
 
+// Returns true if the field is the primary key generated by the database
+// It is the first field when no natural keys are defined and it has no key generator
+func (b *SQLBuilder[Model]) generated(idx int, field Field) bool {
+	_, ok := b.generators[field.name]
+	return idx == 0 && !b.natural && !ok
+}
+
+// Returns true if the primary keys are known before insert, either provided by the client or filled by a key generator
+func (b *SQLBuilder[Model]) assigned() bool {
+	_, ok := b.generators[b.keys[0]]
+	return b.natural || ok
+}
+
 // Constructs the SET clause for an UPDATE query
 func (b *SQLBuilder[Model]) Set(set *Model, args *[]any, where *map[string]any) string {
 	if set == nil {
@@ -192,36 +412,21 @@ func (b *SQLBuilder[Model]) Set(set *Model, args *[]any, where *map[string]any)
 
 	// Generate the field names for the SET clause
 	result := []string{}
-	for idx, field := range b.fields {
-		if idx == 0 {
-			// The first field is the primary key
-			// Use it to construct the WHERE clause
-			if where != nil {
-				// Get the field value
-				_field := _value.Field(field.idx)
-				for _field.Kind() == reflect.Pointer {
-					_field = _field.Elem()
-				}
+	for _, field := range b.fields {
+		if field.name == b.version {
+			// Version is incremented by each update
+			result = append(result, field.name+"="+b.identifier(field.name)+"+1")
+		} else if !slices.Contains(b.keys, field.name) && field.name != b.softdelete {
+			// Primary keys and the soft delete column are not updated, other fields are added to the SET clause
+			result = append(result, field.name+"="+b.parameter(b.value(field, _value), args))
+		}
+	}
 
-				// Set the WHERE clause condition based on the field type
-				switch _field.Kind() {
-				case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-					(*where)[field.name] = map[string]any{"_eq": fmt.Sprintf("%d", _field.Int())}
-				case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-					(*where)[field.name] = map[string]any{"_eq": fmt.Sprintf("%d", _field.Uint())}
-				case reflect.Float32, reflect.Float64:
-					(*where)[field.name] = map[string]any{"_eq": fmt.Sprintf("%f", _field.Float())}
-				case reflect.Complex64, reflect.Complex128:
-					(*where)[field.name] = map[string]any{"_eq": fmt.Sprintf("%f", _field.Complex())}
-				case reflect.String:
-					(*where)[field.name] = map[string]any{"_eq": _field.String()}
-				default:
-					panic("Invalid identifier type")
-				}
-			}
-		} else {
-			// Other fields are added to the SET clause
-			result = append(result, field.name+"="+b.parameter(_value.Field(field.idx), args))
+	// Primary keys are used to construct the WHERE clause, with the version when it is set
+	if where != nil {
+		maps.Copy(*where, b.Key(*set))
+		if value, ok := b.Version(*set); ok {
+			(*where)[b.version] = map[string]any{"_eq": value}
 		}
 	}
 
@@ -229,136 +434,1992 @@ func (b *SQLBuilder[Model]) Set(set *Model, args *[]any, where *map[string]any)
 	return strings.Join(result, ",")
 }
 
-// Constructs the ORDER BY clause for a query
-func (b *SQLBuilder[Model]) Order(order *map[string]any) string {
-	if order == nil {
-		return ""
+// Returns true if the records are soft deleted by setting their soft delete column
+func (b *SQLBuilder[Model]) SoftDelete() bool {
+	return b.softdelete != ""
+}
+
+// Constructs the SET clause of the soft delete column, the records are marked as deleted now or restored
+func (b *SQLBuilder[Model]) Trash(restore bool, args *[]any) string {
+	if restore {
+		return b.identifier(b.softdelete) + "=NULL"
 	}
 
-	// Generate the field names for the ORDER BY clause
+	return b.identifier(b.softdelete) + "=" + b.parameter(reflect.ValueOf(time.Now().UTC()), args)
+}
+
+// Returns a copy of the filters with the _deleted scope, e.g. "only" to match the soft deleted records
+func scoped(where *map[string]any, scope string) *map[string]any {
+	result := map[string]any{"_deleted": scope}
+	if where != nil {
+		result = maps.Clone(*where)
+		result["_deleted"] = scope
+	}
+
+	return &result
+}
+
+// Constructs the SET clause for a partial UPDATE query, only the fields of the patch are set
+// Copies are set first, since MySQL reads the values set by the preceding assignments
+func (b *SQLBuilder[Model]) Patch(patch *Patch[Model], args *[]any) string {
+	_value := reflect.ValueOf(patch.Values)
+
+	// Primary keys and the soft delete column are not updated
+	fields := slices.DeleteFunc(slices.Clone(b.fields), func(field Field) bool {
+		return slices.Contains(b.keys, field.name) || field.name == b.softdelete
+	})
+
+	// Generate the field names for the SET clause
 	result := []string{}
-	for key, val := range *order {
-		result = append(result, fmt.Sprintf("%s %s", b.identifier(key), val))
+	for _, field := range fields {
+		if source, ok := patch.Copies[field.name]; ok && field.name != b.version && b.types[source] != nil {
+			result = append(result, field.name+"="+b.identifier(source))
+		}
+	}
+	for _, field := range fields {
+		if field.name == b.version {
+			// Version is incremented by each update
+			result = append(result, field.name+"="+b.identifier(field.name)+"+1")
+		} else if source, ok := patch.Copies[field.name]; ok && b.types[source] != nil {
+			continue
+		} else if slices.Contains(patch.Fields, field.name) {
+			result = append(result, field.name+"="+b.parameter(b.value(field, _value), args))
+		}
 	}
 
-	slog.Debug("Constructed ORDER BY clause", slog.Any("order", result))
+	slog.Debug("Constructed SET clause of patch", slog.String("set", strings.Join(result, ",")))
 	return strings.Join(result, ",")
 }
 
-// Constructs the WHERE clause for a query
-func (b *SQLBuilder[Model]) Where(where *map[string]any, args *[]any, run func(string) []string) string {
-	if where == nil {
-		return ""
+// Constructs the conflict fields, the SET clause and the condition of the updated records of an upsert
+// The inserted values are referenced by source and the existing values by target, versions are incremented
+// Only the existing records having the inserted version and not being soft deleted are updated, the others are skipped
+func (b *SQLBuilder[Model]) Conflict(conflict *Conflict, source func(string) string, target func(string) string) ([]string, string, string, error) {
+	fields, err := b.targets(conflict)
+	if err != nil {
+		return nil, "", "", err
 	}
 
-	// Check for special conditions
-	// _not, _and, and _or are used for logical operations
-	if item, ok := (*where)["_not"]; ok {
-		expr := item.(map[string]any)
+	updates := []string{}
+	if conflict != nil && len(conflict.Updates) > 0 {
+		for _, name := range conflict.Updates {
+			if !b.inserted(name) {
+				return nil, "", "", fmt.Errorf("update field %s of %s not found", name, b.table)
+			}
+			updates = append(updates, name)
+		}
+	} else {
+		for _, field := range b.fields {
+			if b.inserted(field.name) && !slices.Contains(b.keys, field.name) && !slices.Contains(fields, field.name) {
+				updates = append(updates, field.name)
+			}
+		}
+	}
 
-		return "NOT (" + b.Where(&expr, args, run) + ")"
-	} else if items, ok := (*where)["_and"]; ok {
-		result := []string{}
-		for _, item := range items.([]any) {
-			expr := item.(map[string]any)
-			result = append(result, b.Where(&expr, args, run))
+	// Generate the field names for the SET clause
+	result := []string{}
+	for _, name := range updates {
+		if name != b.version {
+			result = append(result, b.identifier(name)+"="+source(name))
 		}
+	}
+	conditions := []string{}
+	if b.version != "" {
+		result = append(result, b.identifier(b.version)+"="+target(b.version)+"+1")
+		conditions = append(conditions, target(b.version)+"="+source(b.version))
+	}
+	if b.softdelete != "" {
+		conditions = append(conditions, target(b.softdelete)+" IS NULL")
+	}
 
-		return "(" + strings.Join(result, " AND ") + ")"
-	} else if items, ok := (*where)["_or"]; ok {
-		result := []string{}
-		for _, item := range items.([]any) {
-			expr := item.(map[string]any)
-			result = append(result, b.Where(&expr, args, run))
+	// Conflicting records are still returned when nothing is updated
+	if len(result) <= 0 {
+		result = append(result, b.identifier(fields[0])+"="+source(fields[0]))
+	}
+
+	slog.Debug("Constructed SET clause of conflict", slog.Any("fields", fields), slog.String("set", strings.Join(result, ",")), slog.Any("conditions", conditions))
+	return fields, strings.Join(result, ","), strings.Join(conditions, " AND "), nil
+}
+
+// Returns the conflict fields of an upsert, the primary keys by default when they are known before insert
+func (b *SQLBuilder[Model]) targets(conflict *Conflict) ([]string, error) {
+	fields := []string{}
+	if conflict != nil && len(conflict.Fields) > 0 {
+		fields = slices.Clone(conflict.Fields)
+	} else if b.assigned() {
+		fields = slices.Clone(b.keys)
+	} else {
+		return nil, fmt.Errorf("conflict fields of %s are required, its primary key is generated", b.table)
+	}
+	for _, name := range fields {
+		if !b.inserted(name) {
+			return nil, fmt.Errorf("conflict field %s of %s not found", name, b.table)
 		}
+	}
 
-		return "(" + strings.Join(result, " OR ") + ")"
+	return fields, nil
+}
+
+// Returns true if the field is written by the inserts
+func (b *SQLBuilder[Model]) inserted(name string) bool {
+	idx := slices.IndexFunc(b.fields, func(field Field) bool { return field.name == name })
+	return idx >= 0 && !b.generated(idx, b.fields[idx]) && name != b.softdelete
+}
+
+// Returns true if the existing record can't be updated by the upserted model
+// Soft deleted records are never updated, versioned records are updated only by their version which new models start at
+func (b *SQLBuilder[Model]) Stale(model Model, record Model) bool {
+	for _, field := range b.fields {
+		if field.name == b.softdelete {
+			if _, ok := indirect(reflect.ValueOf(record).Field(field.idx)); ok {
+				return true
+			}
+		} else if field.name == b.version {
+			version, ok := indirect(reflect.ValueOf(model).Field(field.idx))
+			if !ok || reflect.ValueOf(version).IsZero() {
+				version = 1
+			}
+			current, _ := indirect(reflect.ValueOf(record).Field(field.idx))
+			if fmt.Sprint(version) != fmt.Sprint(current) {
+				return true
+			}
+		}
 	}
 
-	// Otherwise, construct the WHERE clause based on the field names and operations
+	return false
+}
+
+// Returns true if the model and the record have the same values of the fields
+func (b *SQLBuilder[Model]) same(model Model, record Model, names []string) bool {
+	for _, field := range b.fields {
+		if !slices.Contains(names, field.name) {
+			continue
+		}
+
+		value, _ := indirect(reflect.ValueOf(model).Field(field.idx))
+		current, _ := indirect(reflect.ValueOf(record).Field(field.idx))
+		if left, ok := value.(time.Time); ok {
+			if right, ok := current.(time.Time); !ok || !left.Equal(right) {
+				return false
+			}
+		} else if !reflect.DeepEqual(value, current) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns the WHERE clause matching the values of the fields of the model
+func (b *SQLBuilder[Model]) Match(model Model, names []string) map[string]any {
+	_value := reflect.ValueOf(model)
+
+	result := map[string]any{}
+	for _, field := range b.fields {
+		if !slices.Contains(names, field.name) {
+			continue
+		}
+
+		if value, ok := indirect(_value.Field(field.idx)); ok {
+			result[field.name] = map[string]any{"_eq": value}
+		} else {
+			result[field.name] = map[string]any{"_is_null": true}
+		}
+	}
+
+	return result
+}
+
+// Returns the version of the model, or false if the model has no version or it is not set
+func (b *SQLBuilder[Model]) Version(model Model) (any, bool) {
+	for _, field := range b.fields {
+		if field.name != b.version {
+			continue
+		}
+
+		if value, ok := indirect(reflect.ValueOf(model).Field(field.idx)); ok && !reflect.ValueOf(value).IsZero() {
+			return value, true
+		}
+	}
+
+	return nil, false
+}
+
+// Returns the WHERE clause matching the primary key values of the model
+// Values are kept as is, so they are bound to the key type like the other operands
+func (b *SQLBuilder[Model]) Key(model Model) map[string]any {
+	_value := reflect.ValueOf(model)
+
+	result := map[string]any{}
+	for _, field := range b.fields {
+		if !slices.Contains(b.keys, field.name) {
+			continue
+		}
+
+		// Unset keys only match NULL keys
+		if value, ok := indirect(_value.Field(field.idx)); ok {
+			result[field.name] = map[string]any{"_eq": value}
+		} else {
+			result[field.name] = map[string]any{"_is_null": true}
+		}
+	}
+
+	return result
+}
+
+// Constructs the ORDER BY clause for a query
+func (b *SQLBuilder[Model]) Order(order *[]map[string]any, args *[]any) string {
+	// Generate the field names for the ORDER BY clause
 	result := []string{}
-	for key, item := range *where {
-		for op, value := range item.(map[string]any) {
-			if handler, ok := b.operations[key+op]; ok {
-				// Primitive field condition detected
-				_value := reflect.ValueOf(value)
-
-				if _value.Kind() == reflect.String {
-					// String values are passed to operation handler as single parameter
-					result = append(result, handler(b.identifier(key), b.parameter(_value, args)))
-				} else if _value.Kind() == reflect.Slice || _value.Kind() == reflect.Array {
-					// Slice or array values are passed to operation handler as a list of parameters
-					items := []string{}
-					for i := range _value.Len() {
-						items = append(items, b.parameter(_value.Index(i), args))
-					}
+	for _, item := range b.sort(order) {
+		if item[0] == "_rank" {
+			// Relevance of the search query is used internally for ranking, most relevant first
+			result = append(result, b.Rank(b.query(order), args)+" DESC")
+		} else if handler, ok := b.operations["_"+strings.ToLower(item[1])]; ok {
+			// Directions with NULLS placement are handled by the dialect
+			result = append(result, handler(b.column(item[0])))
+		} else {
+			result = append(result, fmt.Sprintf("%s %s", b.column(item[0]), item[1]))
+		}
+	}
 
-					result = append(result, handler(b.identifier(key), items...))
-				}
-			} else {
-				// Relation field condition detected
-				if relation, ok := b.relations[key]; ok {
-					// Get the target SQLBuilder for the relation
-					builder := registry[relation.table]
-
-					// Construct the sub-query for the related table
-					args_ := []any{}
-					where := item.(map[string]any)
-					query := fmt.Sprintf("SELECT %s FROM %s", b.identifier(relation.dest), builder.Table())
-					if expr := builder.Where(&where, &args_, run); expr != "" {
-						query += fmt.Sprintf(" WHERE %s", expr)
-					}
+	slog.Debug("Constructed ORDER BY clause", slog.Any("order", result))
+	return strings.Join(result, ",")
+}
 
-					if run == nil {
-						// If no run function is provided, sub-query is added to the main query
-						*args = append(*args, args_...)
-						result = append(result, b.operations["_in"](b.identifier(relation.src), query))
-					} else {
-						// If a run function is provided, sub-query is executed and its result is added to the main query
-						result = append(result, b.operations["_in"](b.identifier(relation.src), run(query)...))
-					}
-				}
+// Returns the ordered field name and direction pairs with the primary keys appended as a stable tiebreaker
+func (b *SQLBuilder[Model]) sort(order *[]map[string]any) [][2]string {
+	result := [][2]string{}
+	if order != nil {
+		for _, item := range *order {
+			for key, value := range item {
+				result = append(result, [2]string{key, strings.ToUpper(fmt.Sprint(value))})
 			}
 		}
 	}
 
-	slog.Debug("Constructed WHERE clause", slog.Any("where", result))
-	return strings.Join(result, " AND ")
+	for _, key := range b.keys {
+		if !slices.ContainsFunc(result, func(item [2]string) bool { return item[0] == key }) {
+			result = append(result, [2]string{key, "ASC"})
+		}
+	}
+
+	return result
 }
 
-// Scans the rows returned by a query into a slice of Model
-func (b *SQLBuilder[Model]) Scan(rows *sql.Rows, err error) ([]Model, error) {
-	if err != nil {
-		slog.Error("Error during query execution", slog.Any("error", err))
-		return nil, err
+// Returns the column expression of a field name with proper identifier formatting
+// Fields of to-one relations like "user.name" are resolved by a correlated sub-query
+func (b *SQLBuilder[Model]) column(key string) string {
+	if name, field, ok := strings.Cut(key, "."); ok {
+		if relation, ok := b.relations[name]; ok && relation.one {
+			// Get the target SQLBuilder for the relation
+			builder := registry[relation.table]
+
+			// The related table is aliased, so self-referential relations are not ambiguous
+			alias := b.identifier("_" + name)
+			return fmt.Sprintf("(SELECT %[1]s.%[2]s FROM %[3]s AS %[1]s WHERE %[1]s.%[4]s = %[5]s.%[6]s)", alias, b.identifier(field), builder.Table(), b.identifier(relation.dest), b.Table(), b.identifier(relation.src))
+		}
 	}
-	defer rows.Close()
 
-	// Iterate over the rows and scan each one into a Model instance
-	result := []Model{}
-	for rows.Next() {
-		var model Model
-		_value := reflect.ValueOf(&model).Elem()
+	return b.identifier(key)
+}
 
-		// Create a slice of addresses to scan the values into
-		_addrs := []any{}
-		for _, field := range b.fields {
-			_addrs = append(_addrs, _value.Field(field.idx).Addr().Interface())
+// Constructs the seek condition of keyset pagination
+// The row value comparison (a, b) > (x, y) is expanded to (a > x) OR (a = x AND b > y)
+// So it supports mixed directions and works on every dialect
+func (b *SQLBuilder[Model]) Seek(order *[]map[string]any, cursor *map[string]any, args *[]any) string {
+	if cursor == nil {
+		return ""
+	}
+
+	items := b.sort(order)
+
+	// Returns the cursor value of the field, or false if it's NULL
+	value := func(key string) (reflect.Value, bool) {
+		if item, ok := indirect(reflect.ValueOf((*cursor)[key])); ok && item != nil {
+			return reflect.ValueOf(item), true
 		}
+		return reflect.Value{}, false
+	}
 
-		// Scan the row into the addresses
-		if err := rows.Scan(_addrs...); err != nil {
-			return nil, err
+	result := []string{}
+	for idx, item := range items {
+		// Previous fields must be equal to the cursor values
+		exprs := []string{}
+		for _, prev := range items[:idx] {
+			if _value, ok := value(prev[0]); ok {
+				exprs = append(exprs, b.operations[prev[0]+"_eq"](b.identifier(prev[0]), b.parameter(_value, args)))
+			} else {
+				exprs = append(exprs, b.operations["_is_null"](b.identifier(prev[0]), "true"))
+			}
 		}
 
-		result = append(result, model)
+		// NULLs are placed by the direction, or by the dialect when the placement is not set
+		first := strings.HasSuffix(item[1], "_NULLS_FIRST")
+		if !strings.HasSuffix(item[1], "_NULLS_FIRST") && !strings.HasSuffix(item[1], "_NULLS_LAST") {
+			first = b.nullsFirst != strings.HasPrefix(item[1], "DESC")
+		}
+
+		// Current field must be after the cursor value based on the direction, NULLs are after the values when placed last
+		op := "_gt"
+		if strings.HasPrefix(item[1], "DESC") {
+			op = "_lt"
+		}
+		if _value, ok := value(item[0]); ok && first {
+			exprs = append(exprs, b.operations[item[0]+op](b.identifier(item[0]), b.parameter(_value, args)))
+		} else if ok {
+			exprs = append(exprs, "("+b.operations[item[0]+op](b.identifier(item[0]), b.parameter(_value, args))+" OR "+b.operations["_is_null"](b.identifier(item[0]), "true")+")")
+		} else if first {
+			exprs = append(exprs, b.operations["_is_null"](b.identifier(item[0]), "false"))
+		} else {
+			// Nothing is after the NULLs placed last
+			continue
+		}
+
+		result = append(result, "("+strings.Join(exprs, " AND ")+")")
+	}
+	if len(result) <= 0 {
+		return "(1=0)"
 	}
 
-	if err = rows.Err(); err != nil {
-		slog.Error("Error during row iteration", slog.Any("error", err))
-		return nil, err
+	slog.Debug("Constructed seek condition", slog.Any("seek", result))
+	return "(" + strings.Join(result, " OR ") + ")"
+}
+
+// Returns whether the model has searchable fields
+func (b *SQLBuilder[Model]) Searchable() bool {
+	return len(b.searches) > 0
+}
+
+// Returns whether the model has a single integer primary key, which the full-text tables of some dialects reference
+func (b *SQLBuilder[Model]) Rowid() bool {
+	if len(b.keys) != 1 {
+		return false
 	}
 
-	slog.Debug("Scan completed", slog.Any("result", result))
-	return result, nil
+	_type := b.types[b.keys[0]]
+	for _type != nil && _type.Kind() == reflect.Pointer {
+		_type = _type.Elem()
+	}
+
+	if _type == nil {
+		return false
+	}
+
+	switch _type.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// Enables the dialect full-text search, otherwise the searchable fields are matched by OR-ed LIKE
+func (b *SQLBuilder[Model]) FullText(enabled bool) {
+	b.fulltext = enabled
+}
+
+// Constructs the full-text search condition of the searchable fields
+// The dialect handler receives the table, the query parameter, the key column and the searchable columns
+func (b *SQLBuilder[Model]) Search(query string, args *[]any) string {
+	if len(b.searches) == 0 {
+		return "1 = 0"
+	}
+
+	if handler, ok := b.operations["_search"]; ok && b.fulltext {
+		if b.quoted && terms(query) == "" {
+			return "1 = 0"
+		}
+		return handler(b.table, b.search(query, args)...)
+	}
+
+	// Fallback to match any of the searchable fields containing the query
+	result := []string{}
+	for _, name := range b.searches {
+		result = append(result, b.operations["_contains"](b.identifier(name), b.parameter(reflect.ValueOf(query), args)))
+	}
+
+	slog.Debug("Constructed search condition", slog.Any("search", result))
+	return "(" + strings.Join(result, " OR ") + ")"
+}
+
+// Constructs the relevance of the search query, higher values are more relevant
+// The fallback relevance is the number of searchable fields containing the query
+func (b *SQLBuilder[Model]) Rank(query string, args *[]any) string {
+	if len(b.searches) == 0 {
+		return "0"
+	}
+
+	if handler, ok := b.operations["_rank"]; ok && b.fulltext {
+		if b.quoted && terms(query) == "" {
+			return "0"
+		}
+		return handler(b.table, b.search(query, args)...)
+	}
+
+	result := []string{}
+	for _, name := range b.searches {
+		result = append(result, fmt.Sprintf("CASE WHEN %s THEN 1 ELSE 0 END", b.operations["_contains"](b.identifier(name), b.parameter(reflect.ValueOf(query), args))))
+	}
+
+	return "(" + strings.Join(result, " + ") + ")"
+}
+
+// Returns the arguments of the search handlers, the query parameter, the key column and the searchable columns
+// The dialects parsing the query with their query syntax receive its quoted terms, so it's matched as plain text
+func (b *SQLBuilder[Model]) search(query string, args *[]any) []string {
+	if b.quoted {
+		query = terms(query)
+	}
+
+	result := []string{b.parameter(reflect.ValueOf(query), args), b.identifier(b.keys[0])}
+	for _, name := range b.searches {
+		result = append(result, b.identifier(name))
+	}
+
+	return result
+}
+
+// Returns the words of the text as double quoted terms which all must match, embedded double quotes are doubled
+func terms(text string) string {
+	result := []string{}
+	for _, word := range strings.Fields(text) {
+		result = append(result, `"`+strings.ReplaceAll(word, `"`, `""`)+`"`)
+	}
+
+	return strings.Join(result, " AND ")
+}
+
+// Returns the search query of the rank order item
+func (b *SQLBuilder[Model]) query(order *[]map[string]any) string {
+	for _, item := range *order {
+		if value, ok := item["_rank"]; ok {
+			return fmt.Sprint(value)
+		}
+	}
+
+	return ""
+}
+
+// Constructs the WHERE clause for a query
+// Soft deleted records are excluded, unless the _deleted scope includes them
+func (b *SQLBuilder[Model]) Where(where *map[string]any, args *[]any, run func(string) []string) string {
+	if b.softdelete == "" {
+		return b.where(where, args, run)
+	}
+
+	// The _deleted scope is used internally to include ("with") or select ("only") the soft deleted records
+	scope, filter := "", map[string]any{}
+	if where != nil {
+		filter = maps.Clone(*where)
+		scope = fmt.Sprint(filter["_deleted"])
+		delete(filter, "_deleted")
+	}
+
+	result := []string{}
+	switch scope {
+	case "with":
+	case "only":
+		result = append(result, b.operations["_is_null"](b.identifier(b.softdelete), "false"))
+	default:
+		result = append(result, b.operations["_is_null"](b.identifier(b.softdelete), "true"))
+	}
+	if expr := b.where(&filter, args, run); expr != "" {
+		result = append(result, expr)
+	}
+
+	return strings.Join(result, " AND ")
+}
+
+// Constructs the WHERE clause of the filters recursively
+func (b *SQLBuilder[Model]) where(where *map[string]any, args *[]any, run func(string) []string) string {
+	if where == nil {
+		return ""
+	}
+
+	// Check for special conditions
+	// _not, _and, and _or are used for logical operations
+	// _seek is used internally for keyset pagination
+	// _search is used internally for full-text search
+	if item, ok := (*where)["_search"]; ok {
+		return b.Search(fmt.Sprint(item), args)
+	} else if item, ok := (*where)["_seek"]; ok {
+		seek := item.(map[string]any)
+		order := seek["order"].([]map[string]any)
+		cursor := seek["cursor"].(map[string]any)
+
+		return b.Seek(&order, &cursor, args)
+	} else if item, ok := (*where)["_not"]; ok {
+		expr := item.(map[string]any)
+
+		return "NOT (" + b.where(&expr, args, run) + ")"
+	} else if items, ok := (*where)["_and"]; ok {
+		// Empty conditions match every record, so they are skipped
+		result := []string{}
+		for _, item := range items.([]any) {
+			expr := item.(map[string]any)
+			if expr := b.where(&expr, args, run); expr != "" {
+				result = append(result, expr)
+			}
+		}
+		if len(result) <= 0 {
+			return ""
+		}
+
+		return "(" + strings.Join(result, " AND ") + ")"
+	} else if items, ok := (*where)["_or"]; ok {
+		// Empty conditions match every record, so does the disjunction and its arguments are dropped
+		count := len(*args)
+		result := []string{}
+		for _, item := range items.([]any) {
+			expr := item.(map[string]any)
+			expr_ := b.where(&expr, args, run)
+			if expr_ == "" {
+				*args = (*args)[:count]
+				return ""
+			}
+			result = append(result, expr_)
+		}
+
+		return "(" + strings.Join(result, " OR ") + ")"
+	}
+
+	// Otherwise, construct the WHERE clause based on the field names and operations
+	result := []string{}
+	for key, item := range *where {
+		if relation, ok := b.relations[key]; ok {
+			// Relation field condition detected
+			if expr := b.filter(relation, item.(map[string]any), args, run); expr != "" {
+				result = append(result, expr)
+			}
+			continue
+		}
+
+		for op, value := range item.(map[string]any) {
+			if op == "_path" {
+				// JSON path condition detected
+				result = append(result, b.path(key, value.(map[string]any), args)...)
+			} else if handler, ok := b.operations[key+op]; ok && slices.Contains(containments, op) && isArray(b.types[key]) {
+				// Array field condition detected, the operand array is passed as a single parameter
+				if _value := reflect.ValueOf(value); _value.Kind() == reflect.Slice {
+					items := reflect.MakeSlice(b.types[key], 0, _value.Len())
+					for i := range _value.Len() {
+						if item := bind(_value.Index(i), b.types[key].Elem()); item.IsValid() && item.Type().ConvertibleTo(b.types[key].Elem()) {
+							items = reflect.Append(items, item.Convert(b.types[key].Elem()))
+						}
+					}
+
+					result = append(result, handler(b.identifier(key), b.parameter(b.array(items), args)))
+				}
+			} else if handler, ok := b.operations[key+op]; ok {
+				// Primitive field condition detected
+				_type := b.types[key]
+				if slices.Contains(patterns, op) {
+					_type = reflect.TypeFor[string]()
+				}
+
+				if expr := b.compare(handler, b.identifier(key), op, reflect.ValueOf(value), _type, args); expr != "" {
+					result = append(result, expr)
+				}
+			}
+		}
+	}
+
+	slog.Debug("Constructed WHERE clause", slog.Any("where", result))
+	return strings.Join(result, " AND ")
+}
+
+// Constructs the condition of an operation on a column expression, its operands are bound to the given type
+func (b *SQLBuilder[Model]) compare(handler func(string, ...string) string, column string, op string, value reflect.Value, _type reflect.Type, args *[]any) string {
+	if op == "_is_null" {
+		// Flag of the null check is passed to operation handler as a literal
+		return handler(column, strconv.FormatBool(value.Kind() == reflect.Bool && value.Bool()))
+	} else if (value.Kind() == reflect.Slice || value.Kind() == reflect.Array) && !scalar(value.Type(), _type) {
+		// Slice or array values are passed to operation handler as a list of parameters
+		items := []string{}
+		for i := range value.Len() {
+			items = append(items, b.parameter(bind(value.Index(i), _type), args))
+		}
+
+		return handler(column, items...)
+	} else if value.IsValid() {
+		// Other values are passed to operation handler as single parameter bound to the field type
+		return handler(column, b.parameter(bind(value, _type), args))
+	}
+
+	return ""
+}
+
+// Returns true if the operand has the field type, so array types like UUIDs are single values
+func scalar(operand reflect.Type, _type reflect.Type) bool {
+	for _type != nil && _type.Kind() == reflect.Pointer {
+		_type = _type.Elem()
+	}
+
+	return operand == _type
+}
+
+// Constructs the conditions of the JSON paths of a field, e.g. {"plan.tier":{"_eq":"pro"}}
+// The dialect handler receives the column, the JSON path parameter and the kind of the operands
+func (b *SQLBuilder[Model]) path(key string, paths map[string]any, args *[]any) []string {
+	result := []string{}
+	for path, item := range paths {
+		// Quote the path segments, so they may contain any character
+		segments := []string{}
+		for _, segment := range strings.Split(path, ".") {
+			quoted, _ := json.Marshal(segment)
+			segments = append(segments, string(quoted))
+		}
+
+		for op, value := range item.(map[string]any) {
+			handler, ok := b.operations[op]
+			if !ok {
+				continue
+			}
+
+			// Kind of the operands is detected by their JSON type
+			_value := reflect.ValueOf(value)
+			operand := _value
+			if (_value.Kind() == reflect.Slice || _value.Kind() == reflect.Array) && _value.Len() > 0 {
+				operand = _value.Index(0)
+			}
+			for operand.Kind() == reflect.Interface {
+				operand = operand.Elem()
+			}
+
+			kind := "string"
+			if !slices.Contains(patterns, op) && op != "_is_null" {
+				if operand.CanFloat() || operand.CanInt() || operand.CanUint() {
+					kind = "number"
+				} else if operand.Kind() == reflect.Bool {
+					kind = "boolean"
+				}
+			}
+
+			column := b.operations["_path"](b.identifier(key), b.parameter(reflect.ValueOf("$."+strings.Join(segments, ".")), args), kind)
+			if expr := b.compare(handler, column, op, _value, nil, args); expr != "" {
+				result = append(result, expr)
+			}
+		}
+	}
+
+	return result
+}
+
+// Constructs the condition of a relation filter
+// _some, _every and _none quantify the related records matching the filter, _count compares their number
+// Filters without a quantifier are handled as _some
+func (b *SQLBuilder[Model]) filter(relation Relation, where map[string]any, args *[]any, run func(string) []string) string {
+	quantified := false
+	result := []string{}
+	for _, quantifier := range []string{"_some", "_every", "_none", "_count"} {
+		item, ok := where[quantifier]
+		if !ok {
+			continue
+		}
+
+		quantified = true
+		expr := item.(map[string]any)
+		switch quantifier {
+		case "_some":
+			// At least one related record matches the filter
+			result = append(result, b.subquery(relation, expr, false, "_in", args, run))
+		case "_every":
+			// No related record fails the filter, records without related records match too
+			if cond := b.subquery(relation, expr, true, "_nin", args, run); cond != "" {
+				result = append(result, cond)
+			}
+		case "_none":
+			// No related record matches the filter
+			result = append(result, b.subquery(relation, expr, false, "_nin", args, run))
+		case "_count":
+			// Number of the related records compared with the operations
+			for op, value := range expr {
+				if handler, ok := b.operations[op]; ok {
+					// JSON numbers are decoded as floats, but counts are integers
+					// Non-integer bounds are rounded to the integers they include, other operands stay exact, so _eq never matches them
+					_value := reflect.ValueOf(value)
+					if _value.CanFloat() {
+						number := _value.Float()
+						switch op {
+						case "_lt", "_gte":
+							number = math.Ceil(number)
+						case "_gt", "_lte":
+							number = math.Floor(number)
+						}
+
+						if number == math.Trunc(number) {
+							_value = reflect.ValueOf(int64(number))
+						}
+					}
+
+					result = append(result, handler(b.count(relation), b.parameter(_value, args)))
+				}
+			}
+		}
+	}
+
+	if !quantified {
+		result = append(result, b.subquery(relation, where, false, "_in", args, run))
+	}
+
+	return strings.Join(result, " AND ")
+}
+
+// Constructs the condition comparing the source field with the sub-query of the related records matching the filter
+// When negated, the sub-query selects the related records which don't match the filter instead
+func (b *SQLBuilder[Model]) subquery(relation Relation, where map[string]any, negate bool, op string, args *[]any, run func(string) []string) string {
+	// Get the target SQLBuilder for the relation
+	builder := registry[relation.table]
+
+	// Sub-query arguments are collected separately when it's executed by the run function
+	args_ := args
+	if run != nil {
+		args_ = &[]any{}
+	}
+
+	// Construct the sub-query for the related table
+	// NULL destinations are skipped, since NOT IN never matches a list having NULL
+	conds := []string{fmt.Sprintf("%s IS NOT NULL", b.identifier(relation.dest))}
+
+	// Soft deleted related records are excluded outside the negation, so they never match
+	if scope := builder.Where(&map[string]any{}, args_, run); scope != "" {
+		conds = append(conds, scope)
+	}
+	filter := maps.Clone(where)
+	if builder.SoftDelete() {
+		filter = map[string]any{"_deleted": "with"}
+		maps.Copy(filter, where)
+	}
+
+	if expr := builder.Where(&filter, args_, run); expr != "" {
+		if negate {
+			expr = "NOT (" + expr + ")"
+		}
+		conds = append(conds, expr)
+	} else if negate {
+		// Every related record matches an empty filter
+		return ""
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s", b.identifier(relation.dest), builder.Table(), strings.Join(conds, " AND "))
+
+	// Many-to-many relations are resolved through the join table
+	if relation.through != "" {
+		query = fmt.Sprintf("SELECT %s FROM %s WHERE %s", b.identifier(relation.throughSrc), b.identifier(relation.through), b.operations["_in"](b.identifier(relation.throughDest), query))
+	}
+
+	if run == nil {
+		// If no run function is provided, sub-query is added to the main query
+		return b.operations[op](b.identifier(relation.src), query)
+	}
+
+	// If a run function is provided, sub-query is executed and its result is added to the main query
+	return b.operations[op](b.identifier(relation.src), run(query)...)
+}
+
+// Constructs the correlated sub-query counting the related records of a relation
+func (b *SQLBuilder[Model]) count(relation Relation) string {
+	// The counted table is aliased, so self-referential relations are not ambiguous
+	alias := b.identifier("_count")
+
+	// Get the target SQLBuilder for the relation
+	// Soft deleted related records are not counted, their scope has no arguments
+	builder := registry[relation.table]
+	scope := builder.Where(&map[string]any{}, &[]any{}, nil)
+
+	if relation.through != "" {
+		// Many-to-many relations are counted in the join table
+		query := fmt.Sprintf("SELECT COUNT(*) FROM %[1]s AS %[2]s WHERE %[2]s.%[3]s = %[4]s.%[5]s", b.identifier(relation.through), alias, b.identifier(relation.throughSrc), b.Table(), b.identifier(relation.src))
+		if scope != "" {
+			query += fmt.Sprintf(" AND %s.%s IN (SELECT %s FROM %s WHERE %s)", alias, b.identifier(relation.throughDest), b.identifier(relation.dest), builder.Table(), scope)
+		}
+		return "(" + query + ")"
+	}
+
+	// The unqualified scope resolves to the counted table
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %[1]s AS %[2]s WHERE %[2]s.%[3]s = %[4]s.%[5]s", builder.Table(), alias, b.identifier(relation.dest), b.Table(), b.identifier(relation.src))
+	if scope != "" {
+		query += " AND " + scope
+	}
+	return "(" + query + ")"
+}
+
+// Loads the records matching the filters with their included relations as a reflected slice of Model
+func (b *SQLBuilder[Model]) Load(ctx context.Context, where *map[string]any, include *[]string, exec func(string, ...any) (*sql.Rows, error)) (reflect.Value, error) {
+	// The get hooks of the model run like on its own resource, so the included records are not more readable
+	if b.beforeGet != nil {
+		order, limit, skip := []map[string]any{}, 0, 0
+		if err := b.beforeGet(ctx, where, &order, &limit, &skip); err != nil {
+			return reflect.Value{}, err
+		}
+	}
+
+	args := []any{}
+	query := fmt.Sprintf("SELECT %s FROM %s", b.Fields(""), b.Table())
+	if expr := b.Where(where, &args, nil); expr != "" {
+		query += fmt.Sprintf(" WHERE %s", expr)
+	}
+
+	slog.Info("Executing Load query", slog.String("query", query), slog.Any("args", args))
+
+	// Execute the query and scan the results
+	result, err := b.Scan(exec(query, args...))
+	if err != nil {
+		slog.Error("Error executing Load query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
+		return reflect.Value{}, err
+	}
+
+	// Load the nested included relations
+	if err := b.Include(ctx, &result, include, exec); err != nil {
+		return reflect.Value{}, err
+	}
+	if b.afterGet != nil {
+		if err := b.afterGet(ctx, &result); err != nil {
+			return reflect.Value{}, err
+		}
+	}
+
+	return reflect.ValueOf(result), nil
+}
+
+// Loads the included relations of the models, using a single query per relation
+// Nested relations are separated by dots, e.g. "documents.tags"
+func (b *SQLBuilder[Model]) Include(ctx context.Context, models *[]Model, include *[]string, exec func(string, ...any) (*sql.Rows, error)) error {
+	if models == nil || len(*models) <= 0 || include == nil || len(*include) <= 0 {
+		return nil
+	}
+
+	// Group the nested includes by their first relation
+	nested := map[string][]string{}
+	for _, item := range *include {
+		name, rest, _ := strings.Cut(item, ".")
+		if _, ok := nested[name]; !ok {
+			nested[name] = []string{}
+		}
+		if rest != "" {
+			nested[name] = append(nested[name], rest)
+		}
+	}
+
+	for name, include := range nested {
+		relation, ok := b.relations[name]
+		if !ok {
+			return fmt.Errorf("relation %s not found", name)
+		}
+
+		// Get the target SQLBuilder for the relation
+		builder, ok := registry[relation.table]
+		if !ok {
+			return fmt.Errorf("relation table %s not registered", relation.table)
+		}
+
+		// Collect the distinct source values of the models
+		src := fieldIndex(reflect.TypeFor[Model](), relation.src)
+		if src < 0 {
+			return fmt.Errorf("relation %s source field %s not found", name, relation.src)
+		}
+
+		values := []any{}
+		for _, model := range *models {
+			if value, ok := indirect(reflect.ValueOf(model).Field(src)); ok && !slices.Contains(values, value) {
+				values = append(values, value)
+			}
+		}
+		if len(values) <= 0 {
+			continue
+		}
+
+		// Many-to-many relations are resolved through the join table
+		links := [][2]string{}
+		if relation.through != "" {
+			var err error
+			if links, values, err = b.links(relation, values, exec); err != nil {
+				return err
+			} else if len(values) <= 0 {
+				continue
+			}
+		}
+
+		// Load the related records having one of the source values
+		where := map[string]any{relation.dest: map[string]any{"_in": values}}
+		items, err := builder.Load(ctx, &where, &include, exec)
+		if err != nil {
+			return err
+		}
+
+		// Group the related records by their destination value
+		groups := map[string][]reflect.Value{}
+		dest := fieldIndex(items.Type().Elem(), relation.dest)
+		if dest < 0 {
+			return fmt.Errorf("relation %s destination field %s not found", name, relation.dest)
+		}
+
+		for idx := range items.Len() {
+			if value, ok := indirect(items.Index(idx).Field(dest)); ok {
+				key := fmt.Sprint(value)
+				groups[key] = append(groups[key], items.Index(idx))
+			}
+		}
+
+		// Regroup the related records by their linked source value
+		if relation.through != "" {
+			linked := map[string][]reflect.Value{}
+			for _, link := range links {
+				linked[link[0]] = append(linked[link[0]], groups[link[1]]...)
+			}
+			groups = linked
+		}
+
+		// Assign the related records to the relation field of the models
+		for idx := range *models {
+			_value := reflect.ValueOf(&(*models)[idx]).Elem()
+			value, ok := indirect(_value.Field(src))
+			if !ok {
+				continue
+			}
+
+			_field := _value.Field(relation.idx)
+			group := groups[fmt.Sprint(value)]
+			if relation.one {
+				if len(group) > 0 {
+					_field.Set(convert(group[0], _field.Type()))
+				}
+			} else {
+				result := reflect.MakeSlice(_field.Type(), 0, len(group))
+				for _, item := range group {
+					result = reflect.Append(result, convert(item, _field.Type().Elem()))
+				}
+				_field.Set(result)
+			}
+		}
+	}
+
+	slog.Debug("Included relations loaded", slog.Any("include", *include))
+	return nil
+}
+
+// Queries the join table of a many-to-many relation for the source values
+// Returns the source and destination value pairs, with the distinct destination values
+func (b *SQLBuilder[Model]) links(relation Relation, values []any, exec func(string, ...any) (*sql.Rows, error)) ([][2]string, []any, error) {
+	args := []any{}
+	params := []string{}
+	for _, value := range values {
+		params = append(params, b.parameter(reflect.ValueOf(value), &args))
+	}
+	query := fmt.Sprintf("SELECT %s,%s FROM %s WHERE %s", b.identifier(relation.throughSrc), b.identifier(relation.throughDest), b.identifier(relation.through), b.operations["_in"](b.identifier(relation.throughSrc), params...))
+
+	slog.Info("Executing Links query", slog.String("query", query), slog.Any("args", args))
+
+	rows, err := exec(query, args...)
+	if err != nil {
+		slog.Error("Error executing Links query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	links := [][2]string{}
+	dests := []any{}
+	for rows.Next() {
+		var src, dest any
+		if err := rows.Scan(&src, &dest); err != nil {
+			return nil, nil, err
+		}
+
+		// Some drivers return text columns as bytes
+		if value, ok := dest.([]byte); ok {
+			dest = string(value)
+		}
+		if value, ok := src.([]byte); ok {
+			src = string(value)
+		}
+
+		links = append(links, [2]string{fmt.Sprint(src), fmt.Sprint(dest)})
+		if !slices.Contains(dests, dest) {
+			dests = append(dests, dest)
+		}
+	}
+
+	return links, dests, rows.Err()
+}
+
+// Constructs the INSERT query linking the related records to the record of the key through the join table
+// Already linked records are skipped
+func (b *SQLBuilder[Model]) Link(name string, key any, values []any, args *[]any) (string, error) {
+	return b.link(name, map[string]any{b.keys[0]: map[string]any{"_eq": key}}, values, args)
+}
+
+// Constructs the INSERT query linking the related records to the records matching the source filters through the join table
+// The join table rows pair the source and destination columns of the relation, soft deleted records are not linked
+func (b *SQLBuilder[Model]) link(name string, source map[string]any, values []any, args *[]any) (string, error) {
+	relation, ok := b.relations[name]
+	if !ok || relation.through == "" {
+		return "", fmt.Errorf("many-to-many relation %s not found", name)
+	}
+
+	// Get the target SQLBuilder for the relation
+	builder, ok := registry[relation.table]
+	if !ok {
+		return "", fmt.Errorf("relation table %s not registered", relation.table)
+	}
+
+	// Parameters are generated in their query order
+	sources := fmt.Sprintf("SELECT %s FROM %s", b.identifier(relation.src), b.Table())
+	if expr := b.Where(&source, args, nil); expr != "" {
+		sources += fmt.Sprintf(" WHERE %s", expr)
+	}
+	targets := fmt.Sprintf("SELECT %s FROM %s", b.identifier(relation.dest), builder.Table())
+	if expr := builder.Where(&map[string]any{relation.dest: map[string]any{"_in": values}}, args, nil); expr != "" {
+		targets += fmt.Sprintf(" WHERE %s", expr)
+	}
+
+	src, dest := "s."+b.identifier(relation.src), "t."+b.identifier(relation.dest)
+	exists := fmt.Sprintf(
+		"SELECT 1 FROM %[1]s WHERE %[1]s.%[2]s = %[4]s AND %[1]s.%[3]s = %[5]s",
+		b.identifier(relation.through), b.identifier(relation.throughSrc), b.identifier(relation.throughDest), src, dest,
+	)
+	query := fmt.Sprintf(
+		"INSERT INTO %s (%s,%s) SELECT %s,%s FROM (%s) s, (%s) t WHERE NOT EXISTS (%s)",
+		b.identifier(relation.through), b.identifier(relation.throughSrc), b.identifier(relation.throughDest), src, dest, sources, targets, exists,
+	)
+
+	slog.Debug("Constructed Link query", slog.String("query", query))
+	return query, nil
+}
+
+// Constructs the DELETE query unlinking the related records from the record of the key through the join table
+func (b *SQLBuilder[Model]) Unlink(name string, key any, values []any, args *[]any) (string, error) {
+	relation, ok := b.relations[name]
+	if !ok || relation.through == "" {
+		return "", fmt.Errorf("many-to-many relation %s not found", name)
+	}
+
+	// Parameters are generated in their query order
+	source := map[string]any{b.keys[0]: map[string]any{"_eq": key}}
+	sub := fmt.Sprintf("SELECT %s FROM %s WHERE %s", b.identifier(relation.src), b.Table(), b.Where(&source, args, nil))
+	params := []string{}
+	for _, value := range values {
+		params = append(params, b.parameter(reflect.ValueOf(value), args))
+	}
+
+	query := fmt.Sprintf(
+		"DELETE FROM %s WHERE %s AND %s",
+		b.identifier(relation.through), b.operations["_in"](b.identifier(relation.throughSrc), sub), b.operations["_in"](b.identifier(relation.throughDest), params...),
+	)
+
+	slog.Debug("Constructed Unlink query", slog.String("query", query))
+	return query, nil
+}
+
+// Writes the models with their nested relations inside the transaction
+// To-one relations owning the source field are written first, to propagate their keys into the models
+// Other relations are written afterwards, to propagate the model keys into their destination field
+func (b *SQLBuilder[Model]) Save(ctx context.Context, tx *sql.Tx, models *[]Model, update bool) ([]Model, error) {
+	return b.save(ctx, tx, models, update, func(items []Model) ([]Model, []Model, error) {
+		// Updated models which are not found are skipped, updated models which are found with another version are conflicts
+		if update {
+			sources, result, conflicts := []Model{}, []Model{}, []int{}
+			for idx, item := range items {
+				rows, err := b.writer.update(ctx, tx, &[]Model{item})
+				if err != nil {
+					return nil, nil, err
+				}
+
+				if len(rows) > 0 {
+					sources = append(sources, item)
+					result = append(result, rows[0])
+				} else if _, ok := b.Version(item); ok {
+					found, err := b.exists(ctx, tx, item, nil)
+					if err != nil {
+						return nil, nil, err
+					} else if found {
+						conflicts = append(conflicts, idx)
+					}
+				}
+			}
+
+			if len(conflicts) > 0 {
+				return nil, nil, &ConflictError{Table: b.table, Indexes: conflicts}
+			}
+
+			return sources, result, nil
+		}
+
+		rows, err := b.batch(items, func(batch *[]Model) ([]Model, error) {
+			return b.writer.insert(ctx, tx, batch)
+		})
+		if err != nil {
+			return nil, nil, err
+		} else if len(rows) != len(items) {
+			return nil, nil, fmt.Errorf("inserted %d of %d records into %s", len(rows), len(items), b.table)
+		}
+
+		return items, rows, nil
+	})
+}
+
+// Upserts the models with their nested relations inside the transaction
+// Nested relations are written like updates, the related records having a primary key are updated and the others are inserted
+// Models skipped by the stale or soft deleted records they conflict with are conflicts
+func (b *SQLBuilder[Model]) Upsert(ctx context.Context, tx *sql.Tx, models *[]Model, conflict *Conflict) ([]Model, error) {
+	fields, err := b.targets(conflict)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.save(ctx, tx, models, true, func(items []Model) ([]Model, []Model, error) {
+		rows, err := b.batch(items, func(batch *[]Model) ([]Model, error) {
+			return b.writer.upsert(ctx, tx, batch, conflict)
+		})
+		if err != nil {
+			return nil, nil, err
+		} else if len(rows) < len(items) {
+			conflicts := []int{}
+			for idx, item := range items {
+				if !slices.ContainsFunc(rows, func(row Model) bool { return b.same(item, row, fields) }) {
+					conflicts = append(conflicts, idx)
+				}
+			}
+			return nil, nil, &ConflictError{Table: b.table, Indexes: conflicts}
+		} else if len(rows) != len(items) {
+			return nil, nil, fmt.Errorf("upserted %d of %d records into %s", len(rows), len(items), b.table)
+		}
+
+		return items, rows, nil
+	})
+}
+
+// Writes the models in a single statement, or one at a time when they have relations
+// The written records are paired with their models by position, which the returned rows of a multi-row statement don't guarantee
+func (b *SQLBuilder[Model]) batch(items []Model, write func(*[]Model) ([]Model, error)) ([]Model, error) {
+	if len(b.relations) <= 0 {
+		return write(&items)
+	}
+
+	result := []Model{}
+	for idx := range items {
+		// The model is written in place, so the filled keys are kept
+		item := items[idx : idx+1 : idx+1]
+		rows, err := write(&item)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, rows...)
+	}
+
+	return result, nil
+}
+
+// Writes the models with the write function between their relations, it returns the written models with their written records
+func (b *SQLBuilder[Model]) save(ctx context.Context, tx *sql.Tx, models *[]Model, update bool, write func([]Model) ([]Model, []Model, error)) ([]Model, error) {
+	if models == nil || len(*models) <= 0 {
+		return []Model{}, nil
+	}
+
+	items := slices.Clone(*models)
+	names := slices.Sorted(maps.Keys(b.relations))
+
+	// Write the relations owning the source field of the models
+	for _, name := range names {
+		if relation := b.relations[name]; b.owns(relation) {
+			if err := b.relate(ctx, tx, items, items, name, update); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Write the models
+	sources, result, err := write(items)
+	if err != nil {
+		return nil, err
+	}
+
+	// Write the other relations of the models
+	for _, name := range names {
+		if relation := b.relations[name]; b.owns(relation) {
+			// Keep the already written relations
+			for idx := range result {
+				reflect.ValueOf(&result[idx]).Elem().Field(relation.idx).Set(reflect.ValueOf(sources[idx]).Field(relation.idx))
+			}
+		} else if err := b.relate(ctx, tx, sources, result, name, update); err != nil {
+			return nil, err
+		}
+	}
+
+	slog.Debug("Models saved", slog.String("table", b.table), slog.Bool("update", update), slog.Any("result", result))
+	return result, nil
+}
+
+// Returns true if the record of the reflected Model is found by its primary keys and the conditions
+func (b *SQLBuilder[Model]) Exists(ctx context.Context, tx *sql.Tx, model reflect.Value, where map[string]any) (bool, error) {
+	return b.exists(ctx, tx, model.Interface().(Model), where)
+}
+
+// Returns true if the record of the model is found by its primary keys and the conditions
+func (b *SQLBuilder[Model]) exists(ctx context.Context, tx *sql.Tx, model Model, conditions map[string]any) (bool, error) {
+	args := []any{}
+	where := b.Key(model)
+	maps.Copy(where, conditions)
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s", b.Table(), b.Where(&where, &args, nil))
+
+	slog.Info("Executing Exists query", slog.String("query", query), slog.Any("args", args))
+
+	count := 0
+	if err := tx.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+		slog.Error("Error executing Exists query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// Writes the reflected slice of Model with their nested relations inside the transaction
+// On update, records without a primary key are inserted instead
+func (b *SQLBuilder[Model]) Write(ctx context.Context, tx *sql.Tx, models reflect.Value, update bool) (reflect.Value, error) {
+	items := models.Interface().([]Model)
+	if !update {
+		result, err := b.Save(ctx, tx, &items, false)
+		return reflect.ValueOf(result), err
+	}
+
+	// Split the records by the presence of their primary key
+	keyed, unkeyed := []Model{}, []Model{}
+	for _, item := range items {
+		if b.keyed(item) {
+			keyed = append(keyed, item)
+		} else {
+			unkeyed = append(unkeyed, item)
+		}
+	}
+
+	updated, err := b.Save(ctx, tx, &keyed, true)
+	if err != nil {
+		return reflect.Value{}, err
+	} else if len(updated) != len(keyed) {
+		return reflect.Value{}, &RelationError{Table: b.table}
+	}
+
+	inserted, err := b.Save(ctx, tx, &unkeyed, false)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	// Merge the written records in their original order
+	result := []Model{}
+	for _, item := range items {
+		if b.keyed(item) {
+			result, updated = append(result, updated[0]), updated[1:]
+		} else {
+			result, inserted = append(result, inserted[0]), inserted[1:]
+		}
+	}
+
+	return reflect.ValueOf(result), nil
+}
+
+// Writes the related records of the sources and assigns them to the targets
+// Keys are propagated from the related records into owning targets, or from the targets into the related records otherwise
+func (b *SQLBuilder[Model]) relate(ctx context.Context, tx *sql.Tx, sources []Model, targets []Model, name string, update bool) error {
+	relation := b.relations[name]
+
+	// Get the target SQLBuilder for the relation
+	builder, ok := registry[relation.table]
+	if !ok {
+		return fmt.Errorf("relation table %s not registered", relation.table)
+	}
+
+	// Get the related model deep inside array or slice or pointer types
+	_type := b.related(relation)
+	src := fieldIndex(reflect.TypeFor[Model](), relation.src)
+	if src < 0 {
+		return fmt.Errorf("relation %s source field %s not found", name, relation.src)
+	}
+	dest := fieldIndex(_type, relation.dest)
+	if dest < 0 {
+		return fmt.Errorf("relation %s destination field %s not found", name, relation.dest)
+	}
+
+	// Collect the related records of the sources
+	owner := b.owns(relation)
+	values := reflect.MakeSlice(reflect.SliceOf(_type), 0, len(sources))
+	counts := make([]int, len(sources))
+	for idx := range sources {
+		items := []reflect.Value{}
+		if _field := reflect.ValueOf(sources[idx]).Field(relation.idx); relation.one {
+			items = append(items, _field)
+		} else {
+			for i := range _field.Len() {
+				items = append(items, _field.Index(i))
+			}
+		}
+
+		for _, item := range items {
+			for item.Kind() == reflect.Pointer && !item.IsNil() {
+				item = item.Elem()
+			}
+			if item.Kind() == reflect.Pointer || item.IsZero() {
+				continue
+			}
+
+			// Propagate the source value into the destination field of the related record
+			value := reflect.New(_type).Elem()
+			value.Set(item)
+			if !owner && relation.through == "" {
+				assign(value.Field(dest), reflect.ValueOf(targets[idx]).Field(src))
+			}
+
+			// Related records having a primary key are updated, so they must already be related to the target
+			if update && builder.Keyed(value) {
+				if found, err := b.linked(ctx, tx, relation, builder, targets[idx], value, src, dest); err != nil {
+					return err
+				} else if !found {
+					return &RelationError{Table: relation.table}
+				}
+			}
+
+			values = reflect.Append(values, value)
+			counts[idx]++
+		}
+	}
+	if values.Len() <= 0 {
+		return nil
+	}
+
+	// Write the related records
+	written, err := builder.Write(ctx, tx, values, update)
+	if err != nil {
+		return err
+	}
+
+	// Assign the written records to the relation field of the targets
+	offset := 0
+	for idx := range targets {
+		if counts[idx] <= 0 {
+			continue
+		}
+
+		_value := reflect.ValueOf(&targets[idx]).Elem()
+		_field := _value.Field(relation.idx)
+		if relation.one {
+			_field.Set(convert(written.Index(offset), _field.Type()))
+
+			// Propagate the destination value into the source field of the owning target
+			if owner {
+				assign(_value.Field(src), written.Index(offset).Field(dest))
+			}
+		} else {
+			result := reflect.MakeSlice(_field.Type(), 0, counts[idx])
+			for i := range counts[idx] {
+				result = reflect.Append(result, convert(written.Index(offset+i), _field.Type().Elem()))
+			}
+			_field.Set(result)
+		}
+
+		// Link the written records to the target through the join table
+		if relation.through != "" {
+			key, _ := indirect(_value.Field(src))
+			values := []any{}
+			for i := range counts[idx] {
+				if value, ok := indirect(written.Index(offset + i).Field(dest)); ok {
+					values = append(values, value)
+				}
+			}
+
+			args := []any{}
+			query, err := b.link(name, map[string]any{relation.src: map[string]any{"_eq": key}}, values, &args)
+			if err != nil {
+				return err
+			}
+
+			slog.Info("Executing Link query", slog.String("query", query), slog.Any("args", args))
+
+			if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+				slog.Error("Error executing Link query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
+				return err
+			}
+		}
+
+		offset += counts[idx]
+	}
+
+	slog.Debug("Relation saved", slog.String("relation", name), slog.Int("count", values.Len()))
+	return nil
+}
+
+// Returns true if the related record is already related to the target, so it can be updated through the target
+func (b *SQLBuilder[Model]) linked(ctx context.Context, tx *sql.Tx, relation Relation, builder SQLBuilderInterface, target Model, value reflect.Value, src int, dest int) (bool, error) {
+	key, ok := indirect(reflect.ValueOf(target).Field(src))
+	related, _ok := indirect(value.Field(dest))
+	if !ok || !_ok {
+		return false, nil
+	}
+
+	switch {
+	case b.owns(relation):
+		// The target record holds the key of the related record
+		if !b.keyed(target) {
+			return false, nil
+		}
+
+		return b.exists(ctx, tx, target, map[string]any{relation.src: map[string]any{"_eq": related}})
+	case relation.through != "":
+		// The join table links the target record to the related record
+		args := []any{}
+		query := fmt.Sprintf(
+			"SELECT COUNT(*) FROM %s WHERE %s AND %s",
+			b.identifier(relation.through),
+			b.operations["_eq"](b.identifier(relation.throughSrc), b.parameter(reflect.ValueOf(key), &args)),
+			b.operations["_eq"](b.identifier(relation.throughDest), b.parameter(reflect.ValueOf(related), &args)),
+		)
+
+		slog.Info("Executing Linked query", slog.String("query", query), slog.Any("args", args))
+
+		count := 0
+		if err := tx.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+			slog.Error("Error executing Linked query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
+			return false, err
+		}
+
+		return count > 0, nil
+	default:
+		// The related record holds the key of the target record
+		return builder.Exists(ctx, tx, value, map[string]any{relation.dest: map[string]any{"_eq": key}})
+	}
+}
+
+// Returns true if the model owns the to-one relation, which means the source field holds the related key
+func (b *SQLBuilder[Model]) owns(relation Relation) bool {
+	return relation.one && !slices.Contains(b.keys, relation.src)
+}
+
+// Returns true if all the primary keys of the reflected Model are set
+func (b *SQLBuilder[Model]) Keyed(model reflect.Value) bool {
+	return b.keyed(model.Interface().(Model))
+}
+
+// Returns true if all the primary keys of the model are set
+func (b *SQLBuilder[Model]) keyed(model Model) bool {
+	for _, field := range b.fields {
+		if slices.Contains(b.keys, field.name) {
+			if value, ok := indirect(reflect.ValueOf(model).Field(field.idx)); !ok || reflect.ValueOf(value).IsZero() {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// Returns the related model type deep inside array or slice or pointer types
+func (b *SQLBuilder[Model]) related(relation Relation) reflect.Type {
+	_type := reflect.TypeFor[Model]().Field(relation.idx).Type
+	for _type.Kind() == reflect.Array || _type.Kind() == reflect.Slice || _type.Kind() == reflect.Pointer {
+		_type = _type.Elem()
+	}
+
+	return _type
+}
+
+// Returns the index of the struct field mapped to the column name, or -1 if not found
+func fieldIndex(_type reflect.Type, name string) int {
+	for idx := range _type.NumField() {
+		if strings.Split(_type.Field(idx).Tag.Get("db"), ",")[0] == name {
+			return idx
+		}
+	}
+
+	return -1
+}
+
+// Returns the value deep inside pointer types, or false if it's nil
+func indirect(value reflect.Value) (any, bool) {
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return nil, false
+		}
+		value = value.Elem()
+	}
+
+	return value.Interface(), true
+}
+
+// Converts the value to the target type by taking its address when a pointer is expected
+func convert(value reflect.Value, _type reflect.Type) reflect.Value {
+	if _type.Kind() == reflect.Pointer && value.Kind() != reflect.Pointer {
+		result := reflect.New(value.Type())
+		result.Elem().Set(value)
+		return result
+	}
+
+	return value
+}
+
+// Converts the operand to the field type, so its parameter is compared with the proper type
+// Operands which don't fit the field type are kept as is, e.g. LIKE patterns of numeric fields
+func bind(value reflect.Value, _type reflect.Type) reflect.Value {
+	for value.Kind() == reflect.Interface || value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return value
+		}
+		value = value.Elem()
+	}
+	if _type == nil {
+		return value
+	}
+	for _type.Kind() == reflect.Pointer {
+		_type = _type.Elem()
+	}
+
+	// Null wrappers of database/sql are bound to the type of their value
+	if _type.Kind() == reflect.Struct && _type.PkgPath() == "database/sql" && strings.HasPrefix(_type.Name(), "Null") {
+		_type = _type.Field(0).Type
+	}
+
+	switch _type.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if value.CanFloat() && value.Float() == math.Trunc(value.Float()) {
+			return reflect.ValueOf(int64(value.Float()))
+		} else if value.Kind() == reflect.String {
+			if result, err := strconv.ParseInt(value.String(), 10, 64); err == nil {
+				return reflect.ValueOf(result)
+			}
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if value.CanFloat() && value.Float() >= 0 && value.Float() == math.Trunc(value.Float()) {
+			return reflect.ValueOf(uint64(value.Float()))
+		} else if value.Kind() == reflect.String {
+			if result, err := strconv.ParseUint(value.String(), 10, 64); err == nil {
+				return reflect.ValueOf(result)
+			}
+		}
+	case reflect.Float32, reflect.Float64:
+		if value.CanInt() {
+			return reflect.ValueOf(float64(value.Int()))
+		} else if value.Kind() == reflect.String {
+			if result, err := strconv.ParseFloat(value.String(), 64); err == nil {
+				return reflect.ValueOf(result)
+			}
+		}
+	case reflect.Bool:
+		if value.Kind() == reflect.String {
+			if result, err := strconv.ParseBool(value.String()); err == nil {
+				return reflect.ValueOf(result)
+			}
+		}
+	case reflect.String:
+		if value.CanInt() || value.CanUint() || value.CanFloat() || value.Kind() == reflect.Bool {
+			return reflect.ValueOf(fmt.Sprint(value.Interface()))
+		}
+	case reflect.Struct, reflect.Array:
+		// Other scalars like time, UUID and decimal types are decoded from their JSON value
+		if data, err := json.Marshal(value.Interface()); err == nil {
+			result := reflect.New(_type)
+			if err := json.Unmarshal(data, result.Interface()); err == nil {
+				return result.Elem()
+			}
+		}
+	}
+
+	return value
+}
+
+// Marshals a field into a JSON column and unmarshals it back
+// The value is the field when writing and the address of the field when scanning
+type jsonValue struct {
+	value reflect.Value
+}
+
+func (j jsonValue) Value() (driver.Value, error) {
+	switch j.value.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface:
+		if j.value.IsNil() {
+			return nil, nil
+		}
+	}
+
+	data, err := json.Marshal(j.value.Interface())
+	return string(data), err
+}
+
+func (j jsonValue) Scan(src any) error {
+	switch src := src.(type) {
+	case nil:
+		j.value.Elem().SetZero()
+		return nil
+	case []byte:
+		return json.Unmarshal(src, j.value.Interface())
+	case string:
+		return json.Unmarshal([]byte(src), j.value.Interface())
+	}
+
+	return fmt.Errorf("unsupported JSON column value %T", src)
+}
+
+// Returns the parameter value of the field in the model, JSON and array fields are encoded
+func (b *SQLBuilder[Model]) value(field Field, model reflect.Value) reflect.Value {
+	if field.array {
+		return b.array(model.Field(field.idx))
+	} else if field.json {
+		return reflect.ValueOf(jsonValue{model.Field(field.idx)})
+	}
+
+	return model.Field(field.idx)
+}
+
+// Returns the encoder of an array field, the native dialect arrays or JSON arrays otherwise
+// The value is the field when writing and the address of the field when scanning
+func (b *SQLBuilder[Model]) array(value reflect.Value) reflect.Value {
+	if b.arrays != nil {
+		return reflect.ValueOf(b.arrays(value))
+	}
+
+	return reflect.ValueOf(jsonValue{value})
+}
+
+// Checks if the type is a slice of primitive values, byte slices are kept as binary values
+func isArray(_type reflect.Type) bool {
+	if _type.Kind() != reflect.Slice {
+		return false
+	}
+
+	// Slices storing their own column value are scalars, e.g. pq.StringArray
+	if _type.Implements(reflect.TypeFor[driver.Valuer]()) || reflect.PointerTo(_type).Implements(reflect.TypeFor[sql.Scanner]()) {
+		return false
+	}
+
+	switch _type.Elem().Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64, reflect.String:
+		return true
+	}
+
+	return false
+}
+
+// Converts the items into a list of query values
+func values[T any](items []T) []any {
+	result := []any{}
+	for _, item := range items {
+		result = append(result, item)
+	}
+
+	return result
+}
+
+// Assigns the value to the target, allocating or dereferencing pointers when needed
+func assign(target reflect.Value, value reflect.Value) {
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			target.SetZero()
+			return
+		}
+		value = value.Elem()
+	}
+
+	for target.Kind() == reflect.Pointer {
+		if target.IsNil() {
+			target.Set(reflect.New(target.Type().Elem()))
+		}
+		target = target.Elem()
+	}
+
+	target.Set(value.Convert(target.Type()))
+}
+
+// Constructs the selected expressions and the GROUP BY clause of an aggregate query
+// Metrics are named "count" for the number of records or "<function>:<field>", e.g. "sum:age"
+func (b *SQLBuilder[Model]) Aggregate(group *[]string, metrics *[]string) (string, string) {
+	groups := []string{}
+	if group != nil {
+		for _, name := range *group {
+			groups = append(groups, b.identifier(name))
+		}
+	}
+
+	result := slices.Clone(groups)
+	if metrics != nil {
+		for _, metric := range *metrics {
+			if expr, _, ok := b.metric(metric); ok {
+				result = append(result, expr)
+			}
+		}
+	}
+
+	slog.Debug("Constructed aggregate clauses", slog.Any("fields", result), slog.Any("groups", groups))
+	return strings.Join(result, ","), strings.Join(groups, ",")
+}
+
+// Returns the expression and the value type of a metric
+// Counts are integers, sums and averages are floats, minimums and maximums have the field type
+func (b *SQLBuilder[Model]) metric(metric string) (string, reflect.Type, bool) {
+	function, name, _ := strings.Cut(metric, ":")
+	handler, ok := b.operations["_metric_"+function]
+	if !ok || (name == "" && function != "count") || (name != "" && b.types[name] == nil) {
+		return "", nil, false
+	}
+
+	switch function {
+	case "count":
+		if name == "" {
+			return handler("*"), reflect.TypeFor[int64](), true
+		}
+		return handler(b.identifier(name)), reflect.TypeFor[int64](), true
+	case "sum", "avg":
+		return handler(b.identifier(name)), reflect.TypeFor[float64](), true
+	default:
+		return handler(b.identifier(name)), b.types[name], true
+	}
+}
+
+// Constructs the bucket expression of a time series, which is the field time truncated to the interval as text
+// The dialect gets the interval, the quoted timezone name, its offset in minutes and whether the offset is fixed, so it can use either one
+func (b *SQLBuilder[Model]) Bucket(field string, interval string, location *time.Location) (string, error) {
+	// Timezones having a single offset, like UTC and the Etc/GMT zones, are shifted by it, the others are converted by the dialect
+	// The offsets are compared monthly over two centuries, so the zones whose rules changed in any year are converted too
+	_, offset := time.Date(1900, time.January, 1, 0, 0, 0, 0, location).Zone()
+	fixed := true
+	for month := 1; month <= 200*12 && fixed; month++ {
+		_, current := time.Date(1900, time.Month(month), 1, 0, 0, 0, 0, location).Zone()
+		fixed = current == offset
+	}
+	name := "'" + strings.ReplaceAll(location.String(), "'", "''") + "'"
+
+	// Dialects which can't convert the times return no expression
+	result := b.operations["_bucket"](b.identifier(field), interval, name, strconv.Itoa(offset/60), strconv.FormatBool(fixed))
+	if result == "" {
+		return "", &TimezoneError{Name: location.String()}
+	}
+
+	return result, nil
+}
+
+// Scans the rows returned by a query into a slice of Model
+func (b *SQLBuilder[Model]) Scan(rows *sql.Rows, err error) ([]Model, error) {
+	if err != nil {
+		slog.Error("Error during query execution", slog.Any("error", err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Iterate over the rows and scan each one into a Model instance
+	result := []Model{}
+	for rows.Next() {
+		var model Model
+
+		// Scan the row into the addresses of the fields
+		if err := rows.Scan(b.addresses(&model)...); err != nil {
+			return nil, err
+		}
+
+		result = append(result, model)
+	}
+
+	if err = rows.Err(); err != nil {
+		slog.Error("Error during row iteration", slog.Any("error", err))
+		return nil, err
+	}
+
+	slog.Debug("Scan completed", slog.Any("result", result))
+	return result, nil
+}
+
+// Scans the rows having a trailing ordinal column into Model instances, sorted by their ordinals
+func (b *SQLBuilder[Model]) ScanOrdered(rows *sql.Rows, err error) ([]Model, error) {
+	if err != nil {
+		slog.Error("Error during query execution", slog.Any("error", err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	models, ordinals := []Model{}, []int{}
+	for rows.Next() {
+		var model Model
+		var ordinal int
+
+		// Scan the row into the addresses of the fields and the ordinal
+		if err := rows.Scan(append(b.addresses(&model), &ordinal)...); err != nil {
+			return nil, err
+		}
+
+		models = append(models, model)
+		ordinals = append(ordinals, ordinal)
+	}
+
+	if err = rows.Err(); err != nil {
+		slog.Error("Error during row iteration", slog.Any("error", err))
+		return nil, err
+	}
+
+	indexes := []int{}
+	for idx := range models {
+		indexes = append(indexes, idx)
+	}
+	slices.SortFunc(indexes, func(left int, right int) int { return ordinals[left] - ordinals[right] })
+
+	result := []Model{}
+	for _, idx := range indexes {
+		result = append(result, models[idx])
+	}
+
+	slog.Debug("Scan completed", slog.Any("result", result))
+	return result, nil
+}
+
+// Returns the addresses to scan the fields of the model into
+func (b *SQLBuilder[Model]) addresses(model *Model) []any {
+	_value := reflect.ValueOf(model).Elem()
+
+	result := []any{}
+	for _, field := range b.fields {
+		if field.array {
+			result = append(result, b.array(_value.Field(field.idx).Addr()).Interface())
+		} else if field.json {
+			result = append(result, jsonValue{_value.Field(field.idx).Addr()})
+		} else {
+			result = append(result, _value.Field(field.idx).Addr().Interface())
+		}
+	}
+
+	return result
+}
+
+// Scans the rows returned by an aggregate query into maps of the group fields and the metrics
+func (b *SQLBuilder[Model]) Aggregates(rows *sql.Rows, err error, group *[]string, metrics *[]string) ([]map[string]any, error) {
+	if err != nil {
+		slog.Error("Error during query execution", slog.Any("error", err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Names and value types of the selected expressions
+	names, types := []string{}, []reflect.Type{}
+	if group != nil {
+		for _, name := range *group {
+			names, types = append(names, name), append(types, b.types[name])
+		}
+	}
+	if metrics != nil {
+		for _, metric := range *metrics {
+			if _, _type, ok := b.metric(metric); ok {
+				names, types = append(names, metric), append(types, _type)
+			}
+		}
+	}
+
+	// Iterate over the rows and scan each one into a map
+	result := []map[string]any{}
+	for rows.Next() {
+		values := make([]any, len(names))
+		_addrs := []any{}
+		for idx := range values {
+			_addrs = append(_addrs, &values[idx])
+		}
+
+		// Scan the row into the addresses
+		if err := rows.Scan(_addrs...); err != nil {
+			return nil, err
+		}
+
+		// Drivers return some values as texts, e.g. decimals, so they are bound to the value types
+		item := map[string]any{}
+		for idx, name := range names {
+			if value, ok := values[idx].([]byte); ok {
+				values[idx] = string(value)
+			}
+			if values[idx] != nil {
+				values[idx] = bind(reflect.ValueOf(values[idx]), types[idx]).Interface()
+			}
+			item[name] = values[idx]
+		}
+
+		result = append(result, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		slog.Error("Error during row iteration", slog.Any("error", err))
+		return nil, err
+	}
+
+	slog.Debug("Aggregate scan completed", slog.Any("result", result))
+	return result, nil
+}
+
+// Converts the rows of a facet query, grouped by the field and counted, into facets
+func facets(field string, items []map[string]any) []Facet {
+	result := []Facet{}
+	for _, item := range items {
+		count, _ := item["count"].(int64)
+		result = append(result, Facet{Value: item[field], Count: count})
+	}
+
+	return result
+}
+
+// Scans the rows returned by a time series query into buckets
+// The buckets missing between the first and the last one are filled with zero values
+func (b *SQLBuilder[Model]) Series(rows *sql.Rows, err error, interval string, location *time.Location) ([]Bucket, error) {
+	if err != nil {
+		slog.Error("Error during query execution", slog.Any("error", err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Iterate over the rows and scan each one into a bucket
+	buckets := []Bucket{}
+	for rows.Next() {
+		var bucket sql.NullString
+		var value any
+		if err := rows.Scan(&bucket, &value); err != nil {
+			return nil, err
+		}
+
+		// Records without time have no bucket
+		if !bucket.Valid {
+			continue
+		}
+
+		// The bucket is the wall time of the timezone
+		_time, err := time.ParseInLocation(time.DateTime, bucket.String, location)
+		if err != nil {
+			return nil, err
+		}
+
+		// Drivers return some values as texts, e.g. decimals, so they are bound to floats
+		if text, ok := value.([]byte); ok {
+			value = string(text)
+		}
+		result, _ := bind(reflect.ValueOf(value), reflect.TypeFor[float64]()).Interface().(float64)
+
+		buckets = append(buckets, Bucket{Time: _time, Value: result})
+	}
+
+	if err = rows.Err(); err != nil {
+		slog.Error("Error during row iteration", slog.Any("error", err))
+		return nil, err
+	}
+
+	// Fill the missing buckets between the first and the last one
+	result := []Bucket{}
+	for idx, bucket := range buckets {
+		if idx > 0 {
+			for _time := next(buckets[idx-1].Time, interval); _time.Before(bucket.Time); _time = next(_time, interval) {
+				result = append(result, Bucket{Time: _time})
+			}
+		}
+		result = append(result, bucket)
+	}
+
+	slog.Debug("Series scan completed", slog.Any("result", result))
+	return result, nil
+}
+
+// Returns the start of the time bucket following the given one
+func next(_time time.Time, interval string) time.Time {
+	switch interval {
+	case "hour":
+		return _time.Add(time.Hour)
+	case "week":
+		return _time.AddDate(0, 0, 7)
+	case "month":
+		return _time.AddDate(0, 1, 0)
+	}
+
+	return _time.AddDate(0, 0, 1)
 }
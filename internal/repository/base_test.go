@@ -1,8 +1,15 @@
 package repository
 
 import (
+	"bytes"
 	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -35,14 +42,14 @@ func UnitTests(ctx context.Context, t *testing.T, repo Repository[User]) {
 
 	t.Run("GetByID", func(t *testing.T) {
 		where := map[string]any{"id": map[string]any{"_eq": "1"}}
-		result, err := repo.Get(ctx, &where, nil, nil, nil)
+		result, err := repo.Get(ctx, &where, nil, nil, nil, nil, nil)
 		assert.NoError(t, err)
 		assert.Len(t, result, 1)
 	})
 
 	t.Run("GetWithFilters", func(t *testing.T) {
 		where := map[string]any{"age": map[string]any{"_gt": "25"}}
-		result, err := repo.Get(ctx, &where, nil, nil, nil)
+		result, err := repo.Get(ctx, &where, nil, nil, nil, nil, nil)
 		assert.NoError(t, err)
 		assert.NotEmpty(t, result)
 	})
@@ -50,11 +57,71 @@ func UnitTests(ctx context.Context, t *testing.T, repo Repository[User]) {
 	t.Run("GetPagination", func(t *testing.T) {
 		limit := 5
 		skip := 0
-		result, err := repo.Get(ctx, nil, nil, &limit, &skip)
+		result, err := repo.Get(ctx, nil, nil, &limit, &skip, nil, nil)
 		assert.NoError(t, err)
 		assert.LessOrEqual(t, len(result), limit)
 	})
 
+	t.Run("GetWithOrder", func(t *testing.T) {
+		order := []map[string]any{{"age": "DESC_NULLS_LAST"}}
+		result, err := repo.Get(ctx, nil, &order, nil, nil, nil, nil)
+		assert.NoError(t, err)
+		assert.Len(t, result, 3)
+
+		for i := 1; i < len(result); i++ {
+			assert.GreaterOrEqual(t, result[i-1].Age, result[i].Age)
+		}
+	})
+
+	t.Run("Count", func(t *testing.T) {
+		where := map[string]any{"age": map[string]any{"_gt": "30"}}
+		result, err := repo.Count(ctx, &where)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, result)
+	})
+
+	t.Run("GetWithOperators", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			where map[string]any
+			count int
+		}{
+			{"_eq", map[string]any{"age": map[string]any{"_eq": 35}}, 1},
+			{"_neq", map[string]any{"age": map[string]any{"_neq": 35}}, 2},
+			{"_gt", map[string]any{"age": map[string]any{"_gt": 35}}, 1},
+			{"_gte", map[string]any{"age": map[string]any{"_gte": 35}}, 2},
+			{"_lt", map[string]any{"age": map[string]any{"_lt": 35}}, 1},
+			{"_lte", map[string]any{"age": map[string]any{"_lte": 35}}, 2},
+			{"_like", map[string]any{"name": map[string]any{"_like": "%li%"}}, 2},
+			{"_nlike", map[string]any{"name": map[string]any{"_nlike": "%li%"}}, 1},
+			{"_ilike", map[string]any{"name": map[string]any{"_ilike": "ALICE"}}, 1},
+			{"_nilike", map[string]any{"name": map[string]any{"_nilike": "ALICE"}}, 2},
+			{"_in", map[string]any{"age": map[string]any{"_in": []any{25, 45}}}, 2},
+			{"_nin", map[string]any{"age": map[string]any{"_nin": []any{25, 45}}}, 1},
+			{"_is_null", map[string]any{"name": map[string]any{"_is_null": true}}, 0},
+			{"_is_not_null", map[string]any{"name": map[string]any{"_is_null": false}}, 3},
+			{"_between", map[string]any{"age": map[string]any{"_between": []any{30, 50}}}, 2},
+			{"_nbetween", map[string]any{"age": map[string]any{"_nbetween": []any{30, 50}}}, 1},
+			{"_starts_with", map[string]any{"name": map[string]any{"_starts_with": "Ch"}}, 1},
+			{"_ends_with", map[string]any{"name": map[string]any{"_ends_with": "b"}}, 1},
+			{"_contains", map[string]any{"name": map[string]any{"_contains": "li"}}, 2},
+			{"_contains_escaped", map[string]any{"name": map[string]any{"_contains": "%"}}, 0},
+			{"_starts_with_escaped", map[string]any{"name": map[string]any{"_starts_with": "_"}}, 0},
+			{"_not", map[string]any{"_not": map[string]any{"age": map[string]any{"_eq": 35}}}, 2},
+			{"_and", map[string]any{"_and": []any{map[string]any{"age": map[string]any{"_gt": 25}}, map[string]any{"age": map[string]any{"_lt": 45}}}}, 1},
+			{"_or", map[string]any{"_or": []any{map[string]any{"age": map[string]any{"_eq": 25}}, map[string]any{"age": map[string]any{"_eq": 45}}}}, 2},
+			{"string_operand", map[string]any{"age": map[string]any{"_gt": "30"}}, 2},
+		}
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				result, err := repo.Get(ctx, &test.where, nil, nil, nil, nil, nil)
+				assert.NoError(t, err)
+				assert.Len(t, result, test.count)
+			})
+		}
+	})
+
 	t.Run("Put", func(t *testing.T) {
 		users := []User{
 			{ID: &[]int{1}[0], Name: "Alice Updated", Age: 26},
@@ -87,3 +154,589 @@ func UnitTests(ctx context.Context, t *testing.T, repo Repository[User]) {
 		assert.NotEmpty(t, result)
 	})
 }
+
+type Operation struct {
+	_    struct{} `db:"operations" json:"-"`
+	ID   *int     `db:"id" json:"id"`
+	Name string   `db:"name" json:"name"`
+}
+
+func TestCaseInsensitiveOperations(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *SQLBuilder[Operation]
+		ilike   string
+		nilike  string
+	}{
+		{"Postgres", NewPostgresRepository[Operation](nil).builder, `"name" ILIKE $1`, `"name" NOT ILIKE $1`},
+		{"MySQL", NewMySQLRepository[Operation](nil).builder, "LOWER(`name`) LIKE LOWER(?)", "LOWER(`name`) NOT LIKE LOWER(?)"},
+		{"SQLite", NewSQLiteRepository[Operation](nil).builder, `LOWER("name") LIKE LOWER($1)`, `LOWER("name") NOT LIKE LOWER($1)`},
+		{"MSSQL", NewMSSQLRepository[Operation](nil).builder, "[name] COLLATE Latin1_General_CI_AS LIKE @p1", "[name] COLLATE Latin1_General_CI_AS NOT LIKE @p1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args := []any{}
+			where := map[string]any{"name": map[string]any{"_ilike": "A%"}}
+			assert.Equal(t, test.ilike, test.builder.Where(&where, &args, nil))
+
+			args = []any{}
+			where = map[string]any{"name": map[string]any{"_nilike": "A%"}}
+			assert.Equal(t, test.nilike, test.builder.Where(&where, &args, nil))
+		})
+	}
+}
+
+func TestEmptyLogicalOperations(t *testing.T) {
+	builder := NewPostgresRepository[User](nil).builder
+
+	// Empty conditions match every record
+	args := []any{}
+	where := map[string]any{"_and": []any{map[string]any{}, map[string]any{"age": map[string]any{"_gt": 1}}}}
+	assert.Equal(t, `("age" > $1)`, builder.Where(&where, &args, nil))
+
+	args = []any{}
+	where = map[string]any{"_or": []any{map[string]any{"age": map[string]any{"_gt": 1}}, map[string]any{}}}
+	assert.Equal(t, "", builder.Where(&where, &args, nil))
+	assert.Empty(t, args)
+}
+
+type Article struct {
+	_     struct{} `db:"articles" json:"-"`
+	ID    *int     `db:"id" json:"id"`
+	Title string   `db:"title" json:"title" search:"true"`
+	Body  string   `db:"body" json:"body" search:"true"`
+}
+
+func TestSearchOperations(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *SQLBuilder[Article]
+		search  string
+		rank    string
+		word    string
+		text    string
+	}{
+		{"Postgres", NewPostgresRepository[Article](nil).builder, `to_tsvector(concat_ws(' ', "title","body")) @@ plainto_tsquery($1)`, `ts_rank(to_tsvector(concat_ws(' ', "title","body")), plainto_tsquery($1)) DESC,"id" ASC`, "go", `hello e-mail a"b foo:bar`},
+		{"MySQL", NewMySQLRepository[Article](nil).builder, "MATCH (`title`,`body`) AGAINST (? IN NATURAL LANGUAGE MODE)", "MATCH (`title`,`body`) AGAINST (? IN NATURAL LANGUAGE MODE) DESC,`id` ASC", "go", `hello e-mail a"b foo:bar`},
+		{"SQLite", NewSQLiteRepository[Article](nil).builder, `"id" IN (SELECT rowid FROM "articles_fts" WHERE "articles_fts" MATCH $1)`, `(SELECT -bm25("articles_fts") FROM "articles_fts" WHERE "articles_fts" MATCH $1 AND rowid = "articles"."id") DESC,"id" ASC`, `"go"`, `"hello" AND "e-mail" AND "a""b" AND "foo:bar"`},
+		{"MSSQL", NewMSSQLRepository[Article](nil).builder, "CONTAINS(([title],[body]), @p1)", "(SELECT ft.[RANK] FROM CONTAINSTABLE([articles], ([title],[body]), @p1) AS ft WHERE ft.[KEY] = [articles].[id]) DESC,[id] ASC", `"go"`, `"hello" AND "e-mail" AND "a""b" AND "foo:bar"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.builder.FullText(true)
+
+			args := []any{}
+			where := map[string]any{"_search": "go"}
+			assert.Equal(t, test.search, test.builder.Where(&where, &args, nil))
+			assert.Equal(t, []any{test.word}, args)
+
+			args = []any{}
+			order := []map[string]any{{"_rank": "go"}}
+			assert.Equal(t, test.rank, test.builder.Order(&order, &args))
+			assert.Equal(t, []any{test.word}, args)
+
+			// Words and punctuation are matched as plain text, the query syntax of the dialect is quoted
+			args = []any{}
+			where = map[string]any{"_search": `hello e-mail a"b foo:bar`}
+			assert.Equal(t, test.search, test.builder.Where(&where, &args, nil))
+			assert.Equal(t, []any{test.text}, args)
+		})
+	}
+
+	// Full-text tables reference the records by a single integer key
+	assert.True(t, NewSQLiteRepository[Article](nil).builder.Rowid())
+	assert.False(t, NewSQLiteRepository[Line](nil).builder.Rowid())
+	assert.False(t, NewSQLiteRepository[Session](nil).builder.Rowid())
+
+	t.Run("Fallback", func(t *testing.T) {
+		builder := NewSQLiteRepository[Article](nil).builder
+
+		args := []any{}
+		where := map[string]any{"_search": "go"}
+		assert.Equal(t, `("title" LIKE '%' || REPLACE(REPLACE(REPLACE($1,'!','!!'),'%','!%'),'_','!_') || '%' ESCAPE '!' OR "body" LIKE '%' || REPLACE(REPLACE(REPLACE($2,'!','!!'),'%','!%'),'_','!_') || '%' ESCAPE '!')`, builder.Where(&where, &args, nil))
+		assert.Equal(t, []any{"go", "go"}, args)
+	})
+}
+
+type Setting struct {
+	_     struct{}       `db:"settings" json:"-"`
+	ID    *int           `db:"id" json:"id"`
+	Value map[string]any `db:"value,json" json:"value"`
+	Tags  []string       `db:"tags" json:"tags"`
+}
+
+func TestJSONPathOperations(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *SQLBuilder[Setting]
+		text    string
+		number  string
+	}{
+		{"Postgres", NewPostgresRepository[Setting](nil).builder, `(jsonb_path_query_first(CAST("value" AS jsonb), CAST($1 AS jsonpath)) #>> '{}') = $2`, `CAST((jsonb_path_query_first(CAST("value" AS jsonb), CAST($1 AS jsonpath)) #>> '{}') AS numeric) > $2`},
+		{"MySQL", NewMySQLRepository[Setting](nil).builder, "JSON_UNQUOTE(JSON_EXTRACT(`value`, ?)) = ?", "CAST(JSON_UNQUOTE(JSON_EXTRACT(`value`, ?)) AS DECIMAL(65,30)) > ?"},
+		{"SQLite", NewSQLiteRepository[Setting](nil).builder, `json_extract("value", $1) = $2`, `json_extract("value", $1) > $2`},
+		{"MSSQL", NewMSSQLRepository[Setting](nil).builder, "JSON_VALUE([value], @p1) = @p2", "CAST(JSON_VALUE([value], @p1) AS FLOAT) > @p2"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args := []any{}
+			where := map[string]any{"value": map[string]any{"_path": map[string]any{"plan.tier": map[string]any{"_eq": "pro"}}}}
+			assert.Equal(t, test.text, test.builder.Where(&where, &args, nil))
+			assert.Equal(t, []any{`$."plan"."tier"`, "pro"}, args)
+
+			args = []any{}
+			where = map[string]any{"value": map[string]any{"_path": map[string]any{"seats": map[string]any{"_gt": float64(2)}}}}
+			assert.Equal(t, test.number, test.builder.Where(&where, &args, nil))
+			assert.Equal(t, []any{`$."seats"`, float64(2)}, args)
+		})
+	}
+}
+
+func TestArrayOperations(t *testing.T) {
+	tests := []struct {
+		name     string
+		builder  *SQLBuilder[Setting]
+		contains string
+		operand  any
+	}{
+		{"Postgres", NewPostgresRepository[Setting](nil).builder, `"tags" @> $1`, `{"a","b \"c\""}`},
+		{"MySQL", NewMySQLRepository[Setting](nil).builder, "JSON_CONTAINS(`tags`, ?)", `["a","b \"c\""]`},
+		{"SQLite", NewSQLiteRepository[Setting](nil).builder, `NOT EXISTS (SELECT 1 FROM json_each($1) AS o WHERE o.value NOT IN (SELECT c.value FROM json_each("tags") AS c))`, `["a","b \"c\""]`},
+		{"MSSQL", NewMSSQLRepository[Setting](nil).builder, "NOT EXISTS (SELECT 1 FROM OPENJSON(@p1) AS o WHERE o.[value] NOT IN (SELECT c.[value] FROM OPENJSON([tags]) AS c))", `["a","b \"c\""]`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args := []any{}
+			where := map[string]any{"tags": map[string]any{"_contains": []any{"a", `b "c"`}}}
+			assert.Equal(t, test.contains, test.builder.Where(&where, &args, nil))
+			assert.Len(t, args, 1)
+
+			value, err := args[0].(driver.Valuer).Value()
+			assert.NoError(t, err)
+			assert.Equal(t, test.operand, value)
+		})
+	}
+
+	t.Run("Postgres literal", func(t *testing.T) {
+		var texts []string
+		assert.NoError(t, pgArray{reflect.ValueOf(&texts)}.Scan([]byte(`{a,"b,c","d \"e\"",NULL}`)))
+		assert.Equal(t, []string{"a", "b,c", `d "e"`, ""}, texts)
+
+		var numbers []int
+		assert.NoError(t, pgArray{reflect.ValueOf(&numbers)}.Scan([]byte(`{1,2,3}`)))
+		assert.Equal(t, []int{1, 2, 3}, numbers)
+
+		value, err := pgArray{reflect.ValueOf(numbers)}.Value()
+		assert.NoError(t, err)
+		assert.Equal(t, "{1,2,3}", value)
+
+		value, err = pgArray{reflect.ValueOf([]int(nil))}.Value()
+		assert.NoError(t, err)
+		assert.Nil(t, value)
+	})
+}
+
+type Labels []string
+
+func (l Labels) Value() (driver.Value, error) {
+	return strings.Join(l, ","), nil
+}
+
+func TestArrayTypes(t *testing.T) {
+	assert.True(t, isArray(reflect.TypeFor[[]string]()))
+	assert.True(t, isArray(reflect.TypeFor[[]int]()))
+	assert.False(t, isArray(reflect.TypeFor[Labels]()))
+	assert.False(t, isArray(reflect.TypeFor[[]byte]()))
+	assert.False(t, isArray(reflect.TypeFor[string]()))
+}
+
+type Line struct {
+	_        struct{} `db:"lines" json:"-"`
+	OrderID  int      `db:"orderId" json:"orderId" key:"true"`
+	LineNo   int      `db:"lineNo" json:"lineNo" key:"true"`
+	Quantity int      `db:"quantity" json:"quantity"`
+}
+
+func TestCompositeKeys(t *testing.T) {
+	builder := NewPostgresRepository[Line](nil).builder
+	assert.Equal(t, []string{"orderId", "lineNo"}, builder.keys)
+
+	// Natural keys are inserted with the other fields
+	args := []any{}
+	fields, values := builder.Values(&[]Line{{OrderID: 1, LineNo: 2, Quantity: 3}}, &args)
+	assert.Equal(t, `"orderId","lineNo","quantity"`, fields)
+	assert.Equal(t, "($1,$2,$3)", values)
+
+	// Updates are matched by the full key tuple
+	args = []any{}
+	where := map[string]any{}
+	assert.Equal(t, "quantity=$1", builder.Set(&Line{OrderID: 1, LineNo: 2, Quantity: 3}, &args, &where))
+	assert.Equal(t, map[string]any{"orderId": map[string]any{"_eq": 1}, "lineNo": map[string]any{"_eq": 2}}, where)
+
+	assert.True(t, builder.keyed(Line{OrderID: 1, LineNo: 2}))
+	assert.False(t, builder.keyed(Line{OrderID: 1}))
+}
+
+type Post struct {
+	_         struct{}   `db:"posts" json:"-" softdelete:"deletedAt"`
+	ID        int        `db:"id" json:"id"`
+	Title     string     `db:"title" json:"title"`
+	DeletedAt *time.Time `db:"deletedAt" json:"deletedAt"`
+}
+
+func TestSoftDelete(t *testing.T) {
+	builder := NewPostgresRepository[Post](nil).builder
+	assert.True(t, builder.SoftDelete())
+
+	// Soft deleted records are excluded by default, including nested filters
+	args := []any{}
+	assert.Equal(t, `"deletedAt" IS NULL`, builder.Where(nil, &args, nil))
+	assert.Equal(t, `"deletedAt" IS NULL AND NOT ("id" = $1)`, builder.Where(&map[string]any{"_not": map[string]any{"id": map[string]any{"_eq": 1}}}, &args, nil))
+	assert.Equal(t, ``, builder.Where(scoped(nil, "with"), &args, nil))
+	assert.Equal(t, `"deletedAt" IS NOT NULL`, builder.Where(scoped(nil, "only"), &args, nil))
+
+	// The soft delete column is only written by delete and restore
+	args = []any{}
+	fields, _ := builder.Values(&[]Post{{Title: "a"}}, &args)
+	assert.Equal(t, `"title"`, fields)
+	args = []any{}
+	assert.Equal(t, "title=$1", builder.Set(&Post{ID: 1, Title: "a"}, &args, nil))
+	assert.Equal(t, `"deletedAt"=NULL`, builder.Trash(true, &args))
+	assert.Equal(t, `"deletedAt"=$2`, builder.Trash(false, &args))
+}
+
+type Author struct {
+	_     struct{} `db:"authors" json:"-"`
+	ID    int      `db:"id" json:"id"`
+	Posts []Post   `db:"posts" src:"id" dest:"authorId" table:"posts" json:"posts"`
+}
+
+func TestSoftDeletedRelations(t *testing.T) {
+	NewPostgresRepository[Post](nil)
+	builder := NewPostgresRepository[Author](nil).builder
+
+	// Soft deleted related records are excluded outside the negation of _every
+	args := []any{}
+	where := map[string]any{"posts": map[string]any{"_every": map[string]any{"title": map[string]any{"_eq": "a"}}}}
+	assert.Equal(t, `"id" NOT IN (SELECT "authorId" FROM "posts" WHERE "authorId" IS NOT NULL AND "deletedAt" IS NULL AND NOT ("title" = $1))`, builder.Where(&where, &args, nil))
+
+	// Soft deleted related records are not counted
+	args = []any{}
+	where = map[string]any{"posts": map[string]any{"_count": map[string]any{"_gt": 0}}}
+	assert.Equal(t, `(SELECT COUNT(*) FROM "posts" AS "_count" WHERE "_count"."authorId" = "authors"."id" AND "deletedAt" IS NULL) > $1`, builder.Where(&where, &args, nil))
+
+	// Non-integer bounds are rounded by their operator, other operands stay exact
+	for op, expected := range map[string]any{"_lt": int64(3), "_gte": int64(3), "_gt": int64(2), "_lte": int64(2), "_eq": 2.5} {
+		args = []any{}
+		where = map[string]any{"posts": map[string]any{"_count": map[string]any{op: 2.5}}}
+		builder.Where(&where, &args, nil)
+		assert.Equal(t, []any{expected}, args, op)
+	}
+}
+
+type Reader struct {
+	_     struct{} `db:"readers" json:"-"`
+	ID    int      `db:"id" json:"id"`
+	Code  string   `db:"code" json:"code"`
+	Posts []Post   `db:"posts" src:"code" dest:"id" table:"posts" through:"reader_posts" through_src:"readerCode" through_dest:"postId" json:"posts"`
+}
+
+func TestLink(t *testing.T) {
+	NewPostgresRepository[Post](nil)
+	builder := NewPostgresRepository[Reader](nil).builder
+
+	// Join table rows pair the source and destination columns of the relation, soft deleted records are not linked
+	args := []any{}
+	query, err := builder.Link("posts", "1", []any{"2"}, &args)
+	assert.NoError(t, err)
+	assert.Equal(t, `INSERT INTO "reader_posts" ("readerCode","postId") SELECT s."code",t."id" FROM (SELECT "code" FROM "readers" WHERE "id" = $1) s, (SELECT "id" FROM "posts" WHERE "deletedAt" IS NULL AND "id" IN ($2)) t WHERE NOT EXISTS (SELECT 1 FROM "reader_posts" WHERE "reader_posts"."readerCode" = s."code" AND "reader_posts"."postId" = t."id")`, query)
+	assert.Equal(t, []any{int64(1), int64(2)}, args)
+
+	args = []any{}
+	query, err = builder.Unlink("posts", "1", []any{"2"}, &args)
+	assert.NoError(t, err)
+	assert.Equal(t, `DELETE FROM "reader_posts" WHERE "readerCode" IN (SELECT "code" FROM "readers" WHERE "id" = $1) AND "postId" IN ($2)`, query)
+}
+
+type Revision struct {
+	_       struct{} `db:"revisions" json:"-"`
+	ID      int      `db:"id" json:"id"`
+	Body    string   `db:"body" json:"body"`
+	Version *int64   `db:"version" json:"version" version:"true"`
+}
+
+func TestVersion(t *testing.T) {
+	builder := NewPostgresRepository[Revision](nil).builder
+
+	// Versions start at 1
+	args := []any{}
+	models := []Revision{{Body: "a"}}
+	builder.Values(&models, &args)
+	assert.Equal(t, int64(1), *models[0].Version)
+
+	// Set versions are checked and incremented
+	args = []any{}
+	where := map[string]any{}
+	assert.Equal(t, `body=$1,version="version"+1`, builder.Set(&Revision{ID: 1, Body: "b", Version: models[0].Version}, &args, &where))
+	assert.Equal(t, map[string]any{"id": map[string]any{"_eq": 1}, "version": map[string]any{"_eq": int64(1)}}, where)
+
+	// Unset versions are only incremented
+	where = map[string]any{}
+	builder.Set(&Revision{ID: 1, Body: "b"}, &args, &where)
+	assert.Equal(t, map[string]any{"id": map[string]any{"_eq": 1}}, where)
+
+	assert.Panics(t, func() {
+		type Invalid struct {
+			ID      int    `db:"id" json:"id"`
+			Version string `db:"version" json:"version" version:"true"`
+		}
+		NewSQLBuilder[Invalid](nil, nil, nil)
+	})
+}
+
+func TestPatch(t *testing.T) {
+	builder := NewPostgresRepository[Line](nil).builder
+
+	// Only the fields of the patch are set, the primary keys are never set
+	args := []any{}
+	patch := &Patch[Line]{Values: Line{OrderID: 1, Quantity: 3}, Fields: []string{"orderId", "quantity"}}
+	assert.Equal(t, "quantity=$1", builder.Patch(patch, &args))
+	assert.Equal(t, []any{3}, args)
+
+	args = []any{}
+	patch = &Patch[Line]{Copies: map[string]string{"quantity": "lineNo"}}
+	assert.Equal(t, `quantity="lineNo"`, builder.Patch(patch, &args))
+	assert.Empty(t, args)
+
+	// Copies are set before the other fields, so they read the stored values on MySQL too
+	args = []any{}
+	moved := &Patch[User]{Fields: []string{"name"}, Copies: map[string]string{"age": "name"}}
+	assert.Equal(t, `age="name",name=$1`, NewPostgresRepository[User](nil).builder.Patch(moved, &args))
+	assert.Equal(t, []any{""}, args)
+}
+
+func TestUpsert(t *testing.T) {
+	excluded := func(name string) string { return `EXCLUDED."` + name + `"` }
+	target := func(name string) string { return `"revisions"."` + name + `"` }
+
+	// Natural keys are the default conflict fields, other fields are updated
+	fields, set, condition, err := NewPostgresRepository[Line](nil).builder.Conflict(nil, excluded, target)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"orderId", "lineNo"}, fields)
+	assert.Equal(t, `"quantity"=EXCLUDED."quantity"`, set)
+	assert.Empty(t, condition)
+
+	// Versions are incremented instead of updated, only the records having the inserted version are updated
+	builder := NewPostgresRepository[Revision](nil).builder
+	fields, set, condition, err = builder.Conflict(&Conflict{Fields: []string{"body"}}, excluded, target)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"body"}, fields)
+	assert.Equal(t, `"version"="revisions"."version"+1`, set)
+	assert.Equal(t, `"revisions"."version"=EXCLUDED."version"`, condition)
+	first, second := int64(1), int64(2)
+	assert.False(t, builder.Stale(Revision{}, Revision{Version: &first}))
+	assert.True(t, builder.Stale(Revision{Version: &first}, Revision{Version: &second}))
+
+	// Generated primary keys can't detect conflicts
+	_, _, _, err = builder.Conflict(nil, excluded, target)
+	assert.Error(t, err)
+	_, _, _, err = builder.Conflict(&Conflict{Fields: []string{"id"}}, excluded, target)
+	assert.Error(t, err)
+	_, _, _, err = builder.Conflict(&Conflict{Fields: []string{"body"}, Updates: []string{"unknown"}}, excluded, target)
+	assert.Error(t, err)
+
+	// Soft deleted records are not restored nor updated
+	_, set, condition, err = NewPostgresRepository[Post](nil).builder.Conflict(&Conflict{Fields: []string{"title"}}, excluded, target)
+	assert.NoError(t, err)
+	assert.NotContains(t, set, `"deletedAt"`)
+	assert.Equal(t, `"revisions"."deletedAt" IS NULL`, condition)
+
+	// Upserted records are read by the values of their conflict fields
+	assert.Equal(t, map[string]any{"body": map[string]any{"_eq": "draft"}, "version": map[string]any{"_is_null": true}}, builder.Match(Revision{Body: "draft"}, []string{"body", "version"}))
+}
+
+func TestScanOrdered(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// Records are sorted by the trailing ordinal column, which is not scanned into them
+	builder := NewMSSQLRepository[Revision](nil).builder
+	result, err := builder.ScanOrdered(db.Query("SELECT 2,'b',1,1 UNION ALL SELECT 1,'a',1,0"))
+	assert.NoError(t, err)
+	assert.Len(t, result, 2)
+	assert.Equal(t, "a", result[0].Body)
+	assert.Equal(t, "b", result[1].Body)
+}
+
+type Token struct {
+	_    struct{} `db:"tokens" json:"-"`
+	ID   string   `db:"id" json:"id" keygen:"uuidv7"`
+	Seq  *int64   `db:"seq" json:"seq" keygen:"sequence"`
+	Name string   `db:"name" json:"name"`
+}
+
+func TestKeyGenerators(t *testing.T) {
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, UUIDv7())
+	assert.Regexp(t, `^[0-7][0-9A-HJKMNP-TV-Z]{25}$`, ULID())
+
+	// Generated keys are time ordered
+	first, second := Snowflake().(int64), Snowflake().(int64)
+	assert.Less(t, first, second)
+	older, newer := ULID().(string), ULID().(string)
+	assert.LessOrEqual(t, older[:10], newer[:10])
+
+	// Keys of the tagged fields are filled when they are not set
+	next := int64(0)
+	RegisterGenerator("sequence", func() any { next++; return next })
+	builder := NewSQLiteRepository[Token](nil).builder
+	assert.True(t, builder.assigned())
+
+	args := []any{}
+	models := []Token{{Name: "a"}, {ID: "b", Name: "b"}}
+	fields, values := builder.Values(&models, &args)
+	assert.Equal(t, `"id","seq","name"`, fields)
+	assert.Equal(t, "($1,$2,$3),($4,$5,$6)", values)
+	assert.Len(t, models[0].ID, 36)
+	assert.Equal(t, "b", models[1].ID)
+	assert.Equal(t, int64(1), *models[0].Seq)
+	assert.Equal(t, int64(2), *models[1].Seq)
+
+	assert.Panics(t, func() {
+		NewSQLBuilder[struct {
+			ID string `db:"id" keygen:"unknown"`
+		}](nil, nil, nil)
+	})
+}
+
+func TestAggregateMetrics(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *SQLBuilder[User]
+		fields  string
+		groups  string
+	}{
+		{"Postgres", NewPostgresRepository[User](nil).builder, `"name",COUNT(*),AVG("age"),MAX("age")`, `"name"`},
+		{"MSSQL", NewMSSQLRepository[User](nil).builder, "[name],COUNT(*),AVG(CAST([age] AS FLOAT)),MAX([age])", "[name]"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Unknown metrics are skipped
+			fields, groups := test.builder.Aggregate(&[]string{"name"}, &[]string{"count", "avg:age", "max:age", "sum:unknown", "median:age"})
+			assert.Equal(t, test.fields, fields)
+			assert.Equal(t, test.groups, groups)
+		})
+	}
+}
+
+type Event struct {
+	_  struct{}  `db:"events" json:"-"`
+	ID *int      `db:"id" json:"id"`
+	At time.Time `db:"at" json:"at"`
+}
+
+func TestSeriesBuckets(t *testing.T) {
+	location := time.FixedZone("Fixed", 90*60)
+	tests := []struct {
+		name    string
+		builder *SQLBuilder[Event]
+		day     string
+		week    string
+	}{
+		{"Postgres", NewPostgresRepository[Event](nil).builder, `to_char(date_trunc('day', CAST("at" AS timestamptz) AT TIME ZONE 'Fixed'), 'YYYY-MM-DD HH24:MI:SS')`, `to_char(date_trunc('week', CAST("at" AS timestamptz) AT TIME ZONE 'Fixed'), 'YYYY-MM-DD HH24:MI:SS')`},
+		{"MySQL", NewMySQLRepository[Event](nil).builder, "DATE_FORMAT((`at` + INTERVAL 90 MINUTE), '%Y-%m-%d 00:00:00')", "DATE_FORMAT((`at` + INTERVAL 90 MINUTE) - INTERVAL WEEKDAY((`at` + INTERVAL 90 MINUTE)) DAY, '%Y-%m-%d 00:00:00')"},
+		{"SQLite", NewSQLiteRepository[Event](nil).builder, `strftime('%Y-%m-%d 00:00:00', "at", '90 minutes')`, `strftime('%Y-%m-%d 00:00:00', "at", '90 minutes', '-6 days', 'weekday 1')`},
+		{"MSSQL", NewMSSQLRepository[Event](nil).builder, "CONVERT(varchar(19), DATETRUNC(day, DATEADD(minute, 90, [at])), 120)", "CONVERT(varchar(19), DATETRUNC(iso_week, DATEADD(minute, 90, [at])), 120)"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			day, err := test.builder.Bucket("at", "day", location)
+			assert.NoError(t, err)
+			assert.Equal(t, test.day, day)
+			week, err := test.builder.Bucket("at", "week", location)
+			assert.NoError(t, err)
+			assert.Equal(t, test.week, week)
+		})
+	}
+
+	t.Run("Daylight saving time", func(t *testing.T) {
+		location, err := time.LoadLocation("Europe/Berlin")
+		assert.NoError(t, err)
+
+		// Timezones with daylight saving time are converted by their rules, or rejected
+		day, err := NewPostgresRepository[Event](nil).builder.Bucket("at", "day", location)
+		assert.NoError(t, err)
+		assert.Equal(t, `to_char(date_trunc('day', CAST("at" AS timestamptz) AT TIME ZONE 'Europe/Berlin'), 'YYYY-MM-DD HH24:MI:SS')`, day)
+		day, err = NewMySQLRepository[Event](nil).builder.Bucket("at", "day", location)
+		assert.NoError(t, err)
+		assert.Equal(t, "DATE_FORMAT(CONVERT_TZ(`at`, '+00:00', 'Europe/Berlin'), '%Y-%m-%d 00:00:00')", day)
+
+		_, err = NewSQLiteRepository[Event](nil).builder.Bucket("at", "day", location)
+		assert.ErrorAs(t, err, new(*TimezoneError))
+		_, err = NewMSSQLRepository[Event](nil).builder.Bucket("at", "day", location)
+		assert.ErrorAs(t, err, new(*TimezoneError))
+	})
+
+	t.Run("Changed rules", func(t *testing.T) {
+		// Timezones without daylight saving time today are still converted when their rules changed in other years
+		location, err := time.LoadLocation("Asia/Tokyo")
+		assert.NoError(t, err)
+		_, err = NewSQLiteRepository[Event](nil).builder.Bucket("at", "day", location)
+		assert.ErrorAs(t, err, new(*TimezoneError))
+
+		// Timezones which always had the same offset are shifted by it
+		location, err = time.LoadLocation("Etc/GMT+5")
+		assert.NoError(t, err)
+		day, err := NewSQLiteRepository[Event](nil).builder.Bucket("at", "day", location)
+		assert.NoError(t, err)
+		assert.Equal(t, `strftime('%Y-%m-%d 00:00:00', "at", '-300 minutes')`, day)
+	})
+
+	t.Run("Next", func(t *testing.T) {
+		start := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+		assert.Equal(t, time.Date(2024, 1, 31, 1, 0, 0, 0, time.UTC), next(start, "hour"))
+		assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), next(start, "day"))
+		assert.Equal(t, time.Date(2024, 2, 7, 0, 0, 0, 0, time.UTC), next(start, "week"))
+		assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), next(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), "month"))
+	})
+}
+
+type UUID [16]byte
+
+func (u *UUID) UnmarshalText(text []byte) error {
+	_, err := hex.Decode(u[:], bytes.ReplaceAll(text, []byte("-"), nil))
+	return err
+}
+
+func TestBindScalars(t *testing.T) {
+	assert.Equal(t, int64(5), bind(reflect.ValueOf(float64(5)), reflect.TypeFor[sql.NullInt64]()).Interface())
+	assert.Equal(t, "5", bind(reflect.ValueOf(float64(5)), reflect.TypeFor[sql.NullString]()).Interface())
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), bind(reflect.ValueOf("2024-01-01T00:00:00Z"), reflect.TypeFor[sql.NullTime]()).Interface())
+	assert.Equal(t, UUID{0x01, 0x23, 15: 0xff}, bind(reflect.ValueOf("01230000-0000-0000-0000-0000000000ff"), reflect.TypeFor[UUID]()).Interface())
+	assert.Equal(t, "invalid", bind(reflect.ValueOf("invalid"), reflect.TypeFor[UUID]()).Interface())
+}
+
+type Session struct {
+	_    struct{} `db:"sessions" json:"-"`
+	ID   UUID     `db:"id" json:"id"`
+	Name string   `db:"name" json:"name"`
+}
+
+func TestScalarKeys(t *testing.T) {
+	builder := NewPostgresRepository[Session](nil).builder
+
+	// Keys of scalar types are matched by their value
+	id := UUID{0x01, 0x23, 15: 0xff}
+	where := builder.Key(Session{ID: id})
+	assert.Equal(t, map[string]any{"id": map[string]any{"_eq": id}}, where)
+
+	args := []any{}
+	assert.Equal(t, `"id" = $1`, builder.Where(&where, &args, nil))
+	assert.Equal(t, []any{id}, args)
+}
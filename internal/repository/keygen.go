@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Key generators by name, fields tagged with keygen are filled by them before insert
+var generators = map[string]func() any{
+	"uuidv7":    UUIDv7,
+	"ulid":      ULID,
+	"snowflake": Snowflake,
+}
+
+// RegisterGenerator adds a named key generator, it must be registered before the repositories using it are created
+func RegisterGenerator(name string, generator func() any) {
+	slog.Debug("Registering key generator", slog.String("name", name))
+	generators[name] = generator
+}
+
+// UUIDv7 returns a time ordered UUID as defined by RFC 9562
+func UUIDv7() any {
+	var result [16]byte
+	_, _ = rand.Read(result[6:])
+
+	// The first 48 bits are the unix timestamp in milliseconds
+	millis := uint64(time.Now().UnixMilli())
+	binary.BigEndian.PutUint16(result[0:], uint16(millis>>32))
+	binary.BigEndian.PutUint32(result[2:], uint32(millis))
+
+	// Set the version and variant bits
+	result[6] = (result[6] & 0x0f) | 0x70
+	result[8] = (result[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", result[0:4], result[4:6], result[6:8], result[8:10], result[10:16])
+}
+
+// Crockford's base32 alphabet of ULIDs
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULID returns a lexicographically sortable identifier of 26 characters
+func ULID() any {
+	var result [16]byte
+	_, _ = rand.Read(result[6:])
+
+	// The first 48 bits are the unix timestamp in milliseconds
+	millis := uint64(time.Now().UnixMilli())
+	binary.BigEndian.PutUint16(result[0:], uint16(millis>>32))
+	binary.BigEndian.PutUint32(result[2:], uint32(millis))
+
+	// Encode the 128 bits by groups of 5 bits, the first character holds the 3 leading bits
+	hi, lo := binary.BigEndian.Uint64(result[:8]), binary.BigEndian.Uint64(result[8:])
+	text := make([]byte, 26)
+	for idx := 25; idx >= 0; idx-- {
+		text[idx] = crockford[lo&0x1f]
+		lo = (lo >> 5) | (hi << 59)
+		hi >>= 5
+	}
+
+	return string(text)
+}
+
+// Twitter epoch of snowflake timestamps, 2010-11-04T01:42:54.657Z
+const epoch = 1288834974657
+
+// State of the snowflake generator, the node is picked randomly per process
+var snowflake = struct {
+	sync.Mutex
+	node     int64
+	millis   int64
+	sequence int64
+}{node: func() int64 {
+	var node [2]byte
+	_, _ = rand.Read(node[:])
+	return int64(binary.BigEndian.Uint16(node[:]) & 0x3ff)
+}()}
+
+// Snowflake returns a time ordered 64 bit identifier made of a 41 bit timestamp, a 10 bit node and a 12 bit sequence
+func Snowflake() any {
+	snowflake.Lock()
+	defer snowflake.Unlock()
+
+	millis := time.Now().UnixMilli() - epoch
+	if millis <= snowflake.millis {
+		// Increment the sequence within the same millisecond, borrowing the next millisecond on overflow
+		millis = snowflake.millis
+		snowflake.sequence = (snowflake.sequence + 1) & 0xfff
+		if snowflake.sequence == 0 {
+			millis++
+		}
+	} else {
+		snowflake.sequence = 0
+	}
+	snowflake.millis = millis
+
+	return millis<<22 | snowflake.node<<12 | snowflake.sequence
+}
@@ -7,34 +7,127 @@ import (
 	"log/slog"
 	"reflect"
 	"strings"
+	"sync"
+	"time"
 )
 
 // MySQLRepository provides CRUD operations for MySQL
 type MySQLRepository[Model any] struct {
-	db      *sql.DB
-	builder *SQLBuilder[Model]
+	db       *sql.DB
+	builder  *SQLBuilder[Model]
+	detect   sync.Mutex
+	detected bool
 }
 
 // NewMySQLRepository initializes a new MySQLRepository
 func NewMySQLRepository[Model any](db *sql.DB) *MySQLRepository[Model] {
+	// Escape the LIKE wildcards of a parameter
+	escape := func(value string) string {
+		return fmt.Sprintf("REPLACE(REPLACE(REPLACE(%s,'!','!!'),'%%','!%%'),'_','!_')", value)
+	}
+
 	// Define SQL operators and helper functions for query building
 	operations := map[string]func(string, ...string) string{
-		"_eq":     func(key string, values ...string) string { return fmt.Sprintf("%s = %s", key, values[0]) },
-		"_neq":    func(key string, values ...string) string { return fmt.Sprintf("%s != %s", key, values[0]) },
-		"_gt":     func(key string, values ...string) string { return fmt.Sprintf("%s > %s", key, values[0]) },
-		"_gte":    func(key string, values ...string) string { return fmt.Sprintf("%s >= %s", key, values[0]) },
-		"_lt":     func(key string, values ...string) string { return fmt.Sprintf("%s < %s", key, values[0]) },
-		"_lte":    func(key string, values ...string) string { return fmt.Sprintf("%s <= %s", key, values[0]) },
-		"_like":   func(key string, values ...string) string { return fmt.Sprintf("%s LIKE %s", key, values[0]) },
-		"_nlike":  func(key string, values ...string) string { return fmt.Sprintf("%s NOT LIKE %s", key, values[0]) },
-		"_ilike":  func(key string, values ...string) string { return fmt.Sprintf("%s ILIKE %s", key, values[0]) },
-		"_nilike": func(key string, values ...string) string { return fmt.Sprintf("%s NOT ILIKE %s", key, values[0]) },
+		"_eq":    func(key string, values ...string) string { return fmt.Sprintf("%s = %s", key, values[0]) },
+		"_neq":   func(key string, values ...string) string { return fmt.Sprintf("%s != %s", key, values[0]) },
+		"_gt":    func(key string, values ...string) string { return fmt.Sprintf("%s > %s", key, values[0]) },
+		"_gte":   func(key string, values ...string) string { return fmt.Sprintf("%s >= %s", key, values[0]) },
+		"_lt":    func(key string, values ...string) string { return fmt.Sprintf("%s < %s", key, values[0]) },
+		"_lte":   func(key string, values ...string) string { return fmt.Sprintf("%s <= %s", key, values[0]) },
+		"_like":  func(key string, values ...string) string { return fmt.Sprintf("%s LIKE %s", key, values[0]) },
+		"_nlike": func(key string, values ...string) string { return fmt.Sprintf("%s NOT LIKE %s", key, values[0]) },
+
+		// ILIKE is not supported, so case-insensitive matching lowers both sides
+		"_ilike": func(key string, values ...string) string {
+			return fmt.Sprintf("LOWER(%s) LIKE LOWER(%s)", key, values[0])
+		},
+		"_nilike": func(key string, values ...string) string {
+			return fmt.Sprintf("LOWER(%s) NOT LIKE LOWER(%s)", key, values[0])
+		},
 		"_in": func(key string, values ...string) string {
 			return fmt.Sprintf("%s IN (%s)", key, strings.Join(values, ","))
 		},
 		"_nin": func(key string, values ...string) string {
 			return fmt.Sprintf("%s NOT IN (%s)", key, strings.Join(values, ","))
 		},
+		"_is_null": func(key string, values ...string) string {
+			if values[0] == "true" {
+				return fmt.Sprintf("%s IS NULL", key)
+			}
+			return fmt.Sprintf("%s IS NOT NULL", key)
+		},
+		"_between": func(key string, values ...string) string {
+			return fmt.Sprintf("%s BETWEEN %s AND %s", key, values[0], values[1])
+		},
+		"_nbetween": func(key string, values ...string) string {
+			return fmt.Sprintf("%s NOT BETWEEN %s AND %s", key, values[0], values[1])
+		},
+		"_starts_with": func(key string, values ...string) string {
+			return fmt.Sprintf("%s LIKE CONCAT(%s, '%%') ESCAPE '!'", key, escape(values[0]))
+		},
+		"_ends_with": func(key string, values ...string) string {
+			return fmt.Sprintf("%s LIKE CONCAT('%%', %s) ESCAPE '!'", key, escape(values[0]))
+		},
+		"_contains": func(key string, values ...string) string {
+			return fmt.Sprintf("%s LIKE CONCAT('%%', %s, '%%') ESCAPE '!'", key, escape(values[0]))
+		},
+
+		// Full-text search of the FULLTEXT index covering the searchable columns
+		"_search": func(key string, values ...string) string {
+			return fmt.Sprintf("MATCH (%s) AGAINST (%s IN NATURAL LANGUAGE MODE)", strings.Join(values[2:], ","), values[0])
+		},
+		"_rank": func(key string, values ...string) string {
+			return fmt.Sprintf("MATCH (%s) AGAINST (%s IN NATURAL LANGUAGE MODE)", strings.Join(values[2:], ","), values[0])
+		},
+
+		// Value of a JSON path as text, cast to the kind of the operands
+		"_path": func(key string, values ...string) string {
+			expr := fmt.Sprintf("JSON_UNQUOTE(JSON_EXTRACT(%s, %s))", key, values[0])
+			switch values[1] {
+			case "number":
+				return fmt.Sprintf("CAST(%s AS DECIMAL(65,30))", expr)
+			case "boolean":
+				return fmt.Sprintf("(%s = 'true')", expr)
+			}
+			return expr
+		},
+
+		// Containment operations of the array columns, stored as JSON arrays
+		"_array_contains":     func(key string, values ...string) string { return fmt.Sprintf("JSON_CONTAINS(%s, %s)", key, values[0]) },
+		"_array_contained_by": func(key string, values ...string) string { return fmt.Sprintf("JSON_CONTAINS(%s, %s)", values[0], key) },
+		"_array_overlaps":     func(key string, values ...string) string { return fmt.Sprintf("JSON_OVERLAPS(%s, %s)", key, values[0]) },
+
+		// Aggregate functions of the metrics
+		"_metric_count": func(key string, values ...string) string { return fmt.Sprintf("COUNT(%s)", key) },
+		"_metric_sum":   func(key string, values ...string) string { return fmt.Sprintf("SUM(%s)", key) },
+		"_metric_avg":   func(key string, values ...string) string { return fmt.Sprintf("AVG(%s)", key) },
+		"_metric_min":   func(key string, values ...string) string { return fmt.Sprintf("MIN(%s)", key) },
+		"_metric_max":   func(key string, values ...string) string { return fmt.Sprintf("MAX(%s)", key) },
+
+		// Time bucket of the series as text, the time is shifted by the offset minutes of the timezone and truncated by DATE_FORMAT
+		// CONVERT_TZ is not used, since it requires the timezone tables to be loaded
+		"_bucket": func(key string, values ...string) string {
+			// Named timezones require the time zone tables of MySQL
+			shifted := fmt.Sprintf("(%s + INTERVAL %s MINUTE)", key, values[2])
+			if values[3] != "true" {
+				shifted = fmt.Sprintf("CONVERT_TZ(%s, '+00:00', %s)", key, values[1])
+			}
+			switch values[0] {
+			case "hour":
+				return fmt.Sprintf("DATE_FORMAT(%s, '%%Y-%%m-%%d %%H:00:00')", shifted)
+			case "week":
+				return fmt.Sprintf("DATE_FORMAT(%[1]s - INTERVAL WEEKDAY(%[1]s) DAY, '%%Y-%%m-%%d 00:00:00')", shifted)
+			case "month":
+				return fmt.Sprintf("DATE_FORMAT(%s, '%%Y-%%m-01 00:00:00')", shifted)
+			}
+			return fmt.Sprintf("DATE_FORMAT(%s, '%%Y-%%m-%%d 00:00:00')", shifted)
+		},
+
+		// Sort directions with NULLS placement are emulated, since there is no native syntax
+		"_asc_nulls_first":  func(key string, values ...string) string { return fmt.Sprintf("%[1]s IS NULL DESC, %[1]s ASC", key) },
+		"_asc_nulls_last":   func(key string, values ...string) string { return fmt.Sprintf("%[1]s IS NULL ASC, %[1]s ASC", key) },
+		"_desc_nulls_first": func(key string, values ...string) string { return fmt.Sprintf("%[1]s IS NULL DESC, %[1]s DESC", key) },
+		"_desc_nulls_last":  func(key string, values ...string) string { return fmt.Sprintf("%[1]s IS NULL ASC, %[1]s DESC", key) },
 	}
 	identifier := func(name string) string {
 		return fmt.Sprintf("`%s`", name)
@@ -44,20 +137,55 @@ func NewMySQLRepository[Model any](db *sql.DB) *MySQLRepository[Model] {
 		return "?"
 	}
 
-	return &MySQLRepository[Model]{
+	result := &MySQLRepository[Model]{
 		db:      db,
-		builder: NewSQLBuilder[Model](operations, identifier, parameter, nil),
+		builder: NewSQLBuilder[Model](operations, identifier, parameter),
 	}
+	result.builder.writer = result
+	// NULLs are sorted before the other values in ascending order
+	result.builder.nullsFirst = true
+
+	return result
+}
+
+// fulltext enables the full-text search once a FULLTEXT index of the model table is detected
+// Failed detections are retried by the next query
+func (r *MySQLRepository[Model]) fulltext() {
+	if !r.builder.Searchable() {
+		return
+	}
+
+	r.detect.Lock()
+	defer r.detect.Unlock()
+	if r.detected {
+		return
+	}
+
+	// The detection outlives the request, so it doesn't use the request context
+	var count int
+	query := "SELECT COUNT(*) FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_TYPE = 'FULLTEXT'"
+	if err := r.db.QueryRowContext(context.Background(), query, r.builder.table).Scan(&count); err != nil {
+		slog.Warn("Error detecting full-text search, falling back to LIKE until the next detection", slog.Any("error", err))
+		return
+	}
+
+	slog.Debug("Detected full-text search", slog.Bool("enabled", count > 0))
+	r.detected = true
+	r.builder.FullText(count > 0)
 }
 
 // Get retrieves records from the database based on the provided filters
-func (r *MySQLRepository[Model]) Get(ctx context.Context, where *map[string]any, order *map[string]any, limit *int, skip *int) ([]Model, error) {
+func (r *MySQLRepository[Model]) Get(ctx context.Context, where *map[string]any, order *[]map[string]any, limit *int, skip *int, fields *[]string, include *[]string) ([]Model, error) {
+	r.fulltext()
+
+	builder := r.builder.Select(fields, include)
+
 	args := []any{}
-	query := fmt.Sprintf("SELECT %s FROM %s", r.builder.Fields(""), r.builder.Table())
-	if expr := r.builder.Where(where, &args, nil); expr != "" {
+	query := fmt.Sprintf("SELECT %s FROM %s", builder.Fields(""), builder.Table())
+	if expr := builder.Where(where, &args, nil); expr != "" {
 		query += fmt.Sprintf(" WHERE %s", expr)
 	}
-	if expr := r.builder.Order(order); expr != "" {
+	if expr := builder.Order(order, &args); expr != "" {
 		query += fmt.Sprintf(" ORDER BY %s", expr)
 	}
 	if limit != nil && *limit > 0 {
@@ -70,19 +198,143 @@ func (r *MySQLRepository[Model]) Get(ctx context.Context, where *map[string]any,
 	slog.Info("Executing Get query", slog.String("query", query), slog.Any("args", args))
 
 	// Execute the query and scan the results
-	result, err := r.builder.Scan(r.db.QueryContext(ctx, query, args...))
+	result, err := builder.Scan(r.db.QueryContext(ctx, query, args...))
 	if err != nil {
 		slog.Error("Error executing Get query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
 		return nil, err
 	}
 
+	// Load the included relations of the results
+	if err := builder.Include(ctx, &result, include, func(query string, args ...any) (*sql.Rows, error) {
+		return r.db.QueryContext(ctx, query, args...)
+	}); err != nil {
+		slog.Error("Error loading included relations", slog.Any("include", include), slog.Any("error", err))
+		return nil, err
+	}
+
 	return result, nil
 }
 
-// Put updates existing records in the database
-func (r *MySQLRepository[Model]) Put(ctx context.Context, models *[]Model) ([]Model, error) {
-	result := []Model{}
+// Count returns the number of records matching the provided filters
+func (r *MySQLRepository[Model]) Count(ctx context.Context, where *map[string]any) (int, error) {
+	r.fulltext()
+
+	args := []any{}
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s", r.builder.Table())
+	if expr := r.builder.Where(where, &args, nil); expr != "" {
+		query += fmt.Sprintf(" WHERE %s", expr)
+	}
+
+	slog.Info("Executing Count query", slog.String("query", query), slog.Any("args", args))
+
+	// Execute the query and scan the result
+	var result int
+	if err := r.db.QueryRowContext(ctx, query, args...).Scan(&result); err != nil {
+		slog.Error("Error executing Count query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
+		return 0, err
+	}
+
+	return result, nil
+}
+
+// Aggregate returns the metrics of the records matching the provided filters, grouped by the provided fields
+func (r *MySQLRepository[Model]) Aggregate(ctx context.Context, where *map[string]any, group *[]string, metrics *[]string) ([]map[string]any, error) {
+	r.fulltext()
+
+	args := []any{}
+	fields, groups := r.builder.Aggregate(group, metrics)
+	query := fmt.Sprintf("SELECT %s FROM %s", fields, r.builder.Table())
+	if expr := r.builder.Where(where, &args, nil); expr != "" {
+		query += fmt.Sprintf(" WHERE %s", expr)
+	}
+	if groups != "" {
+		query += fmt.Sprintf(" GROUP BY %s ORDER BY %s", groups, groups)
+	}
+
+	slog.Info("Executing Aggregate query", slog.String("query", query), slog.Any("args", args))
+
+	// Execute the query and scan the results
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	result, err := r.builder.Aggregates(rows, err, group, metrics)
+	if err != nil {
+		slog.Error("Error executing Aggregate query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Facets returns the distinct values of the fields with their counts among the records matching the provided filters
+// The most frequent values come first, at most limit values are returned for each field
+func (r *MySQLRepository[Model]) Facets(ctx context.Context, where *map[string]any, fields *[]string, limit int) (map[string][]Facet, error) {
+	r.fulltext()
+
+	result := map[string][]Facet{}
+	if fields == nil {
+		return result, nil
+	}
+
+	for _, field := range *fields {
+		args := []any{}
+		group, metrics := []string{field}, []string{"count"}
+		selected, groups := r.builder.Aggregate(&group, &metrics)
+		query := fmt.Sprintf("SELECT %s FROM %s", selected, r.builder.Table())
+		if expr := r.builder.Where(where, &args, nil); expr != "" {
+			query += fmt.Sprintf(" WHERE %s", expr)
+		}
+		query += fmt.Sprintf(" GROUP BY %s ORDER BY COUNT(*) DESC, %s ASC", groups, groups)
+		if limit > 0 {
+			query += fmt.Sprintf(" LIMIT %d", limit)
+		}
+
+		slog.Info("Executing Facets query", slog.String("query", query), slog.Any("args", args))
+
+		// Execute the query and scan the results
+		rows, err := r.db.QueryContext(ctx, query, args...)
+		items, err := r.builder.Aggregates(rows, err, &group, &metrics)
+		if err != nil {
+			slog.Error("Error executing Facets query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
+			return nil, err
+		}
+
+		result[field] = facets(field, items)
+	}
+
+	return result, nil
+}
+
+// Series returns the count or the sum of the records matching the provided filters by time buckets of the field
+func (r *MySQLRepository[Model]) Series(ctx context.Context, where *map[string]any, field string, interval string, location *time.Location, metric string) ([]Bucket, error) {
+	r.fulltext()
+
+	args := []any{}
+	bucket, err := r.builder.Bucket(field, interval, location)
+	if err != nil {
+		slog.Error("Error constructing Series bucket", slog.String("timezone", location.String()), slog.Any("error", err))
+		return nil, err
+	}
+	value, _, _ := r.builder.metric(metric)
+	query := fmt.Sprintf("SELECT %s,%s FROM %s", bucket, value, r.builder.Table())
+	if expr := r.builder.Where(where, &args, nil); expr != "" {
+		query += fmt.Sprintf(" WHERE %s", expr)
+	}
+	query += fmt.Sprintf(" GROUP BY %s ORDER BY %s", bucket, bucket)
+
+	slog.Info("Executing Series query", slog.String("query", query), slog.Any("args", args))
+
+	// Execute the query and scan the results
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	result, err := r.builder.Series(rows, err, interval, location)
+	if err != nil {
+		slog.Error("Error executing Series query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
+		return nil, err
+	}
+
+	return result, nil
+}
 
+// Put updates existing records in the database with their nested relations
+func (r *MySQLRepository[Model]) Put(ctx context.Context, models *[]Model) ([]Model, error) {
 	// Begin a transaction
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -90,6 +342,79 @@ func (r *MySQLRepository[Model]) Put(ctx context.Context, models *[]Model) ([]Mo
 		return nil, err
 	}
 
+	// Update the models and their relations
+	result, err := r.builder.Save(ctx, tx, models, true)
+	if err != nil {
+		slog.Error("Error saving models for Put", slog.Any("error", err))
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		slog.Error("Error committing transaction for Put", slog.Any("error", err))
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Post inserts new records into the database with their nested relations
+func (r *MySQLRepository[Model]) Post(ctx context.Context, models *[]Model) ([]Model, error) {
+	// Begin a transaction
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("Error starting transaction for Post", slog.Any("error", err))
+		return nil, err
+	}
+
+	// Insert the models and their relations
+	result, err := r.builder.Save(ctx, tx, models, false)
+	if err != nil {
+		slog.Error("Error saving models for Post", slog.Any("error", err))
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		slog.Error("Error committing transaction for Post", slog.Any("error", err))
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Upsert inserts the records, the records conflicting with the existing records update them instead
+func (r *MySQLRepository[Model]) Upsert(ctx context.Context, models *[]Model, conflict *Conflict) ([]Model, error) {
+	// Begin a transaction
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("Error starting transaction for Upsert", slog.Any("error", err))
+		return nil, err
+	}
+
+	// Upsert the models and their relations
+	result, err := r.builder.Upsert(ctx, tx, models, conflict)
+	if err != nil {
+		slog.Error("Error saving models for Upsert", slog.Any("error", err))
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		slog.Error("Error committing transaction for Upsert", slog.Any("error", err))
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// update executes the UPDATE queries of the models inside the transaction
+func (r *MySQLRepository[Model]) update(ctx context.Context, tx *sql.Tx, models *[]Model) ([]Model, error) {
+	result := []Model{}
+
 	// Update each model in the database
 	for _, model := range *models {
 		args := []any{}
@@ -101,49 +426,44 @@ func (r *MySQLRepository[Model]) Put(ctx context.Context, models *[]Model) ([]Mo
 
 		slog.Info("Executing Put query", slog.String("query", query), slog.Any("args", args))
 
-		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		updated, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
 			slog.Error("Error executing Put query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
-			tx.Rollback()
 			return nil, err
 		}
 
+		// Versions are incremented by the updates, so stale versions are the only unaffected versioned records
+		if _, ok := r.builder.Version(model); ok {
+			if count, err := updated.RowsAffected(); err == nil && count <= 0 {
+				continue
+			}
+		}
+
+		// Select the updated record by its primary keys, since its version may be incremented
 		getArgs := []any{}
+		getWhere := r.builder.Key(model)
 		getQuery := fmt.Sprintf("SELECT %s FROM %s", r.builder.Fields(""), r.builder.Table())
-		if expr := r.builder.Where(&where, &getArgs, nil); expr != "" {
+		if expr := r.builder.Where(&getWhere, &getArgs, nil); expr != "" {
 			getQuery += fmt.Sprintf(" WHERE %s", expr)
 		}
 
 		items, err := r.builder.Scan(tx.QueryContext(ctx, getQuery, getArgs...))
 		if err != nil {
 			slog.Error("Error executing Put query", slog.String("query", getQuery), slog.Any("args", getArgs), slog.Any("error", err))
-			tx.Rollback()
 			return nil, err
 		}
 
 		result = append(result, items...)
 	}
 
-	// Commit the transaction
-	if err := tx.Commit(); err != nil {
-		slog.Error("Error committing transaction for Put", slog.Any("error", err))
-		return nil, err
-	}
-
 	return result, nil
 }
 
-// Post inserts new records into the database
-func (r *MySQLRepository[Model]) Post(ctx context.Context, models *[]Model) ([]Model, error) {
-	// Begin a transaction
-	tx, err := r.db.BeginTx(ctx, nil)
-	if err != nil {
-		slog.Error("Error starting transaction for Put", slog.Any("error", err))
-		return nil, err
-	}
-
+// insert executes the INSERT query of the models inside the transaction
+func (r *MySQLRepository[Model]) insert(ctx context.Context, tx *sql.Tx, models *[]Model) ([]Model, error) {
 	args := []any{}
 	query := fmt.Sprintf("INSERT INTO %s", r.builder.Table())
-	if fields, values := r.builder.Values(models, &args, nil); fields != "" && values != "" {
+	if fields, values := r.builder.Values(models, &args); fields != "" && values != "" {
 		query += fmt.Sprintf(" (%s) VALUES %s", fields, values)
 	}
 
@@ -153,7 +473,6 @@ func (r *MySQLRepository[Model]) Post(ctx context.Context, models *[]Model) ([]M
 	ids := []string{}
 	if res, err := tx.ExecContext(ctx, query, args...); err != nil {
 		slog.Error("Error executing Post query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
-		tx.Rollback()
 		return nil, err
 	} else {
 		if lastId, err := res.LastInsertId(); err == nil {
@@ -165,8 +484,17 @@ func (r *MySQLRepository[Model]) Post(ctx context.Context, models *[]Model) ([]M
 		}
 	}
 
-	getArgs := []any{}
+	// Assigned keys are known by the models, keys generated by the database are read from the LAST_INSERT_ID range
 	getWhere := map[string]any{r.builder.keys[0]: map[string]any{"_in": ids}}
+	if r.builder.assigned() {
+		items := []any{}
+		for _, model := range *models {
+			items = append(items, r.builder.Key(model))
+		}
+		getWhere = map[string]any{"_or": items}
+	}
+
+	getArgs := []any{}
 	getQuery := fmt.Sprintf("SELECT %s FROM %s", r.builder.Fields(""), r.builder.Table())
 	if expr := r.builder.Where(&getWhere, &getArgs, nil); expr != "" {
 		getQuery += fmt.Sprintf(" WHERE %s", expr)
@@ -177,22 +505,99 @@ func (r *MySQLRepository[Model]) Post(ctx context.Context, models *[]Model) ([]M
 	// Execute the query and scan the results
 	result, err := r.builder.Scan(tx.QueryContext(ctx, getQuery, getArgs...))
 	if err != nil {
-		slog.Error("Error executing Delete query", slog.String("query", getQuery), slog.Any("args", getArgs), slog.Any("error", err))
-		tx.Rollback()
+		slog.Error("Error executing Post query", slog.String("query", getQuery), slog.Any("args", getArgs), slog.Any("error", err))
 		return nil, err
 	}
 
-	// Commit the transaction
-	if err := tx.Commit(); err != nil {
-		slog.Error("Error committing transaction for Delete", slog.Any("error", err))
+	return result, nil
+}
+
+// upsert executes the INSERT ON DUPLICATE KEY UPDATE query of the models inside the transaction
+// Conflicts are detected by any unique index, the conflict fields are used to read the upserted records
+// ON DUPLICATE KEY UPDATE has no condition, so the existing records are locked and the models conflicting with stale records are skipped
+func (r *MySQLRepository[Model]) upsert(ctx context.Context, tx *sql.Tx, models *[]Model, conflict *Conflict) ([]Model, error) {
+	// Inserted values are referenced by the VALUES function
+	conflicts, set, _, err := r.builder.Conflict(conflict, func(name string) string {
+		return "VALUES(" + r.builder.identifier(name) + ")"
+	}, func(name string) string {
+		return r.builder.identifier(name)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Fill the generated values of the models before they are matched
+	fields, values := r.builder.Values(models, &[]any{})
+	if fields == "" || values == "" {
+		return []Model{}, nil
+	}
+
+	// Lock the existing records of the models and keep the models which can update them
+	upserted := []Model{}
+	for _, model := range *models {
+		lockArgs := []any{}
+		lockWhere := r.builder.Match(model, conflicts)
+		lockQuery := fmt.Sprintf("SELECT %s FROM %s WHERE %s FOR UPDATE", r.builder.Fields(""), r.builder.Table(), r.builder.Where(scoped(&lockWhere, "with"), &lockArgs, nil))
+
+		slog.Info("Executing Upsert query", slog.String("query", lockQuery), slog.Any("args", lockArgs))
+
+		items, err := r.builder.Scan(tx.QueryContext(ctx, lockQuery, lockArgs...))
+		if err != nil {
+			slog.Error("Error executing Upsert query", slog.String("query", lockQuery), slog.Any("args", lockArgs), slog.Any("error", err))
+			return nil, err
+		}
+
+		if len(items) <= 0 || !r.builder.Stale(model, items[0]) {
+			upserted = append(upserted, model)
+		}
+	}
+	if len(upserted) <= 0 {
+		return []Model{}, nil
+	}
+
+	args := []any{}
+	query := fmt.Sprintf("INSERT INTO %s", r.builder.Table())
+	if fields, values := r.builder.Values(&upserted, &args); fields != "" && values != "" {
+		query += fmt.Sprintf(" (%s) VALUES %s", fields, values)
+	}
+	query += fmt.Sprintf(" ON DUPLICATE KEY UPDATE %s", set)
+
+	slog.Info("Executing Upsert query", slog.String("query", query), slog.Any("args", args))
+
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		slog.Error("Error executing Upsert query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
 		return nil, err
 	}
 
+	// Read the upserted records by their conflict fields, in the order of the models
+	result := []Model{}
+	for _, model := range upserted {
+		getArgs := []any{}
+		getWhere := r.builder.Match(model, conflicts)
+		getQuery := fmt.Sprintf("SELECT %s FROM %s WHERE %s", r.builder.Fields(""), r.builder.Table(), r.builder.Where(&getWhere, &getArgs, nil))
+
+		slog.Info("Executing Upsert query", slog.String("query", getQuery), slog.Any("args", getArgs))
+
+		items, err := r.builder.Scan(tx.QueryContext(ctx, getQuery, getArgs...))
+		if err != nil {
+			slog.Error("Error executing Upsert query", slog.String("query", getQuery), slog.Any("args", getArgs), slog.Any("error", err))
+			return nil, err
+		}
+
+		result = append(result, items...)
+	}
+
 	return result, nil
 }
 
 // Delete removes records from the database based on the provided filters
 func (r *MySQLRepository[Model]) Delete(ctx context.Context, where *map[string]any) ([]Model, error) {
+	// Soft deleted models are marked as deleted instead
+	if r.builder.SoftDelete() {
+		args := []any{}
+		return r.modify(ctx, where, r.builder.Trash(false, &args), args)
+	}
+
 	// Begin a transaction
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -239,3 +644,139 @@ func (r *MySQLRepository[Model]) Delete(ctx context.Context, where *map[string]a
 
 	return result, nil
 }
+
+// Restore restores the soft deleted records matching the provided filters
+func (r *MySQLRepository[Model]) Restore(ctx context.Context, where *map[string]any) ([]Model, error) {
+	if !r.builder.SoftDelete() {
+		return nil, fmt.Errorf("soft delete of %s not enabled", r.builder.Table())
+	}
+
+	args := []any{}
+	return r.modify(ctx, scoped(where, "only"), r.builder.Trash(true, &args), args)
+}
+
+// Patch updates the fields of the patch in the records matching the provided filters, using a single UPDATE query
+func (r *MySQLRepository[Model]) Patch(ctx context.Context, where *map[string]any, patch *Patch[Model]) ([]Model, error) {
+	args := []any{}
+	return r.modify(ctx, where, r.builder.Patch(patch, &args), args)
+}
+
+// Updates the records matching the provided filters with the SET clause, its arguments precede the filter arguments
+// MySQL has no RETURNING clause, so the matching records are selected before and after the update by their primary keys
+// The matching records are locked until the update, so the filters like the version tests still hold when they are updated
+func (r *MySQLRepository[Model]) modify(ctx context.Context, where *map[string]any, set string, args []any) ([]Model, error) {
+	// Begin a transaction
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("Error starting transaction for Modify", slog.Any("error", err))
+		return nil, err
+	}
+
+	keyArgs := []any{}
+	keyQuery := fmt.Sprintf("SELECT %s FROM %s", r.builder.Fields(""), r.builder.Table())
+	if expr := r.builder.Where(where, &keyArgs, nil); expr != "" {
+		keyQuery += fmt.Sprintf(" WHERE %s", expr)
+	}
+	keyQuery += " FOR UPDATE"
+
+	slog.Info("Executing Modify query", slog.String("query", keyQuery), slog.Any("args", keyArgs))
+
+	// Execute the query and scan the matching records
+	models, err := r.builder.Scan(tx.QueryContext(ctx, keyQuery, keyArgs...))
+	if err != nil || len(models) <= 0 {
+		if err != nil {
+			slog.Error("Error executing Modify query", slog.String("query", keyQuery), slog.Any("args", keyArgs), slog.Any("error", err))
+		}
+		tx.Rollback()
+		return models, err
+	}
+
+	// Match the records by their primary keys, including the soft deleted ones
+	items := []any{}
+	for _, model := range models {
+		items = append(items, r.builder.Key(model))
+	}
+	keys := map[string]any{"_or": items}
+
+	query := fmt.Sprintf("UPDATE %s SET %s", r.builder.Table(), set)
+	if expr := r.builder.Where(scoped(&keys, "with"), &args, nil); expr != "" {
+		query += fmt.Sprintf(" WHERE %s", expr)
+	}
+
+	slog.Info("Executing Modify query", slog.String("query", query), slog.Any("args", args))
+
+	// Execute the query
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		slog.Error("Error executing Modify query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
+		tx.Rollback()
+		return nil, err
+	}
+
+	getArgs := []any{}
+	getQuery := fmt.Sprintf("SELECT %s FROM %s", r.builder.Fields(""), r.builder.Table())
+	if expr := r.builder.Where(scoped(&keys, "with"), &getArgs, nil); expr != "" {
+		getQuery += fmt.Sprintf(" WHERE %s", expr)
+	}
+
+	slog.Info("Executing Modify query", slog.String("query", getQuery), slog.Any("args", getArgs))
+
+	// Execute the query and scan the results
+	result, err := r.builder.Scan(tx.QueryContext(ctx, getQuery, getArgs...))
+	if err != nil {
+		slog.Error("Error executing Modify query", slog.String("query", getQuery), slog.Any("args", getArgs), slog.Any("error", err))
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		slog.Error("Error committing transaction for Modify", slog.Any("error", err))
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Link links the related records to the record through the join table of a many-to-many relation
+func (r *MySQLRepository[Model]) Link(ctx context.Context, relation string, id string, ids []string) (int, error) {
+	args := []any{}
+	query, err := r.builder.Link(relation, id, values(ids), &args)
+	if err != nil {
+		slog.Error("Error constructing Link query", slog.String("relation", relation), slog.Any("error", err))
+		return 0, err
+	}
+
+	slog.Info("Executing Link query", slog.String("query", query), slog.Any("args", args))
+
+	// Execute the query and count the affected rows
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		slog.Error("Error executing Link query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
+		return 0, err
+	}
+
+	count, err := result.RowsAffected()
+	return int(count), err
+}
+
+// Unlink unlinks the related records from the record through the join table of a many-to-many relation
+func (r *MySQLRepository[Model]) Unlink(ctx context.Context, relation string, id string, ids []string) (int, error) {
+	args := []any{}
+	query, err := r.builder.Unlink(relation, id, values(ids), &args)
+	if err != nil {
+		slog.Error("Error constructing Unlink query", slog.String("relation", relation), slog.Any("error", err))
+		return 0, err
+	}
+
+	slog.Info("Executing Unlink query", slog.String("query", query), slog.Any("args", args))
+
+	// Execute the query and count the affected rows
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		slog.Error("Error executing Unlink query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
+		return 0, err
+	}
+
+	count, err := result.RowsAffected()
+	return int(count), err
+}
@@ -3,10 +3,13 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"log/slog"
 	"reflect"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // PostgresRepository provides CRUD operations for Postgres
@@ -17,6 +20,11 @@ type PostgresRepository[Model any] struct {
 
 // NewPostgresRepository initializes a new PostgresRepository
 func NewPostgresRepository[Model any](db *sql.DB) *PostgresRepository[Model] {
+	// Escape the LIKE wildcards of a parameter
+	escape := func(value string) string {
+		return fmt.Sprintf("REPLACE(REPLACE(REPLACE(%s,'!','!!'),'%%','!%%'),'_','!_')", value)
+	}
+
 	// Define SQL operators and helper functions for query building
 	operations := map[string]func(string, ...string) string{
 		"_eq":     func(key string, values ...string) string { return fmt.Sprintf("%s = %s", key, values[0]) },
@@ -35,6 +43,70 @@ func NewPostgresRepository[Model any](db *sql.DB) *PostgresRepository[Model] {
 		"_nin": func(key string, values ...string) string {
 			return fmt.Sprintf("%s NOT IN (%s)", key, strings.Join(values, ","))
 		},
+		"_is_null": func(key string, values ...string) string {
+			if values[0] == "true" {
+				return fmt.Sprintf("%s IS NULL", key)
+			}
+			return fmt.Sprintf("%s IS NOT NULL", key)
+		},
+		"_between": func(key string, values ...string) string {
+			return fmt.Sprintf("%s BETWEEN %s AND %s", key, values[0], values[1])
+		},
+		"_nbetween": func(key string, values ...string) string {
+			return fmt.Sprintf("%s NOT BETWEEN %s AND %s", key, values[0], values[1])
+		},
+		"_starts_with": func(key string, values ...string) string {
+			return fmt.Sprintf("%s LIKE %s || '%%' ESCAPE '!'", key, escape(values[0]))
+		},
+		"_ends_with": func(key string, values ...string) string {
+			return fmt.Sprintf("%s LIKE '%%' || %s ESCAPE '!'", key, escape(values[0]))
+		},
+		"_contains": func(key string, values ...string) string {
+			return fmt.Sprintf("%s LIKE '%%' || %s || '%%' ESCAPE '!'", key, escape(values[0]))
+		},
+
+		// Full-text search of the searchable columns, it is always available
+		"_search": func(key string, values ...string) string {
+			return fmt.Sprintf("to_tsvector(concat_ws(' ', %s)) @@ plainto_tsquery(%s)", strings.Join(values[2:], ","), values[0])
+		},
+		"_rank": func(key string, values ...string) string {
+			return fmt.Sprintf("ts_rank(to_tsvector(concat_ws(' ', %s)), plainto_tsquery(%s))", strings.Join(values[2:], ","), values[0])
+		},
+
+		// Value of a JSON path as text, cast to the kind of the operands
+		"_path": func(key string, values ...string) string {
+			expr := fmt.Sprintf("(jsonb_path_query_first(CAST(%s AS jsonb), CAST(%s AS jsonpath)) #>> '{}')", key, values[0])
+			switch values[1] {
+			case "number":
+				return fmt.Sprintf("CAST(%s AS numeric)", expr)
+			case "boolean":
+				return fmt.Sprintf("CAST(%s AS boolean)", expr)
+			}
+			return expr
+		},
+
+		// Containment operations of the native array columns
+		"_array_contains":     func(key string, values ...string) string { return fmt.Sprintf("%s @> %s", key, values[0]) },
+		"_array_contained_by": func(key string, values ...string) string { return fmt.Sprintf("%s <@ %s", key, values[0]) },
+		"_array_overlaps":     func(key string, values ...string) string { return fmt.Sprintf("%s && %s", key, values[0]) },
+
+		// Aggregate functions of the metrics
+		"_metric_count": func(key string, values ...string) string { return fmt.Sprintf("COUNT(%s)", key) },
+		"_metric_sum":   func(key string, values ...string) string { return fmt.Sprintf("SUM(%s)", key) },
+		"_metric_avg":   func(key string, values ...string) string { return fmt.Sprintf("AVG(%s)", key) },
+		"_metric_min":   func(key string, values ...string) string { return fmt.Sprintf("MIN(%s)", key) },
+		"_metric_max":   func(key string, values ...string) string { return fmt.Sprintf("MAX(%s)", key) },
+
+		// Time bucket of the series as text, the time is converted to the named timezone and truncated by date_trunc
+		"_bucket": func(key string, values ...string) string {
+			return fmt.Sprintf("to_char(date_trunc('%s', CAST(%s AS timestamptz) AT TIME ZONE %s), 'YYYY-MM-DD HH24:MI:SS')", values[0], key, values[1])
+		},
+
+		// Sort directions with NULLS placement
+		"_asc_nulls_first":  func(key string, values ...string) string { return fmt.Sprintf("%s ASC NULLS FIRST", key) },
+		"_asc_nulls_last":   func(key string, values ...string) string { return fmt.Sprintf("%s ASC NULLS LAST", key) },
+		"_desc_nulls_first": func(key string, values ...string) string { return fmt.Sprintf("%s DESC NULLS FIRST", key) },
+		"_desc_nulls_last":  func(key string, values ...string) string { return fmt.Sprintf("%s DESC NULLS LAST", key) },
 	}
 	identifier := func(name string) string {
 		return fmt.Sprintf("\"%s\"", name)
@@ -44,20 +116,27 @@ func NewPostgresRepository[Model any](db *sql.DB) *PostgresRepository[Model] {
 		return fmt.Sprintf("$%d", len(*args))
 	}
 
-	return &PostgresRepository[Model]{
+	result := &PostgresRepository[Model]{
 		db:      db,
-		builder: NewSQLBuilder[Model](operations, identifier, parameter, nil),
+		builder: NewSQLBuilder[Model](operations, identifier, parameter),
 	}
+	result.builder.writer = result
+	result.builder.arrays = func(value reflect.Value) any { return pgArray{value} }
+	result.builder.FullText(true)
+
+	return result
 }
 
 // Get retrieves records from the database based on the provided filters
-func (r *PostgresRepository[Model]) Get(ctx context.Context, where *map[string]any, order *map[string]any, limit *int, skip *int) ([]Model, error) {
+func (r *PostgresRepository[Model]) Get(ctx context.Context, where *map[string]any, order *[]map[string]any, limit *int, skip *int, fields *[]string, include *[]string) ([]Model, error) {
+	builder := r.builder.Select(fields, include)
+
 	args := []any{}
-	query := fmt.Sprintf("SELECT %s FROM %s", r.builder.Fields(""), r.builder.Table())
-	if expr := r.builder.Where(where, &args, nil); expr != "" {
+	query := fmt.Sprintf("SELECT %s FROM %s", builder.Fields(""), builder.Table())
+	if expr := builder.Where(where, &args, nil); expr != "" {
 		query += fmt.Sprintf(" WHERE %s", expr)
 	}
-	if expr := r.builder.Order(order); expr != "" {
+	if expr := builder.Order(order, &args); expr != "" {
 		query += fmt.Sprintf(" ORDER BY %s", expr)
 	}
 	if limit != nil && *limit > 0 {
@@ -70,19 +149,135 @@ func (r *PostgresRepository[Model]) Get(ctx context.Context, where *map[string]a
 	slog.Info("Executing Get query", slog.String("query", query), slog.Any("args", args))
 
 	// Execute the query and scan the results
-	result, err := r.builder.Scan(r.db.QueryContext(ctx, query, args...))
+	result, err := builder.Scan(r.db.QueryContext(ctx, query, args...))
 	if err != nil {
 		slog.Error("Error executing Get query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
 		return nil, err
 	}
 
+	// Load the included relations of the results
+	if err := builder.Include(ctx, &result, include, func(query string, args ...any) (*sql.Rows, error) {
+		return r.db.QueryContext(ctx, query, args...)
+	}); err != nil {
+		slog.Error("Error loading included relations", slog.Any("include", include), slog.Any("error", err))
+		return nil, err
+	}
+
 	return result, nil
 }
 
-// Put updates existing records in the database
-func (r *PostgresRepository[Model]) Put(ctx context.Context, models *[]Model) ([]Model, error) {
-	result := []Model{}
+// Count returns the number of records matching the provided filters
+func (r *PostgresRepository[Model]) Count(ctx context.Context, where *map[string]any) (int, error) {
+	args := []any{}
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s", r.builder.Table())
+	if expr := r.builder.Where(where, &args, nil); expr != "" {
+		query += fmt.Sprintf(" WHERE %s", expr)
+	}
+
+	slog.Info("Executing Count query", slog.String("query", query), slog.Any("args", args))
+
+	// Execute the query and scan the result
+	var result int
+	if err := r.db.QueryRowContext(ctx, query, args...).Scan(&result); err != nil {
+		slog.Error("Error executing Count query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
+		return 0, err
+	}
+
+	return result, nil
+}
+
+// Aggregate returns the metrics of the records matching the provided filters, grouped by the provided fields
+func (r *PostgresRepository[Model]) Aggregate(ctx context.Context, where *map[string]any, group *[]string, metrics *[]string) ([]map[string]any, error) {
+	args := []any{}
+	fields, groups := r.builder.Aggregate(group, metrics)
+	query := fmt.Sprintf("SELECT %s FROM %s", fields, r.builder.Table())
+	if expr := r.builder.Where(where, &args, nil); expr != "" {
+		query += fmt.Sprintf(" WHERE %s", expr)
+	}
+	if groups != "" {
+		query += fmt.Sprintf(" GROUP BY %s ORDER BY %s", groups, groups)
+	}
+
+	slog.Info("Executing Aggregate query", slog.String("query", query), slog.Any("args", args))
+
+	// Execute the query and scan the results
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	result, err := r.builder.Aggregates(rows, err, group, metrics)
+	if err != nil {
+		slog.Error("Error executing Aggregate query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Facets returns the distinct values of the fields with their counts among the records matching the provided filters
+// The most frequent values come first, at most limit values are returned for each field
+func (r *PostgresRepository[Model]) Facets(ctx context.Context, where *map[string]any, fields *[]string, limit int) (map[string][]Facet, error) {
+	result := map[string][]Facet{}
+	if fields == nil {
+		return result, nil
+	}
+
+	for _, field := range *fields {
+		args := []any{}
+		group, metrics := []string{field}, []string{"count"}
+		selected, groups := r.builder.Aggregate(&group, &metrics)
+		query := fmt.Sprintf("SELECT %s FROM %s", selected, r.builder.Table())
+		if expr := r.builder.Where(where, &args, nil); expr != "" {
+			query += fmt.Sprintf(" WHERE %s", expr)
+		}
+		query += fmt.Sprintf(" GROUP BY %s ORDER BY COUNT(*) DESC, %s ASC", groups, groups)
+		if limit > 0 {
+			query += fmt.Sprintf(" LIMIT %d", limit)
+		}
 
+		slog.Info("Executing Facets query", slog.String("query", query), slog.Any("args", args))
+
+		// Execute the query and scan the results
+		rows, err := r.db.QueryContext(ctx, query, args...)
+		items, err := r.builder.Aggregates(rows, err, &group, &metrics)
+		if err != nil {
+			slog.Error("Error executing Facets query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
+			return nil, err
+		}
+
+		result[field] = facets(field, items)
+	}
+
+	return result, nil
+}
+
+// Series returns the count or the sum of the records matching the provided filters by time buckets of the field
+func (r *PostgresRepository[Model]) Series(ctx context.Context, where *map[string]any, field string, interval string, location *time.Location, metric string) ([]Bucket, error) {
+	args := []any{}
+	bucket, err := r.builder.Bucket(field, interval, location)
+	if err != nil {
+		slog.Error("Error constructing Series bucket", slog.String("timezone", location.String()), slog.Any("error", err))
+		return nil, err
+	}
+	value, _, _ := r.builder.metric(metric)
+	query := fmt.Sprintf("SELECT %s,%s FROM %s", bucket, value, r.builder.Table())
+	if expr := r.builder.Where(where, &args, nil); expr != "" {
+		query += fmt.Sprintf(" WHERE %s", expr)
+	}
+	query += fmt.Sprintf(" GROUP BY %s ORDER BY %s", bucket, bucket)
+
+	slog.Info("Executing Series query", slog.String("query", query), slog.Any("args", args))
+
+	// Execute the query and scan the results
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	result, err := r.builder.Series(rows, err, interval, location)
+	if err != nil {
+		slog.Error("Error executing Series query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Put updates existing records in the database with their nested relations
+func (r *PostgresRepository[Model]) Put(ctx context.Context, models *[]Model) ([]Model, error) {
 	// Begin a transaction
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -90,6 +285,79 @@ func (r *PostgresRepository[Model]) Put(ctx context.Context, models *[]Model) ([
 		return nil, err
 	}
 
+	// Update the models and their relations
+	result, err := r.builder.Save(ctx, tx, models, true)
+	if err != nil {
+		slog.Error("Error saving models for Put", slog.Any("error", err))
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		slog.Error("Error committing transaction for Put", slog.Any("error", err))
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Post inserts new records into the database with their nested relations
+func (r *PostgresRepository[Model]) Post(ctx context.Context, models *[]Model) ([]Model, error) {
+	// Begin a transaction
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("Error starting transaction for Post", slog.Any("error", err))
+		return nil, err
+	}
+
+	// Insert the models and their relations
+	result, err := r.builder.Save(ctx, tx, models, false)
+	if err != nil {
+		slog.Error("Error saving models for Post", slog.Any("error", err))
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		slog.Error("Error committing transaction for Post", slog.Any("error", err))
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Upsert inserts the records, the records conflicting with the existing records update them instead
+func (r *PostgresRepository[Model]) Upsert(ctx context.Context, models *[]Model, conflict *Conflict) ([]Model, error) {
+	// Begin a transaction
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("Error starting transaction for Upsert", slog.Any("error", err))
+		return nil, err
+	}
+
+	// Upsert the models and their relations
+	result, err := r.builder.Upsert(ctx, tx, models, conflict)
+	if err != nil {
+		slog.Error("Error saving models for Upsert", slog.Any("error", err))
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		slog.Error("Error committing transaction for Upsert", slog.Any("error", err))
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// update executes the UPDATE queries of the models inside the transaction
+func (r *PostgresRepository[Model]) update(ctx context.Context, tx *sql.Tx, models *[]Model) ([]Model, error) {
+	result := []Model{}
+
 	// Update each model in the database
 	for _, model := range *models {
 		args := []any{}
@@ -105,37 +373,68 @@ func (r *PostgresRepository[Model]) Put(ctx context.Context, models *[]Model) ([
 		items, err := r.builder.Scan(tx.QueryContext(ctx, query, args...))
 		if err != nil {
 			slog.Error("Error executing Put query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
-			tx.Rollback()
 			return nil, err
 		}
 
 		result = append(result, items...)
 	}
 
-	// Commit the transaction
-	if err := tx.Commit(); err != nil {
-		slog.Error("Error committing transaction for Put", slog.Any("error", err))
+	return result, nil
+}
+
+// insert executes the INSERT query of the models inside the transaction
+func (r *PostgresRepository[Model]) insert(ctx context.Context, tx *sql.Tx, models *[]Model) ([]Model, error) {
+	args := []any{}
+	query := fmt.Sprintf("INSERT INTO %s", r.builder.Table())
+	if fields, values := r.builder.Values(models, &args); fields != "" && values != "" {
+		query += fmt.Sprintf(" (%s) VALUES %s", fields, values)
+	}
+	query += fmt.Sprintf(" RETURNING %s", r.builder.Fields(""))
+
+	slog.Info("Executing Post query", slog.String("query", query), slog.Any("args", args))
+
+	// Execute the query and scan the results
+	result, err := r.builder.Scan(tx.QueryContext(ctx, query, args...))
+	if err != nil {
+		slog.Error("Error executing Post query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
 		return nil, err
 	}
 
 	return result, nil
 }
 
-// Post inserts new records into the database
-func (r *PostgresRepository[Model]) Post(ctx context.Context, models *[]Model) ([]Model, error) {
+// upsert executes the INSERT ON CONFLICT query of the models inside the transaction
+func (r *PostgresRepository[Model]) upsert(ctx context.Context, tx *sql.Tx, models *[]Model, conflict *Conflict) ([]Model, error) {
+	// Inserted values are referenced by the EXCLUDED table
+	conflicts, set, condition, err := r.builder.Conflict(conflict, func(name string) string {
+		return "EXCLUDED." + r.builder.identifier(name)
+	}, func(name string) string {
+		return r.builder.Table() + "." + r.builder.identifier(name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for idx := range conflicts {
+		conflicts[idx] = r.builder.identifier(conflicts[idx])
+	}
+
 	args := []any{}
 	query := fmt.Sprintf("INSERT INTO %s", r.builder.Table())
-	if fields, values := r.builder.Values(models, &args, nil); fields != "" && values != "" {
+	if fields, values := r.builder.Values(models, &args); fields != "" && values != "" {
 		query += fmt.Sprintf(" (%s) VALUES %s", fields, values)
 	}
+	query += fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(conflicts, ","), set)
+	if condition != "" {
+		query += fmt.Sprintf(" WHERE %s", condition)
+	}
 	query += fmt.Sprintf(" RETURNING %s", r.builder.Fields(""))
 
-	slog.Info("Executing Post query", slog.String("query", query), slog.Any("args", args))
+	slog.Info("Executing Upsert query", slog.String("query", query), slog.Any("args", args))
 
 	// Execute the query and scan the results
-	result, err := r.builder.Scan(r.db.QueryContext(ctx, query, args...))
+	result, err := r.builder.Scan(tx.QueryContext(ctx, query, args...))
 	if err != nil {
-		slog.Error("Error executing Post query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
+		slog.Error("Error executing Upsert query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
 		return nil, err
 	}
 
@@ -144,6 +443,12 @@ func (r *PostgresRepository[Model]) Post(ctx context.Context, models *[]Model) (
 
 // Delete removes records from the database based on the provided filters
 func (r *PostgresRepository[Model]) Delete(ctx context.Context, where *map[string]any) ([]Model, error) {
+	// Soft deleted models are marked as deleted instead
+	if r.builder.SoftDelete() {
+		args := []any{}
+		return r.modify(ctx, where, r.builder.Trash(false, &args), args)
+	}
+
 	args := []any{}
 	query := fmt.Sprintf("DELETE FROM %s", r.builder.Table())
 	if expr := r.builder.Where(where, &args, nil); expr != "" {
@@ -162,3 +467,186 @@ func (r *PostgresRepository[Model]) Delete(ctx context.Context, where *map[strin
 
 	return result, nil
 }
+
+// Restore restores the soft deleted records matching the provided filters
+func (r *PostgresRepository[Model]) Restore(ctx context.Context, where *map[string]any) ([]Model, error) {
+	if !r.builder.SoftDelete() {
+		return nil, fmt.Errorf("soft delete of %s not enabled", r.builder.Table())
+	}
+
+	args := []any{}
+	return r.modify(ctx, scoped(where, "only"), r.builder.Trash(true, &args), args)
+}
+
+// Patch updates the fields of the patch in the records matching the provided filters, using a single UPDATE query
+func (r *PostgresRepository[Model]) Patch(ctx context.Context, where *map[string]any, patch *Patch[Model]) ([]Model, error) {
+	args := []any{}
+	return r.modify(ctx, where, r.builder.Patch(patch, &args), args)
+}
+
+// Updates the records matching the provided filters with the SET clause, its arguments precede the filter arguments
+func (r *PostgresRepository[Model]) modify(ctx context.Context, where *map[string]any, set string, args []any) ([]Model, error) {
+	query := fmt.Sprintf("UPDATE %s SET %s", r.builder.Table(), set)
+	if expr := r.builder.Where(where, &args, nil); expr != "" {
+		query += fmt.Sprintf(" WHERE %s", expr)
+	}
+	query += fmt.Sprintf(" RETURNING %s", r.builder.Fields(""))
+
+	slog.Info("Executing Modify query", slog.String("query", query), slog.Any("args", args))
+
+	// Execute the query and scan the results
+	result, err := r.builder.Scan(r.db.QueryContext(ctx, query, args...))
+	if err != nil {
+		slog.Error("Error executing Modify query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Link links the related records to the record through the join table of a many-to-many relation
+func (r *PostgresRepository[Model]) Link(ctx context.Context, relation string, id string, ids []string) (int, error) {
+	args := []any{}
+	query, err := r.builder.Link(relation, id, values(ids), &args)
+	if err != nil {
+		slog.Error("Error constructing Link query", slog.String("relation", relation), slog.Any("error", err))
+		return 0, err
+	}
+
+	slog.Info("Executing Link query", slog.String("query", query), slog.Any("args", args))
+
+	// Execute the query and count the affected rows
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		slog.Error("Error executing Link query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
+		return 0, err
+	}
+
+	count, err := result.RowsAffected()
+	return int(count), err
+}
+
+// Unlink unlinks the related records from the record through the join table of a many-to-many relation
+func (r *PostgresRepository[Model]) Unlink(ctx context.Context, relation string, id string, ids []string) (int, error) {
+	args := []any{}
+	query, err := r.builder.Unlink(relation, id, values(ids), &args)
+	if err != nil {
+		slog.Error("Error constructing Unlink query", slog.String("relation", relation), slog.Any("error", err))
+		return 0, err
+	}
+
+	slog.Info("Executing Unlink query", slog.String("query", query), slog.Any("args", args))
+
+	// Execute the query and count the affected rows
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		slog.Error("Error executing Unlink query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
+		return 0, err
+	}
+
+	count, err := result.RowsAffected()
+	return int(count), err
+}
+
+// Encodes a slice into a Postgres array literal and decodes it back
+// The value is the field when writing and the address of the field when scanning
+type pgArray struct {
+	value reflect.Value
+}
+
+func (a pgArray) Value() (driver.Value, error) {
+	if a.value.IsNil() {
+		return nil, nil
+	}
+
+	items := []string{}
+	for i := range a.value.Len() {
+		item := a.value.Index(i)
+		if item.Kind() == reflect.String {
+			// Quote the text items, so they may contain delimiters
+			items = append(items, `"`+strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(item.String())+`"`)
+		} else {
+			items = append(items, fmt.Sprint(item.Interface()))
+		}
+	}
+
+	return "{" + strings.Join(items, ",") + "}", nil
+}
+
+func (a pgArray) Scan(src any) error {
+	var text string
+	switch src := src.(type) {
+	case nil:
+		a.value.Elem().SetZero()
+		return nil
+	case []byte:
+		text = string(src)
+	case string:
+		text = src
+	default:
+		return fmt.Errorf("unsupported array column value %T", src)
+	}
+
+	// Split the array literal into its items, NULL items are kept as zero values
+	_type := a.value.Elem().Type()
+	result := reflect.MakeSlice(_type, 0, 0)
+	text = strings.TrimSuffix(strings.TrimPrefix(text, "{"), "}")
+	for len(text) > 0 {
+		item, quoted := "", false
+		if text[0] == '"' {
+			// Quoted items end at the next unescaped quote
+			builder := strings.Builder{}
+			idx := 1
+			for ; idx < len(text) && text[idx] != '"'; idx++ {
+				if text[idx] == '\\' && idx+1 < len(text) {
+					idx++
+				}
+				builder.WriteByte(text[idx])
+			}
+			item, quoted, text = builder.String(), true, text[min(idx+1, len(text)):]
+		} else if idx := strings.IndexByte(text, ','); idx >= 0 {
+			item, text = text[:idx], text[idx:]
+		} else {
+			item, text = text, ""
+		}
+		text = strings.TrimPrefix(text, ",")
+
+		value := reflect.New(_type.Elem()).Elem()
+		if quoted || item != "NULL" {
+			if err := parseScalar(item, value); err != nil {
+				return err
+			}
+		}
+		result = reflect.Append(result, value)
+	}
+
+	a.value.Elem().Set(result)
+	return nil
+}
+
+// Parses the text of an array item into the value based on its kind
+func parseScalar(text string, value reflect.Value) error {
+	switch value.Kind() {
+	case reflect.Bool:
+		result, err := strconv.ParseBool(text)
+		value.SetBool(result)
+		return err
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		result, err := strconv.ParseInt(text, 10, 64)
+		value.SetInt(result)
+		return err
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		result, err := strconv.ParseUint(text, 10, 64)
+		value.SetUint(result)
+		return err
+	case reflect.Float32, reflect.Float64:
+		result, err := strconv.ParseFloat(text, 64)
+		value.SetFloat(result)
+		return err
+	case reflect.String:
+		value.SetString(text)
+		return nil
+	}
+
+	return fmt.Errorf("unsupported array item kind %s", value.Kind())
+}
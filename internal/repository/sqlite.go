@@ -7,34 +7,126 @@ import (
 	"log/slog"
 	"reflect"
 	"strings"
+	"sync"
+	"time"
 )
 
 // SQLiteRepository provides CRUD operations for SQLite
 type SQLiteRepository[Model any] struct {
-	db      *sql.DB
-	builder *SQLBuilder[Model]
+	db       *sql.DB
+	builder  *SQLBuilder[Model]
+	detect   sync.Mutex
+	detected bool
 }
 
 // NewSQLiteRepository initializes a new SQLiteRepository
 func NewSQLiteRepository[Model any](db *sql.DB) *SQLiteRepository[Model] {
+	// Escape the LIKE wildcards of a parameter
+	escape := func(value string) string {
+		return fmt.Sprintf("REPLACE(REPLACE(REPLACE(%s,'!','!!'),'%%','!%%'),'_','!_')", value)
+	}
+
 	// Define SQL operators and helper functions for query building
 	operations := map[string]func(string, ...string) string{
-		"_eq":     func(key string, values ...string) string { return fmt.Sprintf("%s = %s", key, values[0]) },
-		"_neq":    func(key string, values ...string) string { return fmt.Sprintf("%s != %s", key, values[0]) },
-		"_gt":     func(key string, values ...string) string { return fmt.Sprintf("%s > %s", key, values[0]) },
-		"_gte":    func(key string, values ...string) string { return fmt.Sprintf("%s >= %s", key, values[0]) },
-		"_lt":     func(key string, values ...string) string { return fmt.Sprintf("%s < %s", key, values[0]) },
-		"_lte":    func(key string, values ...string) string { return fmt.Sprintf("%s <= %s", key, values[0]) },
-		"_like":   func(key string, values ...string) string { return fmt.Sprintf("%s LIKE %s", key, values[0]) },
-		"_nlike":  func(key string, values ...string) string { return fmt.Sprintf("%s NOT LIKE %s", key, values[0]) },
-		"_ilike":  func(key string, values ...string) string { return fmt.Sprintf("%s ILIKE %s", key, values[0]) },
-		"_nilike": func(key string, values ...string) string { return fmt.Sprintf("%s NOT ILIKE %s", key, values[0]) },
+		"_eq":    func(key string, values ...string) string { return fmt.Sprintf("%s = %s", key, values[0]) },
+		"_neq":   func(key string, values ...string) string { return fmt.Sprintf("%s != %s", key, values[0]) },
+		"_gt":    func(key string, values ...string) string { return fmt.Sprintf("%s > %s", key, values[0]) },
+		"_gte":   func(key string, values ...string) string { return fmt.Sprintf("%s >= %s", key, values[0]) },
+		"_lt":    func(key string, values ...string) string { return fmt.Sprintf("%s < %s", key, values[0]) },
+		"_lte":   func(key string, values ...string) string { return fmt.Sprintf("%s <= %s", key, values[0]) },
+		"_like":  func(key string, values ...string) string { return fmt.Sprintf("%s LIKE %s", key, values[0]) },
+		"_nlike": func(key string, values ...string) string { return fmt.Sprintf("%s NOT LIKE %s", key, values[0]) },
+
+		// LIKE of SQLite ignores collations, so case-insensitive matching lowers both sides
+		"_ilike": func(key string, values ...string) string {
+			return fmt.Sprintf("LOWER(%s) LIKE LOWER(%s)", key, values[0])
+		},
+		"_nilike": func(key string, values ...string) string {
+			return fmt.Sprintf("LOWER(%s) NOT LIKE LOWER(%s)", key, values[0])
+		},
 		"_in": func(key string, values ...string) string {
 			return fmt.Sprintf("%s IN (%s)", key, strings.Join(values, ","))
 		},
 		"_nin": func(key string, values ...string) string {
 			return fmt.Sprintf("%s NOT IN (%s)", key, strings.Join(values, ","))
 		},
+		"_is_null": func(key string, values ...string) string {
+			if values[0] == "true" {
+				return fmt.Sprintf("%s IS NULL", key)
+			}
+			return fmt.Sprintf("%s IS NOT NULL", key)
+		},
+		"_between": func(key string, values ...string) string {
+			return fmt.Sprintf("%s BETWEEN %s AND %s", key, values[0], values[1])
+		},
+		"_nbetween": func(key string, values ...string) string {
+			return fmt.Sprintf("%s NOT BETWEEN %s AND %s", key, values[0], values[1])
+		},
+		"_starts_with": func(key string, values ...string) string {
+			return fmt.Sprintf("%s LIKE %s || '%%' ESCAPE '!'", key, escape(values[0]))
+		},
+		"_ends_with": func(key string, values ...string) string {
+			return fmt.Sprintf("%s LIKE '%%' || %s ESCAPE '!'", key, escape(values[0]))
+		},
+		"_contains": func(key string, values ...string) string {
+			return fmt.Sprintf("%s LIKE '%%' || %s || '%%' ESCAPE '!'", key, escape(values[0]))
+		},
+
+		// Full-text search of the FTS5 table named <table>_fts, its rowid is the key of the model
+		"_search": func(key string, values ...string) string {
+			return fmt.Sprintf("%[3]s IN (SELECT rowid FROM \"%[1]s_fts\" WHERE \"%[1]s_fts\" MATCH %[2]s)", key, values[0], values[1])
+		},
+		"_rank": func(key string, values ...string) string {
+			return fmt.Sprintf("(SELECT -bm25(\"%[1]s_fts\") FROM \"%[1]s_fts\" WHERE \"%[1]s_fts\" MATCH %[2]s AND rowid = \"%[1]s\".%[3]s)", key, values[0], values[1])
+		},
+
+		// Value of a JSON path, json_extract returns it with its native type
+		"_path": func(key string, values ...string) string {
+			return fmt.Sprintf("json_extract(%s, %s)", key, values[0])
+		},
+
+		// Containment operations of the array columns, stored as JSON arrays
+		"_array_contains": func(key string, values ...string) string {
+			return fmt.Sprintf("NOT EXISTS (SELECT 1 FROM json_each(%s) AS o WHERE o.value NOT IN (SELECT c.value FROM json_each(%s) AS c))", values[0], key)
+		},
+		"_array_contained_by": func(key string, values ...string) string {
+			return fmt.Sprintf("%[1]s IS NOT NULL AND NOT EXISTS (SELECT 1 FROM json_each(%[1]s) AS c WHERE c.value NOT IN (SELECT o.value FROM json_each(%[2]s) AS o))", key, values[0])
+		},
+		"_array_overlaps": func(key string, values ...string) string {
+			return fmt.Sprintf("EXISTS (SELECT 1 FROM json_each(%s) AS c WHERE c.value IN (SELECT o.value FROM json_each(%s) AS o))", key, values[0])
+		},
+
+		// Aggregate functions of the metrics
+		"_metric_count": func(key string, values ...string) string { return fmt.Sprintf("COUNT(%s)", key) },
+		"_metric_sum":   func(key string, values ...string) string { return fmt.Sprintf("SUM(%s)", key) },
+		"_metric_avg":   func(key string, values ...string) string { return fmt.Sprintf("AVG(%s)", key) },
+		"_metric_min":   func(key string, values ...string) string { return fmt.Sprintf("MIN(%s)", key) },
+		"_metric_max":   func(key string, values ...string) string { return fmt.Sprintf("MAX(%s)", key) },
+
+		// Time bucket of the series as text, the time is shifted by the offset minutes of the timezone and truncated by strftime
+		// The week bucket goes back 6 days and then forward to the next Monday
+		"_bucket": func(key string, values ...string) string {
+			// Times are only shifted by fixed offsets, there are no timezone rules
+			if values[3] != "true" {
+				return ""
+			}
+
+			switch values[0] {
+			case "hour":
+				return fmt.Sprintf("strftime('%%Y-%%m-%%d %%H:00:00', %s, '%s minutes')", key, values[2])
+			case "week":
+				return fmt.Sprintf("strftime('%%Y-%%m-%%d 00:00:00', %s, '%s minutes', '-6 days', 'weekday 1')", key, values[2])
+			case "month":
+				return fmt.Sprintf("strftime('%%Y-%%m-01 00:00:00', %s, '%s minutes')", key, values[2])
+			}
+			return fmt.Sprintf("strftime('%%Y-%%m-%%d 00:00:00', %s, '%s minutes')", key, values[2])
+		},
+
+		// Sort directions with NULLS placement
+		"_asc_nulls_first":  func(key string, values ...string) string { return fmt.Sprintf("%s ASC NULLS FIRST", key) },
+		"_asc_nulls_last":   func(key string, values ...string) string { return fmt.Sprintf("%s ASC NULLS LAST", key) },
+		"_desc_nulls_first": func(key string, values ...string) string { return fmt.Sprintf("%s DESC NULLS FIRST", key) },
+		"_desc_nulls_last":  func(key string, values ...string) string { return fmt.Sprintf("%s DESC NULLS LAST", key) },
 	}
 	identifier := func(name string) string {
 		return fmt.Sprintf("\"%s\"", name)
@@ -44,20 +136,58 @@ func NewSQLiteRepository[Model any](db *sql.DB) *SQLiteRepository[Model] {
 		return fmt.Sprintf("$%d", len(*args))
 	}
 
-	return &SQLiteRepository[Model]{
+	result := &SQLiteRepository[Model]{
 		db:      db,
-		builder: NewSQLBuilder[Model](operations, identifier, parameter, nil),
+		builder: NewSQLBuilder[Model](operations, identifier, parameter),
+	}
+	result.builder.writer = result
+	// NULLs are sorted before the other values in ascending order
+	result.builder.nullsFirst = true
+	// Full-text queries are parsed with the FTS5 query syntax, so the search text is quoted
+	result.builder.quoted = true
+
+	return result
+}
+
+// fulltext enables the full-text search once the FTS5 table of the model, named <table>_fts, is detected
+// Failed detections are retried by the next query
+// The rowid of the full-text table is matched to the primary key, so the models without a single integer key always fall back to LIKE
+func (r *SQLiteRepository[Model]) fulltext() {
+	if !r.builder.Searchable() || !r.builder.Rowid() {
+		return
 	}
+
+	r.detect.Lock()
+	defer r.detect.Unlock()
+	if r.detected {
+		return
+	}
+
+	// The detection outlives the request, so it doesn't use the request context
+	var count int
+	query := "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = $1"
+	if err := r.db.QueryRowContext(context.Background(), query, r.builder.table+"_fts").Scan(&count); err != nil {
+		slog.Warn("Error detecting full-text search, falling back to LIKE until the next detection", slog.Any("error", err))
+		return
+	}
+
+	slog.Debug("Detected full-text search", slog.Bool("enabled", count > 0))
+	r.detected = true
+	r.builder.FullText(count > 0)
 }
 
 // Get retrieves records from the database based on the provided filters
-func (r *SQLiteRepository[Model]) Get(ctx context.Context, where *map[string]any, order *map[string]any, limit *int, skip *int) ([]Model, error) {
+func (r *SQLiteRepository[Model]) Get(ctx context.Context, where *map[string]any, order *[]map[string]any, limit *int, skip *int, fields *[]string, include *[]string) ([]Model, error) {
+	r.fulltext()
+
+	builder := r.builder.Select(fields, include)
+
 	args := []any{}
-	query := fmt.Sprintf("SELECT %s FROM %s", r.builder.Fields(""), r.builder.Table())
-	if expr := r.builder.Where(where, &args, nil); expr != "" {
+	query := fmt.Sprintf("SELECT %s FROM %s", builder.Fields(""), builder.Table())
+	if expr := builder.Where(where, &args, nil); expr != "" {
 		query += fmt.Sprintf(" WHERE %s", expr)
 	}
-	if expr := r.builder.Order(order); expr != "" {
+	if expr := builder.Order(order, &args); expr != "" {
 		query += fmt.Sprintf(" ORDER BY %s", expr)
 	}
 	if limit != nil && *limit > 0 {
@@ -70,19 +200,143 @@ func (r *SQLiteRepository[Model]) Get(ctx context.Context, where *map[string]any
 	slog.Info("Executing Get query", slog.String("query", query), slog.Any("args", args))
 
 	// Execute the query and scan the results
-	result, err := r.builder.Scan(r.db.QueryContext(ctx, query, args...))
+	result, err := builder.Scan(r.db.QueryContext(ctx, query, args...))
 	if err != nil {
 		slog.Error("Error executing Get query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
 		return nil, err
 	}
 
+	// Load the included relations of the results
+	if err := builder.Include(ctx, &result, include, func(query string, args ...any) (*sql.Rows, error) {
+		return r.db.QueryContext(ctx, query, args...)
+	}); err != nil {
+		slog.Error("Error loading included relations", slog.Any("include", include), slog.Any("error", err))
+		return nil, err
+	}
+
 	return result, nil
 }
 
-// Put updates existing records in the database
-func (r *SQLiteRepository[Model]) Put(ctx context.Context, models *[]Model) ([]Model, error) {
-	result := []Model{}
+// Count returns the number of records matching the provided filters
+func (r *SQLiteRepository[Model]) Count(ctx context.Context, where *map[string]any) (int, error) {
+	r.fulltext()
+
+	args := []any{}
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s", r.builder.Table())
+	if expr := r.builder.Where(where, &args, nil); expr != "" {
+		query += fmt.Sprintf(" WHERE %s", expr)
+	}
+
+	slog.Info("Executing Count query", slog.String("query", query), slog.Any("args", args))
+
+	// Execute the query and scan the result
+	var result int
+	if err := r.db.QueryRowContext(ctx, query, args...).Scan(&result); err != nil {
+		slog.Error("Error executing Count query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
+		return 0, err
+	}
+
+	return result, nil
+}
+
+// Aggregate returns the metrics of the records matching the provided filters, grouped by the provided fields
+func (r *SQLiteRepository[Model]) Aggregate(ctx context.Context, where *map[string]any, group *[]string, metrics *[]string) ([]map[string]any, error) {
+	r.fulltext()
+
+	args := []any{}
+	fields, groups := r.builder.Aggregate(group, metrics)
+	query := fmt.Sprintf("SELECT %s FROM %s", fields, r.builder.Table())
+	if expr := r.builder.Where(where, &args, nil); expr != "" {
+		query += fmt.Sprintf(" WHERE %s", expr)
+	}
+	if groups != "" {
+		query += fmt.Sprintf(" GROUP BY %s ORDER BY %s", groups, groups)
+	}
+
+	slog.Info("Executing Aggregate query", slog.String("query", query), slog.Any("args", args))
+
+	// Execute the query and scan the results
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	result, err := r.builder.Aggregates(rows, err, group, metrics)
+	if err != nil {
+		slog.Error("Error executing Aggregate query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Facets returns the distinct values of the fields with their counts among the records matching the provided filters
+// The most frequent values come first, at most limit values are returned for each field
+func (r *SQLiteRepository[Model]) Facets(ctx context.Context, where *map[string]any, fields *[]string, limit int) (map[string][]Facet, error) {
+	r.fulltext()
+
+	result := map[string][]Facet{}
+	if fields == nil {
+		return result, nil
+	}
+
+	for _, field := range *fields {
+		args := []any{}
+		group, metrics := []string{field}, []string{"count"}
+		selected, groups := r.builder.Aggregate(&group, &metrics)
+		query := fmt.Sprintf("SELECT %s FROM %s", selected, r.builder.Table())
+		if expr := r.builder.Where(where, &args, nil); expr != "" {
+			query += fmt.Sprintf(" WHERE %s", expr)
+		}
+		query += fmt.Sprintf(" GROUP BY %s ORDER BY COUNT(*) DESC, %s ASC", groups, groups)
+		if limit > 0 {
+			query += fmt.Sprintf(" LIMIT %d", limit)
+		}
+
+		slog.Info("Executing Facets query", slog.String("query", query), slog.Any("args", args))
+
+		// Execute the query and scan the results
+		rows, err := r.db.QueryContext(ctx, query, args...)
+		items, err := r.builder.Aggregates(rows, err, &group, &metrics)
+		if err != nil {
+			slog.Error("Error executing Facets query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
+			return nil, err
+		}
+
+		result[field] = facets(field, items)
+	}
+
+	return result, nil
+}
+
+// Series returns the count or the sum of the records matching the provided filters by time buckets of the field
+func (r *SQLiteRepository[Model]) Series(ctx context.Context, where *map[string]any, field string, interval string, location *time.Location, metric string) ([]Bucket, error) {
+	r.fulltext()
 
+	args := []any{}
+	bucket, err := r.builder.Bucket(field, interval, location)
+	if err != nil {
+		slog.Error("Error constructing Series bucket", slog.String("timezone", location.String()), slog.Any("error", err))
+		return nil, err
+	}
+	value, _, _ := r.builder.metric(metric)
+	query := fmt.Sprintf("SELECT %s,%s FROM %s", bucket, value, r.builder.Table())
+	if expr := r.builder.Where(where, &args, nil); expr != "" {
+		query += fmt.Sprintf(" WHERE %s", expr)
+	}
+	query += fmt.Sprintf(" GROUP BY %s ORDER BY %s", bucket, bucket)
+
+	slog.Info("Executing Series query", slog.String("query", query), slog.Any("args", args))
+
+	// Execute the query and scan the results
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	result, err := r.builder.Series(rows, err, interval, location)
+	if err != nil {
+		slog.Error("Error executing Series query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Put updates existing records in the database with their nested relations
+func (r *SQLiteRepository[Model]) Put(ctx context.Context, models *[]Model) ([]Model, error) {
 	// Begin a transaction
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -90,6 +344,79 @@ func (r *SQLiteRepository[Model]) Put(ctx context.Context, models *[]Model) ([]M
 		return nil, err
 	}
 
+	// Update the models and their relations
+	result, err := r.builder.Save(ctx, tx, models, true)
+	if err != nil {
+		slog.Error("Error saving models for Put", slog.Any("error", err))
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		slog.Error("Error committing transaction for Put", slog.Any("error", err))
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Post inserts new records into the database with their nested relations
+func (r *SQLiteRepository[Model]) Post(ctx context.Context, models *[]Model) ([]Model, error) {
+	// Begin a transaction
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("Error starting transaction for Post", slog.Any("error", err))
+		return nil, err
+	}
+
+	// Insert the models and their relations
+	result, err := r.builder.Save(ctx, tx, models, false)
+	if err != nil {
+		slog.Error("Error saving models for Post", slog.Any("error", err))
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		slog.Error("Error committing transaction for Post", slog.Any("error", err))
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Upsert inserts the records, the records conflicting with the existing records update them instead
+func (r *SQLiteRepository[Model]) Upsert(ctx context.Context, models *[]Model, conflict *Conflict) ([]Model, error) {
+	// Begin a transaction
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("Error starting transaction for Upsert", slog.Any("error", err))
+		return nil, err
+	}
+
+	// Upsert the models and their relations
+	result, err := r.builder.Upsert(ctx, tx, models, conflict)
+	if err != nil {
+		slog.Error("Error saving models for Upsert", slog.Any("error", err))
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		slog.Error("Error committing transaction for Upsert", slog.Any("error", err))
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// update executes the UPDATE queries of the models inside the transaction
+func (r *SQLiteRepository[Model]) update(ctx context.Context, tx *sql.Tx, models *[]Model) ([]Model, error) {
+	result := []Model{}
+
 	// Update each model in the database
 	for _, model := range *models {
 		args := []any{}
@@ -105,37 +432,68 @@ func (r *SQLiteRepository[Model]) Put(ctx context.Context, models *[]Model) ([]M
 		items, err := r.builder.Scan(tx.QueryContext(ctx, query, args...))
 		if err != nil {
 			slog.Error("Error executing Put query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
-			tx.Rollback()
 			return nil, err
 		}
 
 		result = append(result, items...)
 	}
 
-	// Commit the transaction
-	if err := tx.Commit(); err != nil {
-		slog.Error("Error committing transaction for Put", slog.Any("error", err))
+	return result, nil
+}
+
+// insert executes the INSERT query of the models inside the transaction
+func (r *SQLiteRepository[Model]) insert(ctx context.Context, tx *sql.Tx, models *[]Model) ([]Model, error) {
+	args := []any{}
+	query := fmt.Sprintf("INSERT INTO %s", r.builder.Table())
+	if fields, values := r.builder.Values(models, &args); fields != "" && values != "" {
+		query += fmt.Sprintf(" (%s) VALUES %s", fields, values)
+	}
+	query += fmt.Sprintf(" RETURNING %s", r.builder.Fields(""))
+
+	slog.Info("Executing Post query", slog.String("query", query), slog.Any("args", args))
+
+	// Execute the query and scan the results
+	result, err := r.builder.Scan(tx.QueryContext(ctx, query, args...))
+	if err != nil {
+		slog.Error("Error executing Post query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
 		return nil, err
 	}
 
 	return result, nil
 }
 
-// Post inserts new records into the database
-func (r *SQLiteRepository[Model]) Post(ctx context.Context, models *[]Model) ([]Model, error) {
+// upsert executes the INSERT ON CONFLICT query of the models inside the transaction
+func (r *SQLiteRepository[Model]) upsert(ctx context.Context, tx *sql.Tx, models *[]Model, conflict *Conflict) ([]Model, error) {
+	// Inserted values are referenced by the EXCLUDED table
+	conflicts, set, condition, err := r.builder.Conflict(conflict, func(name string) string {
+		return "EXCLUDED." + r.builder.identifier(name)
+	}, func(name string) string {
+		return r.builder.Table() + "." + r.builder.identifier(name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for idx := range conflicts {
+		conflicts[idx] = r.builder.identifier(conflicts[idx])
+	}
+
 	args := []any{}
 	query := fmt.Sprintf("INSERT INTO %s", r.builder.Table())
-	if fields, values := r.builder.Values(models, &args, nil); fields != "" && values != "" {
+	if fields, values := r.builder.Values(models, &args); fields != "" && values != "" {
 		query += fmt.Sprintf(" (%s) VALUES %s", fields, values)
 	}
+	query += fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(conflicts, ","), set)
+	if condition != "" {
+		query += fmt.Sprintf(" WHERE %s", condition)
+	}
 	query += fmt.Sprintf(" RETURNING %s", r.builder.Fields(""))
 
-	slog.Info("Executing Post query", slog.String("query", query), slog.Any("args", args))
+	slog.Info("Executing Upsert query", slog.String("query", query), slog.Any("args", args))
 
 	// Execute the query and scan the results
-	result, err := r.builder.Scan(r.db.QueryContext(ctx, query, args...))
+	result, err := r.builder.Scan(tx.QueryContext(ctx, query, args...))
 	if err != nil {
-		slog.Error("Error executing Post query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
+		slog.Error("Error executing Upsert query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
 		return nil, err
 	}
 
@@ -144,6 +502,12 @@ func (r *SQLiteRepository[Model]) Post(ctx context.Context, models *[]Model) ([]
 
 // Delete removes records from the database based on the provided filters
 func (r *SQLiteRepository[Model]) Delete(ctx context.Context, where *map[string]any) ([]Model, error) {
+	// Soft deleted models are marked as deleted instead
+	if r.builder.SoftDelete() {
+		args := []any{}
+		return r.modify(ctx, where, r.builder.Trash(false, &args), args)
+	}
+
 	args := []any{}
 	query := fmt.Sprintf("DELETE FROM %s", r.builder.Table())
 	if expr := r.builder.Where(where, &args, nil); expr != "" {
@@ -162,3 +526,83 @@ func (r *SQLiteRepository[Model]) Delete(ctx context.Context, where *map[string]
 
 	return result, nil
 }
+
+// Restore restores the soft deleted records matching the provided filters
+func (r *SQLiteRepository[Model]) Restore(ctx context.Context, where *map[string]any) ([]Model, error) {
+	if !r.builder.SoftDelete() {
+		return nil, fmt.Errorf("soft delete of %s not enabled", r.builder.Table())
+	}
+
+	args := []any{}
+	return r.modify(ctx, scoped(where, "only"), r.builder.Trash(true, &args), args)
+}
+
+// Patch updates the fields of the patch in the records matching the provided filters, using a single UPDATE query
+func (r *SQLiteRepository[Model]) Patch(ctx context.Context, where *map[string]any, patch *Patch[Model]) ([]Model, error) {
+	args := []any{}
+	return r.modify(ctx, where, r.builder.Patch(patch, &args), args)
+}
+
+// Updates the records matching the provided filters with the SET clause, its arguments precede the filter arguments
+func (r *SQLiteRepository[Model]) modify(ctx context.Context, where *map[string]any, set string, args []any) ([]Model, error) {
+	query := fmt.Sprintf("UPDATE %s SET %s", r.builder.Table(), set)
+	if expr := r.builder.Where(where, &args, nil); expr != "" {
+		query += fmt.Sprintf(" WHERE %s", expr)
+	}
+	query += fmt.Sprintf(" RETURNING %s", r.builder.Fields(""))
+
+	slog.Info("Executing Modify query", slog.String("query", query), slog.Any("args", args))
+
+	// Execute the query and scan the results
+	result, err := r.builder.Scan(r.db.QueryContext(ctx, query, args...))
+	if err != nil {
+		slog.Error("Error executing Modify query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Link links the related records to the record through the join table of a many-to-many relation
+func (r *SQLiteRepository[Model]) Link(ctx context.Context, relation string, id string, ids []string) (int, error) {
+	args := []any{}
+	query, err := r.builder.Link(relation, id, values(ids), &args)
+	if err != nil {
+		slog.Error("Error constructing Link query", slog.String("relation", relation), slog.Any("error", err))
+		return 0, err
+	}
+
+	slog.Info("Executing Link query", slog.String("query", query), slog.Any("args", args))
+
+	// Execute the query and count the affected rows
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		slog.Error("Error executing Link query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
+		return 0, err
+	}
+
+	count, err := result.RowsAffected()
+	return int(count), err
+}
+
+// Unlink unlinks the related records from the record through the join table of a many-to-many relation
+func (r *SQLiteRepository[Model]) Unlink(ctx context.Context, relation string, id string, ids []string) (int, error) {
+	args := []any{}
+	query, err := r.builder.Unlink(relation, id, values(ids), &args)
+	if err != nil {
+		slog.Error("Error constructing Unlink query", slog.String("relation", relation), slog.Any("error", err))
+		return 0, err
+	}
+
+	slog.Info("Executing Unlink query", slog.String("query", query), slog.Any("args", args))
+
+	// Execute the query and count the affected rows
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		slog.Error("Error executing Unlink query", slog.String("query", query), slog.Any("args", args), slog.Any("error", err))
+		return 0, err
+	}
+
+	count, err := result.RowsAffected()
+	return int(count), err
+}
@@ -0,0 +1,133 @@
+package schema
+
+import (
+	"log/slog"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+type GroupBy[Model any] []string
+
+func (g *GroupBy[Model]) Schema(r huma.Registry) *huma.Schema {
+	// Generate the schema for the GroupBy type
+	item := &huma.Schema{
+		Type: huma.TypeString,
+		Enum: []any{},
+	}
+	schema := &huma.Schema{
+		Type:  huma.TypeArray,
+		Items: item,
+	}
+
+	// Add the scalar fields to the schema, they are the groupable fields
+	for _, _field := range aggregateFields[Model]() {
+		item.Enum = append(item.Enum, strings.Split(_field.Tag.Get("json"), ",")[0])
+	}
+
+	// Precompute messages of the items, huma only precomputes the returned schema
+	item.PrecomputeMessages()
+
+	slog.Debug("Schema generated for GroupBy", slog.Any("schema", schema))
+	return schema
+}
+
+func (g *GroupBy[Model]) Addr() *[]string {
+	return (*[]string)(g)
+}
+
+type Metrics[Model any] []string
+
+func (m *Metrics[Model]) Schema(r huma.Registry) *huma.Schema {
+	// Generate the schema for the Metrics type
+	item := &huma.Schema{
+		Type: huma.TypeString,
+		Enum: []any{"count"},
+	}
+	schema := &huma.Schema{
+		Type:  huma.TypeArray,
+		Items: item,
+	}
+
+	// Add the metrics of the scalar fields to the schema, sums and averages are only computed for numbers
+	for _, _field := range aggregateFields[Model]() {
+		name := strings.Split(_field.Tag.Get("json"), ",")[0]
+		item.Enum = append(item.Enum, "count:"+name, "min:"+name, "max:"+name)
+		if _type := ScalarSchema(_field.Type).Type; _type == huma.TypeInteger || _type == huma.TypeNumber {
+			item.Enum = append(item.Enum, "sum:"+name, "avg:"+name)
+		}
+	}
+
+	// Precompute messages of the items, huma only precomputes the returned schema
+	item.PrecomputeMessages()
+
+	slog.Debug("Schema generated for Metrics", slog.Any("schema", schema))
+	return schema
+}
+
+func (m *Metrics[Model]) Addr() *[]string {
+	return (*[]string)(m)
+}
+
+// Returns the scalar fields of the model, which can be grouped and aggregated
+func aggregateFields[Model any]() []reflect.StructField {
+	result := []reflect.StructField{}
+	_type := reflect.TypeFor[Model]()
+	for idx := range _type.NumField() {
+		_field := _type.Field(idx)
+
+		// Skip model information, relation and JSON fields
+		tag, db := _field.Tag.Get("json"), strings.Split(_field.Tag.Get("db"), ",")
+		if _field.Name == "_" || tag == "" || tag == "-" || db[0] == "" || _field.Tag.Get("table") != "" || slices.Contains(db[1:], "json") {
+			continue
+		}
+
+		if ScalarSchema(_field.Type) != nil {
+			result = append(result, _field)
+		}
+	}
+
+	return result
+}
+
+type TimeField[Model any] string
+
+func (f *TimeField[Model]) Schema(r huma.Registry) *huma.Schema {
+	// Generate the schema for the TimeField type
+	schema := &huma.Schema{
+		Type: huma.TypeString,
+		Enum: []any{},
+	}
+
+	// Add the time fields to the schema
+	for _, _field := range aggregateFields[Model]() {
+		if ScalarSchema(_field.Type).Format == "date-time" {
+			schema.Enum = append(schema.Enum, strings.Split(_field.Tag.Get("json"), ",")[0])
+		}
+	}
+
+	slog.Debug("Schema generated for TimeField", slog.Any("schema", schema))
+	return schema
+}
+
+type SeriesMetric[Model any] string
+
+func (m *SeriesMetric[Model]) Schema(r huma.Registry) *huma.Schema {
+	// Generate the schema for the SeriesMetric type
+	schema := &huma.Schema{
+		Type: huma.TypeString,
+		Enum: []any{"count"},
+	}
+
+	// Add the sums of the numeric fields to the schema
+	for _, _field := range aggregateFields[Model]() {
+		if _type := ScalarSchema(_field.Type).Type; _type == huma.TypeInteger || _type == huma.TypeNumber {
+			schema.Enum = append(schema.Enum, "sum:"+strings.Split(_field.Tag.Get("json"), ",")[0])
+		}
+	}
+
+	slog.Debug("Schema generated for SeriesMetric", slog.Any("schema", schema))
+	return schema
+}
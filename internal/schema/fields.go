@@ -0,0 +1,49 @@
+package schema
+
+import (
+	"log/slog"
+	"reflect"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+type Fields[Model any] []string
+
+func (f *Fields[Model]) Schema(r huma.Registry) *huma.Schema {
+	// Generate the schema for the Fields type
+	item := &huma.Schema{
+		Type: huma.TypeString,
+		Enum: []any{},
+	}
+	schema := &huma.Schema{
+		Type:  huma.TypeArray,
+		Items: item,
+	}
+
+	// Add the primitive fields to the schema
+	_type := reflect.TypeFor[Model]()
+	for idx := range _type.NumField() {
+		_field := _type.Field(idx)
+
+		// Skip model information field
+		if _field.Name == "_" {
+			continue
+		}
+
+		if tag := _field.Tag.Get("json"); tag != "" && tag != "-" && _field.Tag.Get("db") != "" && _field.Tag.Get("table") == "" {
+			// primitive fields detected, name it with the json tag
+			item.Enum = append(item.Enum, strings.Split(tag, ",")[0])
+		}
+	}
+
+	// Precompute messages of the items, huma only precomputes the returned schema
+	item.PrecomputeMessages()
+
+	slog.Debug("Schema generated for Fields", slog.Any("schema", schema))
+	return schema
+}
+
+func (f *Fields[Model]) Addr() *[]string {
+	return (*[]string)(f)
+}
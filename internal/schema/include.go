@@ -0,0 +1,66 @@
+package schema
+
+import (
+	"log/slog"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+type Include[Model any] []string
+
+func (i *Include[Model]) Schema(r huma.Registry) *huma.Schema {
+	// Generate the schema for the Include type
+	item := &huma.Schema{
+		Type: huma.TypeString,
+		Enum: []any{},
+	}
+	schema := &huma.Schema{
+		Type:  huma.TypeArray,
+		Items: item,
+	}
+
+	// Add the relation paths to the schema
+	for _, path := range i.Paths(reflect.TypeFor[Model](), "", []reflect.Type{reflect.TypeFor[Model]()}) {
+		item.Enum = append(item.Enum, path)
+	}
+
+	// Precompute messages of the items, huma only precomputes the returned schema
+	item.PrecomputeMessages()
+
+	slog.Debug("Schema generated for Include", slog.Any("schema", schema))
+	return schema
+}
+
+func (i *Include[Model]) Paths(_type reflect.Type, prefix string, visited []reflect.Type) []string {
+	result := []string{}
+	for idx := range _type.NumField() {
+		_field := _type.Field(idx)
+
+		// Only relation fields having a json tag can be included in the response
+		tag := strings.Split(_field.Tag.Get("json"), ",")[0]
+		if _field.Name == "_" || _field.Tag.Get("table") == "" || tag == "" || tag == "-" {
+			continue
+		}
+		result = append(result, prefix+tag)
+
+		// Get the related model deep inside array or slice or pointer types
+		_related := _field.Type
+		for _related.Kind() == reflect.Array || _related.Kind() == reflect.Slice || _related.Kind() == reflect.Pointer {
+			_related = _related.Elem()
+		}
+
+		// Add the nested relation paths, stop at models which are already in the path
+		if _related.Kind() == reflect.Struct && !slices.Contains(visited, _related) {
+			result = append(result, i.Paths(_related, prefix+tag+".", append(visited, _related))...)
+		}
+	}
+
+	return result
+}
+
+func (i *Include[Model]) Addr() *[]string {
+	return (*[]string)(i)
+}
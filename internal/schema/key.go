@@ -0,0 +1,104 @@
+package schema
+
+import (
+	"log/slog"
+	"reflect"
+	"strings"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// Key holds the primary key values of a single entity route
+// It is a struct, because huma only runs the resolvers of struct and primitive types
+type Key[Model any] struct {
+	// Values of the primary key fields by their json names
+	Values map[string]string
+}
+
+// Resolve reads the primary key values from the path parameters
+func (k *Key[Model]) Resolve(ctx huma.Context) []error {
+	k.Values = map[string]string{}
+	fields := KeyFields(reflect.TypeFor[Model]())
+	for _, _field := range fields {
+		name := strings.Split(_field.Tag.Get("json"), ",")[0]
+		k.Values[name] = ctx.Param(keyParam(name, len(fields)))
+	}
+
+	slog.Debug("Key resolved", slog.Any("key", k.Values))
+	return nil
+}
+
+// Params returns the path parameters of the primary key
+func (k *Key[Model]) Params() []*huma.Param {
+	result := []*huma.Param{}
+	fields := KeyFields(reflect.TypeFor[Model]())
+	for _, _field := range fields {
+		name := strings.Split(_field.Tag.Get("json"), ",")[0]
+
+		schema := ScalarSchema(_field.Type)
+		if schema == nil {
+			schema = &huma.Schema{Type: huma.TypeString}
+		}
+
+		result = append(result, &huma.Param{
+			Name:        keyParam(name, len(fields)),
+			Description: "Entity identifier",
+			In:          "path",
+			Required:    true,
+			Schema:      schema,
+		})
+	}
+
+	return result
+}
+
+// Path returns the path suffix of the single entity routes, such as "/{id}" or "/{orderId}/{lineNo}"
+func (k *Key[Model]) Path() string {
+	result := ""
+	for _, param := range k.Params() {
+		result += "/{" + param.Name + "}"
+	}
+
+	return result
+}
+
+// Where returns the where clause matching the primary key values
+func (k *Key[Model]) Where() Where[Model] {
+	result := Where[Model]{}
+	for name, value := range k.Values {
+		result[name] = map[string]any{"_eq": value}
+	}
+
+	return result
+}
+
+// KeyFields returns the primary key fields of the model
+// Fields tagged with key:"true" form the key, otherwise the first field is the key
+func KeyFields(_type reflect.Type) []reflect.StructField {
+	result := []reflect.StructField{}
+	for idx := range _type.NumField() {
+		_field := _type.Field(idx)
+		if _field.Name != "_" && _field.Tag.Get("key") == "true" {
+			result = append(result, _field)
+		}
+	}
+
+	if len(result) <= 0 {
+		_field := _type.Field(0)
+		if _field.Name == "_" {
+			_field = _type.Field(1)
+		}
+		result = append(result, _field)
+	}
+
+	return result
+}
+
+// Returns the path parameter name of a key field, single keys are named "id" and composite keys keep their json names
+func keyParam(name string, count int) string {
+	if count == 1 {
+		return "id"
+	}
+
+	return name
+}
@@ -1,8 +1,10 @@
 package schema
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
 	"reflect"
 	"strings"
@@ -12,20 +14,45 @@ import (
 
 var orderRegistry huma.Registry
 
-type Order[Model any] map[string]any
+type Order[Model any] []map[string]any
 
 func (o *Order[Model]) UnmarshalText(text []byte) error {
-	// Unmarshal the text into the Order map
-	if err := json.Unmarshal(text, o.Addr()); err != nil {
-		slog.Error("Failed to unmarshal text into Order", slog.Any("error", err))
-		return err
+	// Unmarshal the text into the Order list
+	text = bytes.TrimSpace(text)
+	switch {
+	case bytes.HasPrefix(text, []byte("[")):
+		// Ordered list of objects, e.g. [{"age":"DESC"},{"name":"ASC"}]
+		if err := json.Unmarshal(text, o.Addr()); err != nil {
+			slog.Error("Failed to unmarshal text into Order", slog.Any("error", err))
+			return err
+		}
+	case bytes.HasPrefix(text, []byte("{")):
+		// Single object, e.g. {"age":"DESC","name":"ASC"}, keys precedence is preserved
+		if err := o.unmarshalObject(text); err != nil {
+			slog.Error("Failed to unmarshal text into Order", slog.Any("error", err))
+			return err
+		}
+	default:
+		// Comma separated list, e.g. -age,name
+		*o = Order[Model]{}
+		for _, item := range strings.Split(string(text), ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+
+			if key, ok := strings.CutPrefix(item, "-"); ok {
+				*o = append(*o, map[string]any{key: "DESC"})
+			} else {
+				*o = append(*o, map[string]any{strings.TrimPrefix(item, "+"): "ASC"})
+			}
+		}
 	}
 
 	// Validate the unmarshaled data against the schema
 	name := "Order" + huma.DefaultSchemaNamer(reflect.TypeFor[Model](), "")
 	schema := orderRegistry.Map()[name]
 	result := huma.ValidateResult{}
-	huma.Validate(orderRegistry, schema, huma.NewPathBuffer([]byte(""), 0), huma.ModeReadFromServer, *o.Addr(), &result)
+	huma.Validate(orderRegistry, schema, huma.NewPathBuffer([]byte(""), 0), huma.ModeReadFromServer, o.value(), &result)
 	if len(result.Errors) > 0 {
 		slog.Error("Validation errors in Order", slog.Any("errors", result.Errors))
 		return errors.Join(result.Errors...)
@@ -35,14 +62,62 @@ func (o *Order[Model]) UnmarshalText(text []byte) error {
 	return nil
 }
 
+// Unmarshal a JSON object into the Order list while preserving the keys precedence
+func (o *Order[Model]) unmarshalObject(text []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(text))
+	if _, err := decoder.Token(); err != nil {
+		return err
+	}
+
+	*o = Order[Model]{}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+
+		key, ok := token.(string)
+		if !ok {
+			return fmt.Errorf("invalid order key %v", token)
+		}
+
+		var value any
+		if err := decoder.Decode(&value); err != nil {
+			return err
+		}
+
+		*o = append(*o, map[string]any{key: value})
+	}
+
+	_, err := decoder.Token()
+	return err
+}
+
+// Convert the Order list into a generic value for validation
+func (o *Order[Model]) value() []any {
+	result := []any{}
+	for _, item := range *o {
+		result = append(result, item)
+	}
+
+	return result
+}
+
 func (o *Order[Model]) Schema(r huma.Registry) *huma.Schema {
 	// Generate and register the schema for the Order type
 	name := "Order" + huma.DefaultSchemaNamer(reflect.TypeFor[Model](), "")
-	schema := &huma.Schema{
+	one := 1
+	item := &huma.Schema{
 		Type:                 huma.TypeObject,
 		Properties:           map[string]*huma.Schema{},
+		MinProperties:        &one,
+		MaxProperties:        &one,
 		AdditionalProperties: false,
 	}
+	schema := &huma.Schema{
+		Type:  huma.TypeArray,
+		Items: item,
+	}
 
 	// Add field-specific properties to the schema
 	_type := reflect.TypeFor[Model]()
@@ -55,16 +130,29 @@ func (o *Order[Model]) Schema(r huma.Registry) *huma.Schema {
 		}
 
 		if tag := _field.Tag.Get("json"); tag != "" {
-			if _schema := o.FieldSchema(_field); _schema != nil {
-				if tag != "-" {
-					// primitive fields detected, name it with the json tag
-					schema.Properties[strings.Split(tag, ",")[0]] = _schema
+			if _field.Tag.Get("table") != "" {
+				// Relation field detected, name its fields with the json tag or the db tag prefix when hidden
+				prefix := strings.Split(tag, ",")[0]
+				if prefix == "-" {
+					prefix = _field.Tag.Get("db")
+				}
+
+				for key, _schema := range o.RelationSchema(_field) {
+					_schema.PrecomputeMessages()
+					item.Properties[prefix+"."+key] = _schema
 				}
+			} else if tag == "-" {
+				continue
+			} else if _schema := o.FieldSchema(_field); _schema != nil {
+				// primitive fields detected, name it with the json tag
+				_schema.PrecomputeMessages()
+				item.Properties[strings.Split(tag, ",")[0]] = _schema
 			}
 		}
 	}
 
 	// Precompute messages and update the registry
+	item.PrecomputeMessages()
 	schema.PrecomputeMessages()
 	r.Map()[name] = schema
 	orderRegistry = r
@@ -82,12 +170,11 @@ func (o *Order[Model]) FieldSchema(field reflect.StructField) *huma.Schema {
 		_field = _field.Elem()
 	}
 
-	switch _field.Kind() {
-	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128, reflect.String:
-		// For fields of primitive types, return a schema with enum values
+	if ScalarSchema(field.Type) != nil || ScalarSchema(_field) != nil {
+		// For fields of scalar types, return a schema with enum values
 		return &huma.Schema{
 			Type: huma.TypeString,
-			Enum: []any{"ASC", "DESC"},
+			Enum: []any{"ASC", "DESC", "ASC_NULLS_FIRST", "ASC_NULLS_LAST", "DESC_NULLS_FIRST", "DESC_NULLS_LAST"},
 		}
 	}
 
@@ -95,6 +182,31 @@ func (o *Order[Model]) FieldSchema(field reflect.StructField) *huma.Schema {
 	return nil
 }
 
-func (o *Order[Model]) Addr() *map[string]any {
-	return (*map[string]any)(o)
+func (o *Order[Model]) RelationSchema(field reflect.StructField) map[string]*huma.Schema {
+	// Get the field deep inside pointer types, only to-one relations are sortable
+	_field := field.Type
+	for _field.Kind() == reflect.Pointer {
+		_field = _field.Elem()
+	}
+	if field.Tag.Get("db") == "" || _field.Kind() != reflect.Struct {
+		slog.Debug("Unsupported relation type for Order", slog.Any("field", field))
+		return nil
+	}
+
+	// Add the primitive fields of the related model
+	result := map[string]*huma.Schema{}
+	for idx := range _field.NumField() {
+		_field := _field.Field(idx)
+		if tag := _field.Tag.Get("json"); _field.Name != "_" && tag != "" && tag != "-" {
+			if _schema := o.FieldSchema(_field); _schema != nil {
+				result[strings.Split(tag, ",")[0]] = _schema
+			}
+		}
+	}
+
+	return result
+}
+
+func (o *Order[Model]) Addr() *[]map[string]any {
+	return (*[]map[string]any)(o)
 }
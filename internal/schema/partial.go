@@ -0,0 +1,62 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"slices"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+type Partial[Model any] struct {
+	Value  Model
+	Fields []string
+}
+
+// Define schema to use wrapped type
+func (p *Partial[Model]) Schema(r huma.Registry) *huma.Schema {
+	return r.Schema(reflect.TypeFor[Model](), true, "")
+}
+
+// Marshal the wrapped value while omitting the properties that are not selected
+func (p Partial[Model]) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(p.Value)
+	if err != nil || p.Fields == nil {
+		return data, err
+	}
+
+	// Only objects can be narrowed
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return data, err
+	}
+
+	result := bytes.NewBufferString("{")
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return nil, err
+		}
+
+		// Copy the selected properties in their original order
+		if key := token.(string); slices.Contains(p.Fields, key) {
+			if result.Len() > 1 {
+				result.WriteByte(',')
+			}
+
+			name, _ := json.Marshal(key)
+			result.Write(name)
+			result.WriteByte(':')
+			result.Write(value)
+		}
+	}
+	result.WriteByte('}')
+
+	return result.Bytes(), nil
+}
@@ -0,0 +1,79 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// Patch holds a partial update, either a JSON Merge Patch object or a JSON Patch array of operations
+type Patch[Model any] struct {
+	Merge      map[string]json.RawMessage
+	Operations []PatchOperation
+}
+
+// PatchOperation is a JSON Patch operation as defined by RFC 6902
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Unmarshal the arrays as JSON Patch operations and the objects as JSON Merge Patch
+func (p *Patch[Model]) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		return json.Unmarshal(data, &p.Operations)
+	}
+
+	return json.Unmarshal(data, &p.Merge)
+}
+
+func (p *Patch[Model]) Schema(r huma.Registry) *huma.Schema {
+	// The merge patch has the properties of the model, none of them is required and null removes a property
+	model := r.Schema(reflect.TypeFor[Model](), true, "")
+	if model.Ref != "" {
+		model = r.SchemaFromRef(model.Ref)
+	}
+	merge := &huma.Schema{
+		Type:                 huma.TypeObject,
+		Description:          "JSON Merge Patch (RFC 7396), only the present properties are updated",
+		Properties:           model.Properties,
+		AdditionalProperties: false,
+	}
+
+	// The JSON Patch operations are limited to the top level properties
+	operation := &huma.Schema{
+		Type: huma.TypeObject,
+		Properties: map[string]*huma.Schema{
+			"op":    {Type: huma.TypeString, Enum: []any{"add", "remove", "replace", "move", "copy", "test"}},
+			"path":  {Type: huma.TypeString, Pattern: "^/[^/]+$"},
+			"from":  {Type: huma.TypeString, Pattern: "^/[^/]+$"},
+			"value": {},
+		},
+		Required: []string{"op", "path"},
+	}
+	operations := &huma.Schema{
+		Type:        huma.TypeArray,
+		Description: "JSON Patch (RFC 6902), the paths are top level properties",
+		Items:       operation,
+	}
+
+	// Precompute messages of the nested schemas, huma only precomputes the returned schema
+	for _, item := range operation.Properties {
+		item.PrecomputeMessages()
+	}
+	operation.PrecomputeMessages()
+	merge.PrecomputeMessages()
+	operations.PrecomputeMessages()
+
+	schema := &huma.Schema{
+		OneOf: []*huma.Schema{merge, operations},
+	}
+
+	slog.Debug("Schema generated for Patch", slog.Any("schema", schema))
+	return schema
+}
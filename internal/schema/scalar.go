@@ -0,0 +1,86 @@
+package schema
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// ScalarSchema returns the schema of a column value type, or nil when the type is not a scalar
+// Primitive, time, UUID, decimal, enum, database/sql null and Scanner/Valuer types are scalars
+func ScalarSchema(_type reflect.Type) *huma.Schema {
+	for _type.Kind() == reflect.Pointer {
+		_type = _type.Elem()
+	}
+
+	// Null wrappers of database/sql have the schema of their value
+	if _type.Kind() == reflect.Struct && _type.PkgPath() == "database/sql" && strings.HasPrefix(_type.Name(), "Null") {
+		return ScalarSchema(_type.Field(0).Type)
+	}
+
+	// Well-known types are detected by their name
+	switch {
+	case _type == reflect.TypeFor[time.Time]():
+		return &huma.Schema{Type: huma.TypeString, Format: "date-time"}
+	case _type.Name() == "UUID":
+		return &huma.Schema{Type: huma.TypeString, Format: "uuid"}
+	case _type.Name() == "Decimal":
+		return &huma.Schema{Type: huma.TypeNumber, Format: "decimal"}
+	}
+
+	// Check if the type has a method named "Values"
+	// Then restrict the schema to its enum values
+	if _method, ok := _type.MethodByName("Values"); ok && _method.Type.NumIn() == 1 && _method.Type.NumOut() == 1 && _method.Type.Out(0).Kind() == reflect.Slice {
+		values := _method.Func.Call([]reflect.Value{reflect.New(_type).Elem()})[0]
+		result := &huma.Schema{Type: kindSchema(_type.Kind()), Enum: []any{}}
+		for idx := range values.Len() {
+			// Values are compared with the decoded JSON values, so they are converted to JSON types
+			value := values.Index(idx)
+			switch {
+			case value.Kind() == reflect.String:
+				result.Enum = append(result.Enum, value.String())
+			case value.CanInt():
+				result.Enum = append(result.Enum, float64(value.Int()))
+			case value.CanUint():
+				result.Enum = append(result.Enum, float64(value.Uint()))
+			case value.CanFloat():
+				result.Enum = append(result.Enum, value.Float())
+			default:
+				result.Enum = append(result.Enum, value.Interface())
+			}
+		}
+
+		return result
+	}
+
+	if kind := kindSchema(_type.Kind()); kind != "" {
+		return &huma.Schema{Type: kind}
+	}
+
+	// Other types storing their own column value are texts
+	if _type.Implements(reflect.TypeFor[driver.Valuer]()) || reflect.PointerTo(_type).Implements(reflect.TypeFor[sql.Scanner]()) {
+		return &huma.Schema{Type: huma.TypeString}
+	}
+
+	return nil
+}
+
+// Returns the schema type of a primitive kind, or an empty string when the kind is not primitive
+func kindSchema(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Bool:
+		return huma.TypeBoolean
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return huma.TypeInteger
+	case reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return huma.TypeNumber
+	case reflect.String:
+		return huma.TypeString
+	}
+
+	return ""
+}
@@ -1,10 +1,13 @@
 package schema
 
 import (
+	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
 	"errors"
 	"log/slog"
 	"reflect"
+	"slices"
 	"strings"
 
 	"github.com/danielgtaylor/huma/v2"
@@ -71,7 +74,22 @@ func (w *Where[Model]) Schema(r huma.Registry) *huma.Schema {
 		}
 
 		if tag := _field.Tag.Get("json"); tag != "" {
-			if _schema := w.FieldSchema(_field); _schema != nil {
+			if _field.Tag.Get("table") != "" {
+				// Relation field detected, name it with the json tag or the db tag when hidden
+				name := strings.Split(tag, ",")[0]
+				if name == "-" {
+					name = _field.Tag.Get("db")
+				}
+
+				if _schema := w.RelationSchema(_field); _schema != nil {
+					schema.Properties[name] = _schema
+				}
+			} else if slices.Contains(strings.Split(_field.Tag.Get("db"), ",")[1:], "json") {
+				// JSON field detected, name it with the json tag
+				if tag != "-" {
+					schema.Properties[strings.Split(tag, ",")[0]] = w.JSONSchema()
+				}
+			} else if _schema := w.FieldSchema(_field); _schema != nil {
 				if tag == "-" {
 					// Relation field detected, name it with the db tag
 					schema.Properties[_field.Tag.Get("db")] = _schema
@@ -96,33 +114,14 @@ func (w *Where[Model]) Schema(r huma.Registry) *huma.Schema {
 }
 
 func (w *Where[Model]) FieldSchema(field reflect.StructField) *huma.Schema {
-	// Get the field deep inside array or slice or pointer types
-	_field := field.Type
-	for _field.Kind() == reflect.Array || _field.Kind() == reflect.Slice || _field.Kind() == reflect.Pointer {
-		_field = _field.Elem()
+	// For array fields of primitive types, return a schema with containment operations
+	if _schema := w.ArraySchema(field.Type); _schema != nil {
+		return _schema
 	}
 
-	switch _field.Kind() {
-	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128, reflect.String:
-		// For fields of primitive types, return a schema with operations
-		result := &huma.Schema{
-			Type: huma.TypeObject,
-			Properties: map[string]*huma.Schema{
-				"_eq":     {Type: huma.TypeString},
-				"_neq":    {Type: huma.TypeString},
-				"_gt":     {Type: huma.TypeString},
-				"_gte":    {Type: huma.TypeString},
-				"_lt":     {Type: huma.TypeString},
-				"_lte":    {Type: huma.TypeString},
-				"_like":   {Type: huma.TypeString},
-				"_nlike":  {Type: huma.TypeString},
-				"_ilike":  {Type: huma.TypeString},
-				"_nilike": {Type: huma.TypeString},
-				"_in":     {Type: huma.TypeArray, Items: &huma.Schema{Type: huma.TypeString}},
-				"_nin":    {Type: huma.TypeArray, Items: &huma.Schema{Type: huma.TypeString}},
-			},
-			AdditionalProperties: false,
-		}
+	if operand := ScalarSchema(field.Type); operand != nil {
+		// For fields of scalar types, return a schema with operations typed by the field type
+		result := w.OperationSchema(operand)
 
 		// Check if the field has a method named "Operations"
 		// Then add its custom defined operations to the field schema
@@ -139,8 +138,16 @@ func (w *Where[Model]) FieldSchema(field reflect.StructField) *huma.Schema {
 		}
 
 		return result
-	case reflect.Struct:
-		// For fields of struct types, return a schema with a reference to the struct
+	}
+
+	// Get the field deep inside array or slice or pointer types
+	_field := field.Type
+	for _field.Kind() == reflect.Array || _field.Kind() == reflect.Slice || _field.Kind() == reflect.Pointer {
+		_field = _field.Elem()
+	}
+
+	if _field.Kind() == reflect.Struct {
+		// For fields of other struct types, return a schema with a reference to the struct
 		name := "Where" + huma.DefaultSchemaNamer(_field, "")
 		return &huma.Schema{
 			Ref: "#/components/schemas/" + name,
@@ -151,6 +158,167 @@ func (w *Where[Model]) FieldSchema(field reflect.StructField) *huma.Schema {
 	return nil
 }
 
+func (w *Where[Model]) ArraySchema(_type reflect.Type) *huma.Schema {
+	if _type.Kind() != reflect.Slice {
+		return nil
+	}
+
+	// Slices storing their own column value are scalars, e.g. pq.StringArray
+	if _type.Implements(reflect.TypeFor[driver.Valuer]()) || reflect.PointerTo(_type).Implements(reflect.TypeFor[sql.Scanner]()) {
+		return nil
+	}
+
+	switch _type.Elem().Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64, reflect.String:
+		// Operands of the containment operations are arrays of the item type
+		operand := &huma.Schema{Type: huma.TypeArray, Items: w.OperandSchema(_type.Elem())}
+		result := &huma.Schema{
+			Type: huma.TypeObject,
+			Properties: map[string]*huma.Schema{
+				"_contains":     operand,
+				"_contained_by": operand,
+				"_overlaps":     operand,
+				"_is_null":      {Type: huma.TypeBoolean},
+			},
+			AdditionalProperties: false,
+		}
+		operand.Items.PrecomputeMessages()
+		for _, _schema := range result.Properties {
+			_schema.PrecomputeMessages()
+		}
+
+		return result
+	}
+
+	return nil
+}
+
+func (w *Where[Model]) JSONSchema() *huma.Schema {
+	// Operands of the JSON path operations have the type of the JSON value
+	operand := &huma.Schema{
+		OneOf: []*huma.Schema{{Type: huma.TypeString}, {Type: huma.TypeNumber}, {Type: huma.TypeBoolean}},
+	}
+	for _, _schema := range operand.OneOf {
+		_schema.PrecomputeMessages()
+	}
+	operations := w.OperationSchema(operand)
+	operations.PrecomputeMessages()
+
+	// Paths are dot separated keys of the JSON value, e.g. {"_path":{"plan.tier":{"_eq":"pro"}}}
+	path := &huma.Schema{
+		Type:                 huma.TypeObject,
+		AdditionalProperties: operations,
+	}
+	path.PrecomputeMessages()
+
+	result := &huma.Schema{
+		Type: huma.TypeObject,
+		Properties: map[string]*huma.Schema{
+			"_path":    path,
+			"_is_null": {Type: huma.TypeBoolean},
+		},
+		AdditionalProperties: false,
+	}
+	result.Properties["_is_null"].PrecomputeMessages()
+
+	return result
+}
+
+func (w *Where[Model]) OperationSchema(operand *huma.Schema) *huma.Schema {
+	// Comparison operations take the operand, pattern operations always take strings
+	two := 2
+	result := &huma.Schema{
+		Type: huma.TypeObject,
+		Properties: map[string]*huma.Schema{
+			"_eq":     operand,
+			"_neq":    operand,
+			"_gt":     operand,
+			"_gte":    operand,
+			"_lt":     operand,
+			"_lte":    operand,
+			"_like":   {Type: huma.TypeString},
+			"_nlike":  {Type: huma.TypeString},
+			"_ilike":  {Type: huma.TypeString},
+			"_nilike": {Type: huma.TypeString},
+			"_in":     {Type: huma.TypeArray, Items: operand},
+			"_nin":    {Type: huma.TypeArray, Items: operand},
+
+			"_is_null":     {Type: huma.TypeBoolean},
+			"_between":     {Type: huma.TypeArray, Items: operand, MinItems: &two, MaxItems: &two},
+			"_nbetween":    {Type: huma.TypeArray, Items: operand, MinItems: &two, MaxItems: &two},
+			"_starts_with": {Type: huma.TypeString},
+			"_ends_with":   {Type: huma.TypeString},
+			"_contains":    {Type: huma.TypeString},
+		},
+		AdditionalProperties: false,
+	}
+	operand.PrecomputeMessages()
+	for _, _schema := range result.Properties {
+		_schema.PrecomputeMessages()
+	}
+
+	return result
+}
+
+func (w *Where[Model]) OperandSchema(_type reflect.Type) *huma.Schema {
+	// Operands of the comparison operations have the type of the field
+	if result := ScalarSchema(_type); result != nil {
+		return result
+	}
+
+	return &huma.Schema{Type: huma.TypeString}
+}
+
+func (w *Where[Model]) RelationSchema(field reflect.StructField) *huma.Schema {
+	// Get the related model deep inside array or slice or pointer types
+	_field := field.Type
+	for _field.Kind() == reflect.Array || _field.Kind() == reflect.Slice || _field.Kind() == reflect.Pointer {
+		_field = _field.Elem()
+	}
+	if _field.Kind() != reflect.Struct {
+		slog.Debug("Unsupported relation type for Where", slog.Any("field", field))
+		return nil
+	}
+
+	// The filter of the related model, or the quantifiers of its records
+	filter := &huma.Schema{
+		Ref: "#/components/schemas/Where" + huma.DefaultSchemaNamer(_field, ""),
+	}
+	count := &huma.Schema{
+		Type: huma.TypeObject,
+		Properties: map[string]*huma.Schema{
+			"_eq":  {Type: huma.TypeInteger},
+			"_neq": {Type: huma.TypeInteger},
+			"_gt":  {Type: huma.TypeInteger},
+			"_gte": {Type: huma.TypeInteger},
+			"_lt":  {Type: huma.TypeInteger},
+			"_lte": {Type: huma.TypeInteger},
+		},
+		AdditionalProperties: false,
+	}
+	quantifiers := &huma.Schema{
+		Type: huma.TypeObject,
+		Properties: map[string]*huma.Schema{
+			"_some":  filter,
+			"_every": filter,
+			"_none":  filter,
+			"_count": count,
+		},
+		AdditionalProperties: false,
+	}
+
+	// Precompute messages of the nested schemas, huma doesn't do it recursively
+	for _, _schema := range count.Properties {
+		_schema.PrecomputeMessages()
+	}
+	count.PrecomputeMessages()
+	quantifiers.PrecomputeMessages()
+
+	return &huma.Schema{
+		AnyOf: []*huma.Schema{filter, quantifiers},
+	}
+}
+
 func (w *Where[Model]) Addr() *map[string]any {
 	return (*map[string]any)(w)
 }
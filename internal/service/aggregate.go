@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/ckoliber/gocrud/internal/schema"
+)
+
+// AggregateInput defines the input parameters for the Aggregate operation
+type AggregateInput[Model any] struct {
+	Where   schema.Where[Model]   `query:"where" doc:"Entity where" example:"{}"`
+	GroupBy schema.GroupBy[Model] `query:"group_by" doc:"Entity group by, comma separated list of grouped fields"`
+	Metrics schema.Metrics[Model] `query:"metrics" doc:"Entity metrics, comma separated list of count or function:field pairs, defaults to count" example:"count"`
+}
+
+// AggregateOutput defines the output structure for the Aggregate operation
+type AggregateOutput[Model any] struct {
+	Body []map[string]any
+}
+
+// Aggregate computes metrics of the filtered resources, grouped by the requested fields
+func (s *CRUDService[Model]) Aggregate(ctx context.Context, i *AggregateInput[Model]) (*AggregateOutput[Model], error) {
+	slog.Debug("Executing Aggregate operation", slog.Any("where", i.Where), slog.Any("group_by", i.GroupBy), slog.Any("metrics", i.Metrics))
+
+	// Count the resources when no metric is requested
+	if len(i.Metrics) <= 0 {
+		i.Metrics = schema.Metrics[Model]{"count"}
+	}
+
+	// Execute BeforeGet hook if defined, so the access control of the resources applies to their metrics
+	if s.hooks.BeforeGet != nil {
+		if err := s.hooks.BeforeGet(ctx, i.Where.Addr(), nil, nil, nil); err != nil {
+			slog.Error("BeforeGet hook failed", slog.Any("error", err))
+			return nil, err
+		}
+	}
+
+	// Compute the metrics in the repository
+	result, err := s.repo.Aggregate(ctx, i.Where.Addr(), i.GroupBy.Addr(), i.Metrics.Addr())
+	if err != nil {
+		slog.Error("Failed to aggregate resources in Aggregate", slog.Any("error", err))
+		return nil, err
+	}
+
+	slog.Debug("Successfully executed Aggregate operation", slog.Any("result", result))
+	return &AggregateOutput[Model]{
+		Body: result,
+	}, nil
+}
@@ -4,56 +4,108 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"maps"
 	"reflect"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/ckoliber/gocrud/internal/repository"
+	"github.com/ckoliber/gocrud/internal/schema"
+	"github.com/danielgtaylor/huma/v2"
 )
 
 // CRUDHooks defines hooks that can be executed before and after CRUD operations
 type CRUDHooks[Model any] struct {
-	BeforeGet    func(ctx context.Context, where *map[string]any, order *map[string]any, limit *int, skip *int) error
+	BeforeGet    func(ctx context.Context, where *map[string]any, order *[]map[string]any, limit *int, skip *int) error
 	BeforePut    func(ctx context.Context, models *[]Model) error
 	BeforePost   func(ctx context.Context, models *[]Model) error
 	BeforeDelete func(ctx context.Context, where *map[string]any) error
+	BeforePatch  func(ctx context.Context, where *map[string]any, patch *Model, fields *[]string) error
 
 	AfterGet    func(ctx context.Context, models *[]Model) error
 	AfterPut    func(ctx context.Context, models *[]Model) error
 	AfterPost   func(ctx context.Context, models *[]Model) error
 	AfterDelete func(ctx context.Context, models *[]Model) error
+	AfterPatch  func(ctx context.Context, models *[]Model) error
 }
 
 // CRUDService provides CRUD operations for a given repository
 type CRUDService[Model any] struct {
-	id    string
-	key   string
-	name  string
-	path  string
-	repo  repository.Repository[Model]
-	hooks *CRUDHooks[Model]
+	keys       []string
+	name       string
+	path       string
+	search     bool
+	softdelete bool
+	version    string
+	conflict   *repository.Conflict
+	merge      bool
+	repo       repository.Repository[Model]
+	hooks      *CRUDHooks[Model]
 }
 
-// NewCRUDService initializes a new CRUD service
-func NewCRUDService[Model any](repo repository.Repository[Model], hooks *CRUDHooks[Model]) *CRUDService[Model] {
+// NewCRUDService initializes a new CRUD service, the resources are upserted on the conflict when it is set
+// The resources are merged by their primary keys on demand only when updates are allowed
+func NewCRUDService[Model any](repo repository.Repository[Model], hooks *CRUDHooks[Model], conflict *repository.Conflict, updates bool) *CRUDService[Model] {
 	// Reflect on the Model type to extract metadata
 	_type := reflect.TypeFor[Model]()
 
-	// Extract the ID field from the model
-	idField := _type.Field(0)
-	if idField.Name == "_" {
-		idField = _type.Field(1)
+	// Extract the json names of the primary key fields from the model
+	keys := []string{}
+	for _, _field := range schema.KeyFields(_type) {
+		keys = append(keys, strings.Split(_field.Tag.Get("json"), ",")[0])
+	}
+
+	// Resources are merged by their primary keys on demand, unless the keys are generated by the database
+	merge := false
+	for _, _field := range schema.KeyFields(_type) {
+		merge = merge || _field.Tag.Get("key") == "true" || _field.Tag.Get("keygen") != ""
+	}
+	merge = merge && updates
+
+	// Check the conflict fields are columns of the model
+	columns := []string{}
+	for idx := range _type.NumField() {
+		if _type.Field(idx).Name != "_" && _type.Field(idx).Tag.Get("table") == "" {
+			columns = append(columns, strings.Split(_type.Field(idx).Tag.Get("db"), ",")[0])
+		}
+	}
+	if conflict != nil {
+		for _, name := range slices.Concat(conflict.Fields, conflict.Updates) {
+			if name == "" || !slices.Contains(columns, name) {
+				panic("unsupported conflict field " + name)
+			}
+		}
+	}
+
+	// Check if the model has searchable fields, is soft deleted or has a version field
+	search, softdelete, version := false, false, ""
+	for idx := range _type.NumField() {
+		if _type.Field(idx).Tag.Get("version") == "true" {
+			version = strings.Split(_type.Field(idx).Tag.Get("json"), ",")[0]
+		}
+		if _type.Field(idx).Tag.Get("search") == "true" {
+			search = true
+		}
+		if _type.Field(idx).Name == "_" && _type.Field(idx).Tag.Get("softdelete") != "" {
+			softdelete = true
+		}
 	}
 
 	result := &CRUDService[Model]{
-		id:    strings.Split(idField.Tag.Get("json"), ",")[0],
-		key:   idField.Name,
-		name:  strings.ToLower(_type.Name()),
-		path:  fmt.Sprintf("/%s", strings.ToLower(_type.Name())),
-		repo:  repo,
-		hooks: hooks,
+		keys:       keys,
+		name:       strings.ToLower(_type.Name()),
+		path:       fmt.Sprintf("/%s", strings.ToLower(_type.Name())),
+		search:     search,
+		softdelete: softdelete,
+		version:    version,
+		conflict:   conflict,
+		merge:      merge,
+		repo:       repo,
+		hooks:      hooks,
 	}
 
-	slog.Debug("Initialized CRUDService", slog.String("name", result.name), slog.String("path", result.path), slog.String("id", result.id))
+	slog.Debug("Initialized CRUDService", slog.String("name", result.name), slog.String("path", result.path), slog.Any("keys", result.keys))
 	return result
 }
 
@@ -68,3 +120,169 @@ func (s *CRUDService[Model]) GetPath() string {
 	slog.Debug("Fetching resource path", slog.String("path", s.path))
 	return s.path
 }
+
+// GetKeyPath returns the path suffix of the single resource routes, one segment for each primary key
+func (s *CRUDService[Model]) GetKeyPath() string {
+	return (&schema.Key[Model]{}).Path()
+}
+
+// GetKeyParams returns the path parameters of the single resource routes
+func (s *CRUDService[Model]) GetKeyParams() []*huma.Param {
+	return (&schema.Key[Model]{}).Params()
+}
+
+// GetLinks returns the json names of the many-to-many relations
+// Relations are linked by a single primary key, so models with composite keys have no links
+func (s *CRUDService[Model]) GetLinks() []string {
+	result := []string{}
+	if len(s.keys) > 1 {
+		return result
+	}
+
+	_type := reflect.TypeFor[Model]()
+	for idx := range _type.NumField() {
+		_field := _type.Field(idx)
+		if name := strings.Split(_field.Tag.Get("json"), ",")[0]; _field.Tag.Get("through") != "" && name != "" && name != "-" {
+			result = append(result, name)
+		}
+	}
+
+	slog.Debug("Fetching resource links", slog.Any("links", result))
+	return result
+}
+
+// GetSoftDelete returns true if the resources are soft deleted, so they can be restored
+func (s *CRUDService[Model]) GetSoftDelete() bool {
+	return s.softdelete
+}
+
+// GetTimeFields returns the json names of the time fields, which are bucketed by the time series
+func (s *CRUDService[Model]) GetTimeFields() []string {
+	result := []string{}
+	for _, item := range new(schema.TimeField[Model]).Schema(nil).Enum {
+		result = append(result, item.(string))
+	}
+
+	slog.Debug("Fetching resource time fields", slog.Any("fields", result))
+	return result
+}
+
+// scope adds the scope of the soft deleted resources to the where clause, they are excluded by default
+func (s *CRUDService[Model]) scope(where map[string]any, with bool, only bool) map[string]any {
+	if !s.softdelete || (!with && !only) {
+		return where
+	}
+
+	result := maps.Clone(where)
+	if result == nil {
+		result = map[string]any{}
+	}
+	if only {
+		result["_deleted"] = "only"
+	} else {
+		result["_deleted"] = "with"
+	}
+
+	return result
+}
+
+// resolve returns the conflict of the posted resources and whether the merge-duplicates preference is applied
+// Configured conflicts always upsert, otherwise the preference upserts by the primary keys
+func (s *CRUDService[Model]) resolve(prefer string) (*repository.Conflict, bool) {
+	preferred := false
+	for _, item := range strings.Split(prefer, ",") {
+		preferred = preferred || strings.EqualFold(strings.ReplaceAll(item, " ", ""), "resolution=merge-duplicates")
+	}
+
+	if s.conflict != nil {
+		return s.conflict, preferred
+	} else if preferred && s.merge {
+		return &repository.Conflict{}, true
+	}
+
+	return nil, false
+}
+
+// etag returns the entity tag of the model based on its version, or an empty string if the model has no version
+func (s *CRUDService[Model]) etag(model Model) string {
+	field, ok := s.field(s.version)
+	if !ok {
+		return ""
+	}
+
+	_field := reflect.ValueOf(model).FieldByIndex(field.Index)
+	for _field.Kind() == reflect.Pointer {
+		if _field.IsNil() {
+			return ""
+		}
+		_field = _field.Elem()
+	}
+	if _field.IsZero() {
+		return ""
+	}
+
+	return fmt.Sprintf("\"%v\"", _field.Interface())
+}
+
+// match sets the version of the model to the version of the entity tag, so stale versions are not updated
+// Weak and wildcard entity tags are accepted, wildcards keep the version of the model
+func (s *CRUDService[Model]) match(model *Model, tag string) error {
+	field, ok := s.field(s.version)
+	tag = strings.Trim(strings.TrimPrefix(tag, "W/"), "\"")
+	if !ok || tag == "" || tag == "*" {
+		return nil
+	}
+
+	version, err := strconv.ParseUint(tag, 10, 64)
+	if err != nil {
+		return huma.Error412PreconditionFailed("entity version is stale")
+	}
+
+	_field := reflect.ValueOf(model).Elem().FieldByIndex(field.Index)
+	for _field.Kind() == reflect.Pointer {
+		if _field.IsNil() {
+			_field.Set(reflect.New(_field.Type().Elem()))
+		}
+		_field = _field.Elem()
+	}
+
+	if _field.CanInt() {
+		_field.SetInt(int64(version))
+	} else {
+		_field.SetUint(version)
+	}
+
+	return nil
+}
+
+// field returns the model field with the given json name
+func (s *CRUDService[Model]) field(name string) (reflect.StructField, bool) {
+	_type := reflect.TypeFor[Model]()
+	for idx := range _type.NumField() {
+		_field := _type.Field(idx)
+		if _field.Name != "_" && strings.Split(_field.Tag.Get("json"), ",")[0] == name {
+			return _field, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+// partial wraps the models to omit the properties which are not selected, the primary keys and included relations are always kept
+func (s *CRUDService[Model]) partial(models []Model, fields []string, include []string) []schema.Partial[Model] {
+	if len(fields) > 0 {
+		fields = append(slices.Clone(fields), s.keys...)
+		for _, item := range include {
+			fields = append(fields, strings.Split(item, ".")[0])
+		}
+	} else {
+		fields = nil
+	}
+
+	result := []schema.Partial[Model]{}
+	for _, model := range models {
+		result = append(result, schema.Partial[Model]{Value: model, Fields: fields})
+	}
+
+	return result
+}
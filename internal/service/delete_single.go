@@ -9,17 +9,17 @@ import (
 )
 
 type DeleteSingleInput[Model any] struct {
-	ID string `path:"id" doc:"Entity identifier"`
+	Key schema.Key[Model]
 }
 type DeleteSingleOutput[Model any] struct {
 	Body Model
 }
 
 func (s *CRUDService[Model]) DeleteSingle(ctx context.Context, i *DeleteSingleInput[Model]) (*DeleteSingleOutput[Model], error) {
-	slog.Debug("Executing DeleteSingle operation", slog.String("id", i.ID))
+	slog.Debug("Executing DeleteSingle operation", slog.Any("key", i.Key.Values))
 
 	// Define the where clause for the delete operation
-	where := schema.Where[Model]{s.id: map[string]any{"_eq": i.ID}}
+	where := i.Key.Where()
 
 	// Execute BeforeDelete hook if defined
 	if s.hooks.BeforeDelete != nil {
@@ -35,7 +35,7 @@ func (s *CRUDService[Model]) DeleteSingle(ctx context.Context, i *DeleteSingleIn
 		slog.Error("Failed to delete resource in DeleteSingle", slog.Any("error", err))
 		return nil, err
 	} else if len(result) <= 0 {
-		slog.Warn("Entity not found in DeleteSingle", slog.String("id", i.ID))
+		slog.Warn("Entity not found in DeleteSingle", slog.Any("key", i.Key.Values))
 		return nil, huma.Error404NotFound("entity not found")
 	}
 
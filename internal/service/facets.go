@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/ckoliber/gocrud/internal/repository"
+	"github.com/ckoliber/gocrud/internal/schema"
+)
+
+// FacetsInput defines the input parameters for the Facets operation
+type FacetsInput[Model any] struct {
+	Where  schema.Where[Model]   `query:"where" doc:"Entity where" example:"{}"`
+	Fields schema.GroupBy[Model] `query:"fields" required:"true" doc:"Entity fields, comma separated list of faceted fields"`
+	Limit  int                   `query:"limit" minimum:"1" default:"10" doc:"Facet limit, maximum number of values of each field" example:"10"`
+}
+
+// FacetsOutput defines the output structure for the Facets operation
+type FacetsOutput[Model any] struct {
+	Body map[string][]repository.Facet
+}
+
+// Facets retrieves the distinct values of the fields with their counts among the filtered resources
+func (s *CRUDService[Model]) Facets(ctx context.Context, i *FacetsInput[Model]) (*FacetsOutput[Model], error) {
+	slog.Debug("Executing Facets operation", slog.Any("where", i.Where), slog.Any("fields", i.Fields), slog.Int("limit", i.Limit))
+
+	// Execute BeforeGet hook if defined, so the access control of the resources applies to their facets
+	if s.hooks.BeforeGet != nil {
+		if err := s.hooks.BeforeGet(ctx, i.Where.Addr(), nil, &i.Limit, nil); err != nil {
+			slog.Error("BeforeGet hook failed", slog.Any("error", err))
+			return nil, err
+		}
+	}
+
+	// Fetch the facets from the repository
+	result, err := s.repo.Facets(ctx, i.Where.Addr(), i.Fields.Addr(), i.Limit)
+	if err != nil {
+		slog.Error("Failed to fetch facets in Facets", slog.Any("error", err))
+		return nil, err
+	}
+
+	slog.Debug("Successfully executed Facets operation", slog.Any("result", result))
+	return &FacetsOutput[Model]{
+		Body: result,
+	}, nil
+}
@@ -2,27 +2,73 @@ package service
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"maps"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
 
 	"github.com/ckoliber/gocrud/internal/schema"
+	"github.com/danielgtaylor/huma/v2"
 )
 
 // GetBulkInput defines the input parameters for the GetBulk operation
 type GetBulkInput[Model any] struct {
-	Where schema.Where[Model]  `query:"where" doc:"Entity where" example:"{}"`
-	Order schema.Order[Model]  `query:"order" doc:"Entity order" example:"{}"`
-	Limit schema.Optional[int] `query:"limit" min:"1" doc:"Entity limit" example:"50"`
-	Skip  schema.Optional[int] `query:"skip" min:"0" doc:"Entity skip" example:"0"`
+	Where   schema.Where[Model]   `query:"where" doc:"Entity where" example:"{}"`
+	Order   schema.Order[Model]   `query:"order" doc:"Entity order" example:"[]"`
+	Limit   schema.Optional[int]  `query:"limit" min:"1" doc:"Entity limit" example:"50"`
+	Skip    schema.Optional[int]  `query:"skip" min:"0" doc:"Entity skip" example:"0"`
+	After   string                `query:"after" doc:"Entity cursor, returns entities after the cursor"`
+	Before  string                `query:"before" doc:"Entity cursor, returns entities before the cursor"`
+	Count   bool                  `query:"count" doc:"Entity count, returns total count and pagination links" example:"false"`
+	Fields  schema.Fields[Model]  `query:"fields" doc:"Entity fields, comma separated list of selected fields" example:"id"`
+	Include schema.Include[Model] `query:"include" doc:"Entity include, comma separated list of included relations"`
+	Q       string                `query:"q" doc:"Entity search, matches the searchable fields"`
+	Rank    bool                  `query:"rank" doc:"Entity rank, sorts the searched entities by relevance" example:"false"`
+
+	WithDeleted bool `query:"with_deleted" doc:"Entity with deleted, includes the soft deleted entities" example:"false"`
+	OnlyDeleted bool `query:"only_deleted" doc:"Entity only deleted, returns the soft deleted entities only" example:"false"`
 }
 
 // GetBulkOutput defines the output structure for the GetBulk operation
 type GetBulkOutput[Model any] struct {
-	Body []Model
+	Total      *int   `header:"X-Total-Count" doc:"Total number of entities"`
+	NextCursor string `header:"X-Next-Cursor" doc:"Cursor of the next page"`
+	PrevCursor string `header:"X-Prev-Cursor" doc:"Cursor of the previous page"`
+	Link       string `header:"Link" doc:"Pagination links"`
+	Body       []schema.Partial[Model]
 }
 
 // GetBulk retrieves multiple resources with filtering and pagination
 func (s *CRUDService[Model]) GetBulk(ctx context.Context, i *GetBulkInput[Model]) (*GetBulkOutput[Model], error) {
-	slog.Debug("Executing GetBulk operation", slog.Any("where", i.Where), slog.Any("order", i.Order), slog.Any("limit", i.Limit), slog.Any("skip", i.Skip))
+	slog.Debug("Executing GetBulk operation", slog.Any("where", i.Where), slog.Any("order", i.Order), slog.Any("limit", i.Limit), slog.Any("skip", i.Skip), slog.String("after", i.After), slog.String("before", i.Before), slog.Bool("count", i.Count), slog.Any("fields", i.Fields), slog.Any("include", i.Include), slog.String("q", i.Q), slog.Bool("rank", i.Rank), slog.Bool("with_deleted", i.WithDeleted), slog.Bool("only_deleted", i.OnlyDeleted))
+
+	if i.After != "" && i.Before != "" {
+		slog.Error("Both after and before cursors provided in GetBulk")
+		return nil, huma.Error422UnprocessableEntity("after and before cursors cannot be used together")
+	}
+	if i.Q != "" && !s.search {
+		slog.Error("Search provided in GetBulk without searchable fields")
+		return nil, huma.Error422UnprocessableEntity("search is not supported")
+	}
+	if (i.WithDeleted || i.OnlyDeleted) && !s.softdelete {
+		slog.Error("Deleted scope provided in GetBulk without soft delete")
+		return nil, huma.Error422UnprocessableEntity("soft delete is not supported")
+	}
+	if i.Q != "" && i.Rank && (i.After != "" || i.Before != "") {
+		slog.Error("Rank and cursor provided in GetBulk")
+		return nil, huma.Error422UnprocessableEntity("rank cannot be used with cursors")
+	}
+
+	// Keep the request of the client for the pagination links, so the conditions added by the hook are not exposed
+	request := *i
+	request.Where = maps.Clone(i.Where)
+	request.Order = slices.Clone(i.Order)
 
 	// Execute BeforeGet hook if defined
 	if s.hooks.BeforeGet != nil {
@@ -32,13 +78,118 @@ func (s *CRUDService[Model]) GetBulk(ctx context.Context, i *GetBulkInput[Model]
 		}
 	}
 
+	// Prepend the relevance of the search query to the order when ranking
+	order := slices.Clone(*i.Order.Addr())
+	if i.Q != "" && i.Rank {
+		order = append([]map[string]any{{"_rank": i.Q}}, order...)
+	}
+
+	// Append the primary keys to the order, so the pagination is deterministic
+	for _, key := range s.keys {
+		if !slices.ContainsFunc(order, func(item map[string]any) bool { _, ok := item[key]; return ok }) {
+			order = append(order, map[string]any{key: "ASC"})
+		}
+	}
+
+	// Reverse the order when paginating backwards
+	cursor, reverse := i.After, i.Before != ""
+	if reverse {
+		cursor = i.Before
+		for idx, item := range order {
+			order[idx] = map[string]any{}
+			for key, value := range item {
+				order[idx][key] = reverseDirection(fmt.Sprint(value))
+			}
+		}
+	}
+
+	// Add the search condition of the query to the where clause
+	filter := *i.Where.Addr()
+	if i.Q != "" {
+		search := map[string]any{"_search": i.Q}
+		if len(filter) > 0 {
+			filter = map[string]any{"_and": []any{filter, search}}
+		} else {
+			filter = search
+		}
+	}
+
+	// Add the seek condition of the cursor to the where clause
+	where := filter
+	if cursor != "" {
+		values, err := s.decodeCursor(cursor, order)
+		if err != nil {
+			slog.Error("Failed to decode cursor in GetBulk", slog.Any("error", err))
+			return nil, huma.Error422UnprocessableEntity("invalid cursor", err)
+		}
+
+		seek := map[string]any{"_seek": map[string]any{"order": order, "cursor": values}}
+		if len(where) > 0 {
+			where = map[string]any{"_and": []any{where, seek}}
+		} else {
+			where = seek
+		}
+	}
+
+	// Add the scope of the soft deleted resources to the where clauses
+	filter = s.scope(filter, i.WithDeleted, i.OnlyDeleted)
+	where = s.scope(where, i.WithDeleted, i.OnlyDeleted)
+
+	// Select the ordered fields too, so the cursors can be generated
+	fields := slices.Clone(*i.Fields.Addr())
+	if len(fields) > 0 {
+		for _, item := range order {
+			for key := range item {
+				fields = append(fields, key)
+			}
+		}
+	}
+
+	// Fetch one more resource to detect if there is a next page
+	limit := i.Limit.Value
+	if limit > 0 {
+		limit++
+	}
+
 	// Fetch resources from the repository
-	result, err := s.repo.Get(ctx, i.Where.Addr(), i.Order.Addr(), i.Limit.Addr(), i.Skip.Addr())
+	result, err := s.repo.Get(ctx, &where, &order, &limit, i.Skip.Addr(), &fields, i.Include.Addr())
 	if err != nil {
 		slog.Error("Failed to fetch resources in GetBulk", slog.Any("error", err))
 		return nil, err
 	}
 
+	// Trim the extra resource and restore the requested order
+	more := i.Limit.Value > 0 && len(result) > i.Limit.Value
+	if more {
+		result = result[:i.Limit.Value]
+	}
+	if reverse {
+		slices.Reverse(result)
+	}
+
+	// Generate the cursors of the next and previous pages
+	output := &GetBulkOutput[Model]{}
+	if len(result) > 0 {
+		if (!reverse && more) || (reverse && cursor != "") {
+			output.NextCursor = s.encodeCursor(result[len(result)-1], order)
+		}
+		if (reverse && more) || (!reverse && cursor != "") {
+			output.PrevCursor = s.encodeCursor(result[0], order)
+		}
+	}
+
+	// Count resources in the repository if requested
+	if i.Count {
+		total, err := s.repo.Count(ctx, &filter)
+		if err != nil {
+			slog.Error("Failed to count resources in GetBulk", slog.Any("error", err))
+			return nil, err
+		}
+
+		output.Total = &total
+	}
+	output.Link = s.links(&request, output)
+
 	// Execute AfterGet hook if defined
 	if s.hooks.AfterGet != nil {
 		if err := s.hooks.AfterGet(ctx, &result); err != nil {
@@ -48,7 +199,159 @@ func (s *CRUDService[Model]) GetBulk(ctx context.Context, i *GetBulkInput[Model]
 	}
 
 	slog.Debug("Successfully executed GetBulk operation", slog.Any("result", result))
-	return &GetBulkOutput[Model]{
-		Body: result,
-	}, nil
+	output.Body = s.partial(result, *i.Fields.Addr(), *i.Include.Addr())
+	return output, nil
+}
+
+// reverseDirection returns the opposite of a sort direction, including its NULLS placement
+func reverseDirection(direction string) string {
+	direction = strings.ToUpper(direction)
+	if nulls, ok := strings.CutPrefix(direction, "DESC"); ok {
+		direction = "ASC" + nulls
+	} else {
+		direction = "DESC" + strings.TrimPrefix(direction, "ASC")
+	}
+
+	if nulls, ok := strings.CutSuffix(direction, "_NULLS_FIRST"); ok {
+		return nulls + "_NULLS_LAST"
+	} else if nulls, ok := strings.CutSuffix(direction, "_NULLS_LAST"); ok {
+		return nulls + "_NULLS_FIRST"
+	}
+
+	return direction
+}
+
+// encodeCursor encodes the ordered field values of the model into an opaque cursor
+func (s *CRUDService[Model]) encodeCursor(model Model, order []map[string]any) string {
+	values := map[string]any{}
+	_value := reflect.ValueOf(model)
+	for _, item := range order {
+		for key := range item {
+			_field, ok := s.field(key)
+			if !ok {
+				return ""
+			}
+
+			values[key] = _value.FieldByIndex(_field.Index).Interface()
+		}
+	}
+
+	data, err := json.Marshal(values)
+	if err != nil {
+		slog.Error("Failed to encode cursor", slog.Any("error", err))
+		return ""
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor decodes an opaque cursor into the typed values of the ordered fields
+func (s *CRUDService[Model]) decodeCursor(cursor string, order []map[string]any) (map[string]any, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	if len(raw) != len(order) {
+		return nil, errors.New("cursor does not match the order")
+	}
+
+	// Unmarshal each value into the type of its model field
+	result := map[string]any{}
+	for _, item := range order {
+		for key := range item {
+			_field, ok := s.field(key)
+			if !ok {
+				return nil, fmt.Errorf("cursor field %s is not supported", key)
+			}
+
+			raw, ok := raw[key]
+			if !ok {
+				return nil, errors.New("cursor does not match the order")
+			}
+
+			value := reflect.New(_field.Type)
+			if err := json.Unmarshal(raw, value.Interface()); err != nil {
+				return nil, err
+			}
+
+			result[key] = value.Elem().Interface()
+		}
+	}
+
+	return result, nil
+}
+
+// links constructs the RFC 8288 pagination links based on cursors or limit, skip and total count
+func (s *CRUDService[Model]) links(i *GetBulkInput[Model], o *GetBulkOutput[Model]) string {
+	limit, skip := i.Limit.Value, i.Skip.Value
+	if limit <= 0 {
+		return ""
+	}
+
+	// Keep the filtering and sorting parameters of the current request
+	query := url.Values{}
+	if len(i.Where) > 0 {
+		if value, err := json.Marshal(i.Where); err == nil {
+			query.Set("where", string(value))
+		}
+	}
+	if len(i.Order) > 0 {
+		if value, err := json.Marshal(i.Order); err == nil {
+			query.Set("order", string(value))
+		}
+	}
+	if i.Q != "" {
+		query.Set("q", i.Q)
+		if i.Rank {
+			query.Set("rank", "true")
+		}
+	}
+	if i.WithDeleted {
+		query.Set("with_deleted", "true")
+	}
+	if i.OnlyDeleted {
+		query.Set("only_deleted", "true")
+	}
+	query.Set("limit", fmt.Sprintf("%d", limit))
+	if i.Count {
+		query.Set("count", "true")
+	}
+
+	link := func(key string, value string, rel string) string {
+		query := maps.Clone(query)
+		if key != "" {
+			query.Set(key, value)
+		}
+		return fmt.Sprintf("<%s?%s>; rel=\"%s\"", s.path, query.Encode(), rel)
+	}
+
+	result := []string{}
+	if i.After != "" || i.Before != "" {
+		// Generate the first, previous and next page links based on cursors
+		result = append(result, link("", "", "first"))
+		if o.PrevCursor != "" {
+			result = append(result, link("before", o.PrevCursor, "prev"))
+		}
+		if o.NextCursor != "" {
+			result = append(result, link("after", o.NextCursor, "next"))
+		}
+	} else if o.Total != nil {
+		// Generate the first, previous, next and last page links based on total count
+		total := *o.Total
+		result = append(result, link("skip", "0", "first"))
+		if skip > 0 {
+			result = append(result, link("skip", fmt.Sprintf("%d", max(skip-limit, 0)), "prev"))
+		}
+		if skip+limit < total {
+			result = append(result, link("skip", fmt.Sprintf("%d", skip+limit), "next"))
+		}
+		result = append(result, link("skip", fmt.Sprintf("%d", max((total-1)/limit, 0)*limit), "last"))
+	}
+
+	return strings.Join(result, ", ")
 }
@@ -9,18 +9,29 @@ import (
 )
 
 type GetSingleInput[Model any] struct {
-	ID string `path:"id" doc:"Entity identifier"`
+	Key     schema.Key[Model]
+	Fields  schema.Fields[Model]  `query:"fields" doc:"Entity fields, comma separated list of selected fields" example:"id"`
+	Include schema.Include[Model] `query:"include" doc:"Entity include, comma separated list of included relations"`
+
+	WithDeleted bool `query:"with_deleted" doc:"Entity with deleted, includes the soft deleted entity" example:"false"`
+	OnlyDeleted bool `query:"only_deleted" doc:"Entity only deleted, returns the soft deleted entity only" example:"false"`
 }
 type GetSingleOutput[Model any] struct {
-	Body Model
+	ETag string `header:"ETag" doc:"Entity tag of the current version"`
+	Body schema.Partial[Model]
 }
 
-// GetSingle retrieves a single resource by its ID
+// GetSingle retrieves a single resource by its primary key
 func (s *CRUDService[Model]) GetSingle(ctx context.Context, i *GetSingleInput[Model]) (*GetSingleOutput[Model], error) {
-	slog.Debug("Executing GetSingle operation", slog.String("id", i.ID))
+	slog.Debug("Executing GetSingle operation", slog.Any("key", i.Key.Values), slog.Any("fields", i.Fields), slog.Any("include", i.Include), slog.Bool("with_deleted", i.WithDeleted), slog.Bool("only_deleted", i.OnlyDeleted))
+
+	if (i.WithDeleted || i.OnlyDeleted) && !s.softdelete {
+		slog.Error("Deleted scope provided in GetSingle without soft delete")
+		return nil, huma.Error422UnprocessableEntity("soft delete is not supported")
+	}
 
 	// Define the where clause for the get operation
-	where := schema.Where[Model]{s.id: map[string]any{"_eq": i.ID}}
+	where := i.Key.Where()
 
 	// Execute BeforeGet hook if defined
 	if s.hooks.BeforeGet != nil {
@@ -30,13 +41,16 @@ func (s *CRUDService[Model]) GetSingle(ctx context.Context, i *GetSingleInput[Mo
 		}
 	}
 
+	// Add the scope of the soft deleted resources to the where clause
+	scoped := s.scope(*where.Addr(), i.WithDeleted, i.OnlyDeleted)
+
 	// Fetch the resource from the repository
-	result, err := s.repo.Get(ctx, where.Addr(), nil, nil, nil)
+	result, err := s.repo.Get(ctx, &scoped, nil, nil, nil, i.Fields.Addr(), i.Include.Addr())
 	if err != nil {
 		slog.Error("Failed to fetch resource in GetSingle", slog.Any("error", err))
 		return nil, err
 	} else if len(result) <= 0 {
-		slog.Error("Entity not found in GetSingle", slog.String("id", i.ID))
+		slog.Error("Entity not found in GetSingle", slog.Any("key", i.Key.Values))
 		return nil, huma.Error404NotFound("entity not found")
 	}
 
@@ -50,6 +64,7 @@ func (s *CRUDService[Model]) GetSingle(ctx context.Context, i *GetSingleInput[Mo
 
 	slog.Debug("Successfully executed GetSingle operation", slog.Any("result", result))
 	return &GetSingleOutput[Model]{
-		Body: result[0],
+		ETag: s.etag(result[0]),
+		Body: s.partial(result, *i.Fields.Addr(), *i.Include.Addr())[0],
 	}, nil
 }
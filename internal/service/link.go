@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+type LinkInput[Model any] struct {
+	ID   string   `path:"id" doc:"Entity identifier"`
+	Body []string `doc:"Related entity identifiers"`
+}
+type LinkOutput[Model any] struct{}
+
+type UnlinkInput[Model any] struct {
+	ID      string `path:"id" doc:"Entity identifier"`
+	Related string `path:"related" doc:"Related entity identifier"`
+}
+type UnlinkOutput[Model any] struct{}
+
+// Link returns the operation linking related resources to a resource through a many-to-many relation
+func (s *CRUDService[Model]) Link(relation string) func(context.Context, *LinkInput[Model]) (*LinkOutput[Model], error) {
+	return func(ctx context.Context, i *LinkInput[Model]) (*LinkOutput[Model], error) {
+		slog.Debug("Executing Link operation", slog.String("relation", relation), slog.String("id", i.ID), slog.Any("body", i.Body))
+
+		// Check the resource is found and writable, before linking its related resources
+		if err := s.parent(ctx, i.ID); err != nil {
+			return nil, err
+		}
+
+		// Link the resources in the repository, already linked resources are skipped
+		if _, err := s.repo.Link(ctx, relation, i.ID, i.Body); err != nil {
+			slog.Error("Failed to link resources", slog.Any("error", err))
+			return nil, err
+		}
+
+		slog.Debug("Successfully executed Link operation", slog.String("relation", relation))
+		return &LinkOutput[Model]{}, nil
+	}
+}
+
+// Unlink returns the operation unlinking a related resource from a resource through a many-to-many relation
+func (s *CRUDService[Model]) Unlink(relation string) func(context.Context, *UnlinkInput[Model]) (*UnlinkOutput[Model], error) {
+	return func(ctx context.Context, i *UnlinkInput[Model]) (*UnlinkOutput[Model], error) {
+		slog.Debug("Executing Unlink operation", slog.String("relation", relation), slog.String("id", i.ID), slog.String("related", i.Related))
+
+		// Check the resource is found and writable, before unlinking its related resources
+		if err := s.parent(ctx, i.ID); err != nil {
+			return nil, err
+		}
+
+		// Unlink the resources in the repository
+		count, err := s.repo.Unlink(ctx, relation, i.ID, []string{i.Related})
+		if err != nil {
+			slog.Error("Failed to unlink resources", slog.Any("error", err))
+			return nil, err
+		} else if count <= 0 {
+			slog.Warn("Link not found in Unlink", slog.String("id", i.ID), slog.String("related", i.Related))
+			return nil, huma.Error404NotFound("link not found")
+		}
+
+		slog.Debug("Successfully executed Unlink operation", slog.String("relation", relation))
+		return &UnlinkOutput[Model]{}, nil
+	}
+}
+
+// parent fetches the linked resource through the BeforeGet hook and passes it to the BeforePut hook
+// Resources which are not found, hidden by the BeforeGet hook or soft deleted are not linked
+func (s *CRUDService[Model]) parent(ctx context.Context, id string) error {
+	where := map[string]any{s.keys[0]: map[string]any{"_eq": id}}
+
+	// Execute BeforeGet hook if defined
+	if s.hooks.BeforeGet != nil {
+		if err := s.hooks.BeforeGet(ctx, &where, nil, nil, nil); err != nil {
+			slog.Error("BeforeGet hook failed", slog.Any("error", err))
+			return err
+		}
+	}
+
+	// Fetch the resource from the repository
+	result, err := s.repo.Get(ctx, &where, nil, nil, nil, nil, nil)
+	if err != nil {
+		slog.Error("Failed to fetch linked resource", slog.Any("error", err))
+		return err
+	} else if len(result) <= 0 {
+		slog.Error("Entity not found in Link", slog.String("id", id))
+		return huma.Error404NotFound("entity not found")
+	}
+
+	// Execute BeforePut hook if defined, links are updates of the resource
+	if s.hooks.BeforePut != nil {
+		if err := s.hooks.BeforePut(ctx, &result); err != nil {
+			slog.Error("BeforePut hook failed", slog.Any("error", err))
+			return err
+		}
+	}
+
+	return nil
+}
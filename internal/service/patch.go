@@ -0,0 +1,295 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/ckoliber/gocrud/internal/repository"
+	"github.com/ckoliber/gocrud/internal/schema"
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// PatchSingleInput represents the input for the PatchSingle operation
+type PatchSingleInput[Model any] struct {
+	Key     schema.Key[Model]
+	IfMatch string `header:"If-Match" doc:"Entity tag of the patched version, the patch fails if the entity is modified since"`
+	Body    schema.Patch[Model]
+}
+
+// PatchSingleOutput represents the output for the PatchSingle operation
+type PatchSingleOutput[Model any] struct {
+	ETag string `header:"ETag" doc:"Entity tag of the patched version"`
+	Body Model
+}
+
+// PatchBulkInput represents the input for the PatchBulk operation
+type PatchBulkInput[Model any] struct {
+	Where schema.Where[Model] `query:"where" doc:"Entity where" example:"{}"`
+	Body  schema.Patch[Model]
+}
+
+// PatchBulkOutput represents the output for the PatchBulk operation
+type PatchBulkOutput[Model any] struct {
+	Body []Model
+}
+
+// PatchSingle partially updates a single resource, only the fields present in the patch are updated
+func (s *CRUDService[Model]) PatchSingle(ctx context.Context, i *PatchSingleInput[Model]) (*PatchSingleOutput[Model], error) {
+	slog.Debug("Executing PatchSingle operation", slog.Any("key", i.Key.Values), slog.String("if_match", i.IfMatch), slog.Any("body", i.Body))
+
+	// Compile the patch and set its version based on the If-Match header
+	patch, tests, err := s.compile(&i.Body)
+	if err != nil {
+		slog.Error("Failed to compile patch in PatchSingle", slog.Any("error", err))
+		return nil, err
+	}
+	if err := s.match(&patch.Values, i.IfMatch); err != nil {
+		slog.Error("Failed to match entity tag in PatchSingle", slog.String("if_match", i.IfMatch))
+		return nil, err
+	}
+
+	// Define the where clause for the patch operation, the hook conditions are added to it
+	key := i.Key.Where()
+	where := *key.Addr()
+
+	result, err := s.patch(ctx, &where, patch, tests)
+	if err != nil {
+		slog.Error("Failed to patch resource in PatchSingle", slog.Any("error", err))
+		return nil, err
+	} else if len(result) <= 0 {
+		// Distinguish the failed preconditions from the missing resources, the resources hidden by the hook are missing
+		count, err := s.repo.Count(ctx, &where)
+		if err != nil {
+			slog.Error("Failed to count resource in PatchSingle", slog.Any("error", err))
+			return nil, err
+		} else if count > 0 && s.etag(patch.Values) != "" {
+			slog.Error("Stale version in PatchSingle", slog.Any("key", i.Key.Values))
+			return nil, huma.Error412PreconditionFailed("entity version is stale")
+		} else if count > 0 {
+			slog.Error("Failed test in PatchSingle", slog.Any("key", i.Key.Values))
+			return nil, huma.Error409Conflict("patch test failed")
+		}
+
+		slog.Error("Entity not found in PatchSingle", slog.Any("key", i.Key.Values))
+		return nil, huma.Error404NotFound("entity not found")
+	}
+
+	slog.Debug("Successfully executed PatchSingle operation", slog.Any("result", result[0]))
+	return &PatchSingleOutput[Model]{
+		ETag: s.etag(result[0]),
+		Body: result[0],
+	}, nil
+}
+
+// PatchBulk partially updates the filtered resources with the same patch
+func (s *CRUDService[Model]) PatchBulk(ctx context.Context, i *PatchBulkInput[Model]) (*PatchBulkOutput[Model], error) {
+	slog.Debug("Executing PatchBulk operation", slog.Any("where", i.Where), slog.Any("body", i.Body))
+
+	// Patching every resource is most likely a mistake, so a filter is required
+	if len(*i.Where.Addr()) <= 0 {
+		slog.Error("Empty where in PatchBulk")
+		return nil, huma.Error422UnprocessableEntity("where is required")
+	}
+
+	patch, tests, err := s.compile(&i.Body)
+	if err != nil {
+		slog.Error("Failed to compile patch in PatchBulk", slog.Any("error", err))
+		return nil, err
+	}
+
+	result, err := s.patch(ctx, i.Where.Addr(), patch, tests)
+	if err != nil {
+		slog.Error("Failed to patch resources in PatchBulk", slog.Any("error", err))
+		return nil, err
+	}
+
+	slog.Debug("Successfully executed PatchBulk operation", slog.Any("result", result))
+	return &PatchBulkOutput[Model]{
+		Body: result,
+	}, nil
+}
+
+// patch executes the hooks and updates the resources matching the where clause and the tests of the patch
+// The where clause is left with the conditions of the hook, without the tests
+func (s *CRUDService[Model]) patch(ctx context.Context, hooked *map[string]any, patch *repository.Patch[Model], tests map[string]any) ([]Model, error) {
+	// Execute BeforePatch hook if defined
+	if s.hooks.BeforePatch != nil {
+		if err := s.hooks.BeforePatch(ctx, hooked, &patch.Values, &patch.Fields); err != nil {
+			slog.Error("BeforePatch hook failed", slog.Any("error", err))
+			return nil, err
+		}
+	}
+	where := *hooked
+
+	// The version of the patch is tested too
+	if tag := s.etag(patch.Values); tag != "" {
+		if column, ok := s.column(s.version); ok {
+			tests[column] = map[string]any{"_eq": strings.Trim(tag, "\"")}
+		}
+	}
+
+	// Add the tests of the patch to the where clause, after the hook so its conditions are kept
+	if len(tests) > 0 {
+		if len(where) > 0 {
+			where = map[string]any{"_and": []any{where, tests}}
+		} else {
+			where = tests
+		}
+	}
+
+	// Convert the json names of the patched fields to their column names
+	fields := []string{}
+	for _, name := range patch.Fields {
+		if column, ok := s.column(name); ok {
+			fields = append(fields, column)
+		}
+	}
+	copies := map[string]string{}
+	for target, source := range patch.Copies {
+		target, ok := s.column(target)
+		source, found := s.column(source)
+		if ok && found {
+			copies[target] = source
+		}
+	}
+
+	// Empty patches of the models without version update nothing, so the resources are fetched instead
+	var result []Model
+	var err error
+	if len(fields) <= 0 && len(copies) <= 0 && s.version == "" {
+		result, err = s.repo.Get(ctx, &where, nil, nil, nil, nil, nil)
+	} else {
+		result, err = s.repo.Patch(ctx, &where, &repository.Patch[Model]{Values: patch.Values, Fields: fields, Copies: copies})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Execute AfterPatch hook if defined
+	if s.hooks.AfterPatch != nil {
+		if err := s.hooks.AfterPatch(ctx, &result); err != nil {
+			slog.Error("AfterPatch hook failed", slog.Any("error", err))
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// compile converts a JSON Merge Patch or JSON Patch operations into the patched fields by json names
+// JSON Patch tests are returned as the where conditions of the patched resources, and copies read the stored values
+func (s *CRUDService[Model]) compile(body *schema.Patch[Model]) (*repository.Patch[Model], map[string]any, error) {
+	result := &repository.Patch[Model]{Fields: []string{}, Copies: map[string]string{}}
+	tests := map[string]any{}
+
+	// Sets the field to the JSON value, null removes the value of the field
+	set := func(name string, value json.RawMessage) error {
+		field, ok := s.field(name)
+		if !ok || field.Tag.Get("table") != "" {
+			return huma.Error422UnprocessableEntity("property " + name + " cannot be patched")
+		}
+
+		// Primary keys are not updated
+		if slices.Contains(s.keys, name) {
+			return nil
+		}
+
+		_value := reflect.New(field.Type)
+		if len(value) > 0 && string(value) != "null" {
+			if err := json.Unmarshal(value, _value.Interface()); err != nil {
+				return huma.Error422UnprocessableEntity("invalid value of property "+name, err)
+			}
+		}
+		reflect.ValueOf(&result.Values).Elem().FieldByIndex(field.Index).Set(_value.Elem())
+
+		// The version is not set, it is tested before the increment
+		if name != s.version && !slices.Contains(result.Fields, name) {
+			result.Fields = append(result.Fields, name)
+		}
+		delete(result.Copies, name)
+		return nil
+	}
+
+	// Merge patch sets the present properties
+	for _, name := range slices.Sorted(maps.Keys(body.Merge)) {
+		if err := set(name, body.Merge[name]); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// JSON Patch operations are applied in order to the top level properties
+	// They are applied by a single update which reads the stored values, so the written properties can't be read afterwards
+	// Copied properties can't be the targets of later copies either, the copies are assigned before the other fields
+	written, copied := map[string]bool{}, map[string]bool{}
+	for _, operation := range body.Operations {
+		path, from := strings.TrimPrefix(operation.Path, "/"), strings.TrimPrefix(operation.From, "/")
+		switch operation.Op {
+		case "add", "replace":
+			if err := set(path, operation.Value); err != nil {
+				return nil, nil, err
+			}
+			written[path] = true
+		case "remove":
+			if err := set(path, nil); err != nil {
+				return nil, nil, err
+			}
+			written[path] = true
+		case "copy", "move":
+			if _, ok := s.field(from); !ok {
+				return nil, nil, huma.Error422UnprocessableEntity("property " + from + " cannot be patched")
+			} else if written[from] {
+				return nil, nil, huma.Error422UnprocessableEntity("property " + from + " is written by a preceding operation")
+			} else if copied[path] {
+				return nil, nil, huma.Error422UnprocessableEntity("property " + path + " is copied by a preceding operation")
+			}
+			if err := set(path, nil); err != nil {
+				return nil, nil, err
+			}
+			result.Fields = slices.DeleteFunc(result.Fields, func(item string) bool { return item == path })
+			result.Copies[path] = from
+			written[path], copied[from] = true, true
+			if operation.Op == "move" {
+				if err := set(from, nil); err != nil {
+					return nil, nil, err
+				}
+				written[from] = true
+			}
+		case "test":
+			if written[path] {
+				return nil, nil, huma.Error422UnprocessableEntity("property " + path + " is written by a preceding operation")
+			}
+
+			// Tests are matched by the column of the property, so only the scalar properties can be tested
+			field, ok := s.field(path)
+			column, found := s.column(path)
+			if !ok || !found || field.Tag.Get("table") != "" {
+				return nil, nil, huma.Error422UnprocessableEntity("property " + path + " cannot be tested")
+			}
+
+			var value any
+			if err := json.Unmarshal(operation.Value, &value); err != nil || value == nil {
+				tests[column] = map[string]any{"_is_null": true}
+			} else {
+				tests[column] = map[string]any{"_eq": value}
+			}
+		}
+	}
+
+	return result, tests, nil
+}
+
+// column returns the column name of the model field with the given json name
+func (s *CRUDService[Model]) column(name string) (string, bool) {
+	field, ok := s.field(name)
+	if !ok {
+		return "", false
+	}
+
+	column := strings.Split(field.Tag.Get("db"), ",")[0]
+	return column, column != ""
+}
@@ -2,14 +2,21 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+
+	"github.com/ckoliber/gocrud/internal/repository"
+	"github.com/danielgtaylor/huma/v2"
 )
 
 type PostBulkInput[Model any] struct {
-	Body []Model
+	Prefer string `header:"Prefer" doc:"Preferences of the request, resolution=merge-duplicates upserts the resources by their primary keys"`
+	Body   []Model
 }
 type PostBulkOutput[Model any] struct {
-	Body []Model
+	PreferenceApplied string `header:"Preference-Applied" doc:"Applied preferences of the request"`
+	Body              []Model
 }
 
 // PostBulk creates multiple resources
@@ -24,9 +31,36 @@ func (s *CRUDService[Model]) PostBulk(ctx context.Context, i *PostBulkInput[Mode
 		}
 	}
 
-	// Create resources in the repository
-	result, err := s.repo.Post(ctx, &i.Body)
-	if err != nil {
+	// Upserted resources may update the existing ones, so the BeforePut hook is executed too
+	conflict, applied := s.resolve(i.Prefer)
+	if conflict != nil && s.hooks.BeforePut != nil {
+		if err := s.hooks.BeforePut(ctx, &i.Body); err != nil {
+			slog.Error("BeforePut hook failed", slog.Any("error", err))
+			return nil, err
+		}
+	}
+
+	// Create or upsert resources in the repository
+	var result []Model
+	var err error
+	if conflict != nil {
+		result, err = s.repo.Upsert(ctx, &i.Body, conflict)
+	} else {
+		result, err = s.repo.Post(ctx, &i.Body)
+	}
+	if conflict := (*repository.ConflictError)(nil); errors.As(err, &conflict) {
+		// Report the resources conflicting with the stale or deleted entities by their location in the body
+		details := []error{}
+		for _, idx := range conflict.Indexes {
+			details = append(details, &huma.ErrorDetail{Message: "entity version is stale or entity is deleted", Location: fmt.Sprintf("body[%d]", idx)})
+		}
+
+		slog.Error("Stale versions in PostBulk", slog.Any("indexes", conflict.Indexes))
+		return nil, huma.Error412PreconditionFailed("entity versions are stale or entities are deleted", details...)
+	} else if relation := (*repository.RelationError)(nil); errors.As(err, &relation) {
+		slog.Error("Related entity not found in PostBulk", slog.String("table", relation.Table))
+		return nil, huma.Error422UnprocessableEntity("related entity not found")
+	} else if err != nil {
 		slog.Error("Failed to create resources in PostBulk", slog.Any("error", err))
 		return nil, err
 	}
@@ -40,7 +74,12 @@ func (s *CRUDService[Model]) PostBulk(ctx context.Context, i *PostBulkInput[Mode
 	}
 
 	slog.Debug("Successfully executed PostBulk operation", slog.Any("result", result))
-	return &PostBulkOutput[Model]{
+	output := &PostBulkOutput[Model]{
 		Body: result,
-	}, nil
+	}
+	if applied {
+		output.PreferenceApplied = "resolution=merge-duplicates"
+	}
+
+	return output, nil
 }
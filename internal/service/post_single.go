@@ -2,33 +2,60 @@ package service
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 
+	"github.com/ckoliber/gocrud/internal/repository"
 	"github.com/danielgtaylor/huma/v2"
 )
 
 type PostSingleInput[Model any] struct {
-	Body Model
+	Prefer string `header:"Prefer" doc:"Preferences of the request, resolution=merge-duplicates upserts the resources by their primary keys"`
+	Body   Model
 }
 type PostSingleOutput[Model any] struct {
-	Body Model
+	PreferenceApplied string `header:"Preference-Applied" doc:"Applied preferences of the request"`
+	Body              Model
 }
 
 // PostSingle creates a single resource
 func (s *CRUDService[Model]) PostSingle(ctx context.Context, i *PostSingleInput[Model]) (*PostSingleOutput[Model], error) {
 	slog.Debug("Executing PostSingle operation", slog.Any("input", i))
 
+	models := []Model{i.Body}
+
 	// Execute BeforePost hook if defined
 	if s.hooks.BeforePost != nil {
-		if err := s.hooks.BeforePost(ctx, &[]Model{i.Body}); err != nil {
+		if err := s.hooks.BeforePost(ctx, &models); err != nil {
 			slog.Error("BeforePost hook failed", slog.Any("error", err))
 			return nil, err
 		}
 	}
 
-	// Create the resource in the repository
-	result, err := s.repo.Post(ctx, &[]Model{i.Body})
-	if err != nil {
+	// Upserted resources may update the existing ones, so the BeforePut hook is executed too
+	conflict, applied := s.resolve(i.Prefer)
+	if conflict != nil && s.hooks.BeforePut != nil {
+		if err := s.hooks.BeforePut(ctx, &models); err != nil {
+			slog.Error("BeforePut hook failed", slog.Any("error", err))
+			return nil, err
+		}
+	}
+
+	// Create or upsert the resource in the repository
+	var result []Model
+	var err error
+	if conflict != nil {
+		result, err = s.repo.Upsert(ctx, &models, conflict)
+	} else {
+		result, err = s.repo.Post(ctx, &models)
+	}
+	if conflict := (*repository.ConflictError)(nil); errors.As(err, &conflict) {
+		slog.Error("Stale version in PostSingle")
+		return nil, huma.Error412PreconditionFailed("entity version is stale or entity is deleted")
+	} else if relation := (*repository.RelationError)(nil); errors.As(err, &relation) {
+		slog.Error("Related entity not found in PostSingle", slog.String("table", relation.Table))
+		return nil, huma.Error422UnprocessableEntity("related entity not found")
+	} else if err != nil {
 		slog.Error("Failed to create resource in PostSingle", slog.Any("error", err))
 		return nil, err
 	} else if len(result) <= 0 {
@@ -45,7 +72,12 @@ func (s *CRUDService[Model]) PostSingle(ctx context.Context, i *PostSingleInput[
 	}
 
 	slog.Debug("Successfully executed PostSingle operation", slog.Any("result", result))
-	return &PostSingleOutput[Model]{
+	output := &PostSingleOutput[Model]{
 		Body: result[0],
-	}, nil
+	}
+	if applied {
+		output.PreferenceApplied = "resolution=merge-duplicates"
+	}
+
+	return output, nil
 }
@@ -2,7 +2,12 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+
+	"github.com/ckoliber/gocrud/internal/repository"
+	"github.com/danielgtaylor/huma/v2"
 )
 
 type PutBulkInput[Model any] struct {
@@ -26,7 +31,19 @@ func (s *CRUDService[Model]) PutBulk(ctx context.Context, i *PutBulkInput[Model]
 
 	// Update the resources in the repository
 	result, err := s.repo.Put(ctx, &i.Body)
-	if err != nil {
+	if conflict := (*repository.ConflictError)(nil); errors.As(err, &conflict) {
+		// Report the stale resources by their location in the body
+		details := []error{}
+		for _, idx := range conflict.Indexes {
+			details = append(details, &huma.ErrorDetail{Message: "entity version is stale", Location: fmt.Sprintf("body[%d]", idx)})
+		}
+
+		slog.Error("Stale versions in PutBulk", slog.Any("indexes", conflict.Indexes))
+		return nil, huma.Error412PreconditionFailed("entity versions are stale", details...)
+	} else if relation := (*repository.RelationError)(nil); errors.As(err, &relation) {
+		slog.Error("Related entity not found in PutBulk", slog.String("table", relation.Table))
+		return nil, huma.Error422UnprocessableEntity("related entity not found")
+	} else if err != nil {
 		slog.Error("Failed to update resources in PutBulk", slog.Any("error", err))
 		return nil, err
 	}
@@ -2,69 +2,91 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"log/slog"
 	"reflect"
 	"strconv"
 
+	"github.com/ckoliber/gocrud/internal/repository"
+	"github.com/ckoliber/gocrud/internal/schema"
 	"github.com/danielgtaylor/huma/v2"
 )
 
 // PutSingleInput represents the input for the PutSingle operation
 type PutSingleInput[Model any] struct {
-	ID   string `path:"id" doc:"Entity identifier"`
-	Body Model
+	Key     schema.Key[Model]
+	IfMatch string `header:"If-Match" doc:"Entity tag of the updated version, the update fails if the entity is modified since"`
+	Body    Model
 }
 
 // PutSingleOutput represents the output for the PutSingle operation
 type PutSingleOutput[Model any] struct {
+	ETag string `header:"ETag" doc:"Entity tag of the updated version"`
 	Body Model
 }
 
 // PutSingle updates a single resource
 func (s *CRUDService[Model]) PutSingle(ctx context.Context, i *PutSingleInput[Model]) (*PutSingleOutput[Model], error) {
-	slog.Debug("Executing PutSingle operation", slog.String("id", i.ID), slog.Any("body", i.Body))
-
-	// Get the ID field by name
-	_field := reflect.ValueOf(&i.Body).Elem().FieldByName(s.key)
-	for _field.Kind() == reflect.Pointer {
-		_field = _field.Elem()
-	}
+	slog.Debug("Executing PutSingle operation", slog.Any("key", i.Key.Values), slog.Any("body", i.Body))
 
-	// Set model ID field value based on path ID value
-	switch _field.Kind() {
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		value, err := strconv.ParseInt(i.ID, 10, 64)
-		if err != nil {
-			slog.Error("Failed to parse ID as integer", slog.Any("error", err))
-			return nil, huma.Error422UnprocessableEntity(err.Error())
-		}
-		_field.SetInt(value)
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		value, err := strconv.ParseUint(i.ID, 10, 64)
-		if err != nil {
-			slog.Error("Failed to parse ID as unsigned integer", slog.Any("error", err))
-			return nil, huma.Error422UnprocessableEntity(err.Error())
-		}
-		_field.SetUint(value)
-	case reflect.Float32, reflect.Float64:
-		value, err := strconv.ParseFloat(i.ID, 64)
-		if err != nil {
-			slog.Error("Failed to parse ID as float", slog.Any("error", err))
-			return nil, huma.Error422UnprocessableEntity(err.Error())
+	// Set model primary key fields based on path key values
+	for name, key := range i.Key.Values {
+		// Get the key field by json name
+		field, _ := s.field(name)
+		_field := reflect.ValueOf(&i.Body).Elem().FieldByIndex(field.Index)
+		for _field.Kind() == reflect.Pointer {
+			if _field.IsNil() {
+				_field.Set(reflect.New(_field.Type().Elem()))
+			}
+			_field = _field.Elem()
 		}
-		_field.SetFloat(value)
-	case reflect.Complex64, reflect.Complex128:
-		value, err := strconv.ParseComplex(i.ID, 128)
-		if err != nil {
-			slog.Error("Failed to parse ID as complex number", slog.Any("error", err))
-			return nil, huma.Error422UnprocessableEntity(err.Error())
+
+		// Set model key field value based on its type
+		switch _field.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			value, err := strconv.ParseInt(key, 10, 64)
+			if err != nil {
+				slog.Error("Failed to parse key as integer", slog.Any("error", err))
+				return nil, huma.Error422UnprocessableEntity(err.Error())
+			}
+			_field.SetInt(value)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			value, err := strconv.ParseUint(key, 10, 64)
+			if err != nil {
+				slog.Error("Failed to parse key as unsigned integer", slog.Any("error", err))
+				return nil, huma.Error422UnprocessableEntity(err.Error())
+			}
+			_field.SetUint(value)
+		case reflect.Float32, reflect.Float64:
+			value, err := strconv.ParseFloat(key, 64)
+			if err != nil {
+				slog.Error("Failed to parse key as float", slog.Any("error", err))
+				return nil, huma.Error422UnprocessableEntity(err.Error())
+			}
+			_field.SetFloat(value)
+		case reflect.Complex64, reflect.Complex128:
+			value, err := strconv.ParseComplex(key, 128)
+			if err != nil {
+				slog.Error("Failed to parse key as complex number", slog.Any("error", err))
+				return nil, huma.Error422UnprocessableEntity(err.Error())
+			}
+			_field.SetComplex(value)
+		case reflect.String:
+			_field.SetString(key)
+		default:
+			// Other scalars like time and UUID types are decoded from their text
+			if err := json.Unmarshal([]byte(strconv.Quote(key)), _field.Addr().Interface()); err != nil {
+				slog.Error("Failed to parse key", slog.String("key", name), slog.Any("error", err))
+				return nil, huma.Error422UnprocessableEntity(err.Error())
+			}
 		}
-		_field.SetComplex(value)
-	case reflect.String:
-		_field.SetString(i.ID)
-	default:
-		slog.Error("Invalid identifier type", slog.String("id", i.ID))
-		return nil, huma.Error422UnprocessableEntity("invalid identifier type")
+	}
+
+	// Set model version based on the If-Match header, so stale versions are not updated
+	if err := s.match(&i.Body, i.IfMatch); err != nil {
+		slog.Error("Failed to match entity tag in PutSingle", slog.String("if_match", i.IfMatch))
+		return nil, err
 	}
 
 	// Execute BeforePut hook if defined
@@ -77,11 +99,17 @@ func (s *CRUDService[Model]) PutSingle(ctx context.Context, i *PutSingleInput[Mo
 
 	// Update the resource in the repository
 	result, err := s.repo.Put(ctx, &[]Model{i.Body})
-	if err != nil {
+	if conflict := (*repository.ConflictError)(nil); errors.As(err, &conflict) {
+		slog.Error("Stale version in PutSingle", slog.Any("key", i.Key.Values))
+		return nil, huma.Error412PreconditionFailed("entity version is stale")
+	} else if relation := (*repository.RelationError)(nil); errors.As(err, &relation) {
+		slog.Error("Related entity not found in PutSingle", slog.String("table", relation.Table))
+		return nil, huma.Error422UnprocessableEntity("related entity not found")
+	} else if err != nil {
 		slog.Error("Failed to update resource in PutSingle", slog.Any("error", err))
 		return nil, err
 	} else if len(result) <= 0 {
-		slog.Error("Entity not found", slog.String("id", i.ID))
+		slog.Error("Entity not found", slog.Any("key", i.Key.Values))
 		return nil, huma.Error404NotFound("entity not found")
 	}
 
@@ -95,6 +123,7 @@ func (s *CRUDService[Model]) PutSingle(ctx context.Context, i *PutSingleInput[Mo
 
 	slog.Debug("Successfully executed PutSingle operation", slog.Any("result", result[0]))
 	return &PutSingleOutput[Model]{
+		ETag: s.etag(result[0]),
 		Body: result[0],
 	}, nil
 }
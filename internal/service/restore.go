@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/ckoliber/gocrud/internal/schema"
+	"github.com/danielgtaylor/huma/v2"
+)
+
+type RestoreInput[Model any] struct {
+	Key schema.Key[Model]
+}
+type RestoreOutput[Model any] struct {
+	Body Model
+}
+
+// Restore restores a soft deleted resource by its primary key
+func (s *CRUDService[Model]) Restore(ctx context.Context, i *RestoreInput[Model]) (*RestoreOutput[Model], error) {
+	slog.Debug("Executing Restore operation", slog.Any("key", i.Key.Values))
+
+	// Define the where clause for the restore operation
+	where := i.Key.Where()
+
+	// Execute BeforeDelete hook if defined, so the access control of the deleted resources applies to their restore
+	if s.hooks.BeforeDelete != nil {
+		if err := s.hooks.BeforeDelete(ctx, where.Addr()); err != nil {
+			slog.Error("BeforeDelete hook failed", slog.Any("error", err))
+			return nil, err
+		}
+	}
+
+	// Restore the resource in the repository
+	result, err := s.repo.Restore(ctx, where.Addr())
+	if err != nil {
+		slog.Error("Failed to restore resource in Restore", slog.Any("error", err))
+		return nil, err
+	} else if len(result) <= 0 {
+		slog.Warn("Deleted entity not found in Restore", slog.Any("key", i.Key.Values))
+		return nil, huma.Error404NotFound("deleted entity not found")
+	}
+
+	slog.Debug("Successfully executed Restore operation", slog.Any("result", result[0]))
+	return &RestoreOutput[Model]{
+		Body: result[0],
+	}, nil
+}
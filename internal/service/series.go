@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/ckoliber/gocrud/internal/repository"
+	"github.com/ckoliber/gocrud/internal/schema"
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// SeriesInput defines the input parameters for the Series operation
+type SeriesInput[Model any] struct {
+	Where    schema.Where[Model]        `query:"where" doc:"Entity where" example:"{}"`
+	Field    schema.TimeField[Model]    `query:"field" required:"true" doc:"Entity time field, the records are bucketed by its value"`
+	Interval string                     `query:"interval" enum:"hour,day,week,month" default:"day" doc:"Bucket interval, weeks start on Monday"`
+	Timezone string                     `query:"timezone" default:"UTC" doc:"Bucket timezone, IANA name of the timezone truncating the times" example:"UTC"`
+	Metric   schema.SeriesMetric[Model] `query:"metric" doc:"Bucket metric, count or sum:field, defaults to count" example:"count"`
+}
+
+// SeriesOutput defines the output structure for the Series operation
+type SeriesOutput[Model any] struct {
+	Body []repository.Bucket
+}
+
+// Series computes the count or the sum of the filtered resources by time buckets
+func (s *CRUDService[Model]) Series(ctx context.Context, i *SeriesInput[Model]) (*SeriesOutput[Model], error) {
+	slog.Debug("Executing Series operation", slog.Any("where", i.Where), slog.Any("field", i.Field), slog.String("interval", i.Interval), slog.String("timezone", i.Timezone), slog.Any("metric", i.Metric))
+
+	location, err := time.LoadLocation(i.Timezone)
+	if err != nil {
+		slog.Error("Invalid timezone in Series", slog.String("timezone", i.Timezone), slog.Any("error", err))
+		return nil, huma.Error422UnprocessableEntity("invalid timezone " + i.Timezone)
+	}
+
+	// Count the resources when no metric is requested
+	if i.Metric == "" {
+		i.Metric = "count"
+	}
+
+	// Execute BeforeGet hook if defined, so the access control of the resources applies to their series
+	if s.hooks.BeforeGet != nil {
+		if err := s.hooks.BeforeGet(ctx, i.Where.Addr(), nil, nil, nil); err != nil {
+			slog.Error("BeforeGet hook failed", slog.Any("error", err))
+			return nil, err
+		}
+	}
+
+	// Compute the buckets in the repository
+	result, err := s.repo.Series(ctx, i.Where.Addr(), string(i.Field), i.Interval, location, string(i.Metric))
+	if zone := (*repository.TimezoneError)(nil); errors.As(err, &zone) {
+		slog.Error("Unsupported timezone in Series", slog.String("timezone", i.Timezone))
+		return nil, huma.Error422UnprocessableEntity(zone.Error())
+	} else if err != nil {
+		slog.Error("Failed to compute series in Series", slog.Any("error", err))
+		return nil, err
+	}
+
+	slog.Debug("Successfully executed Series operation", slog.Any("result", result))
+	return &SeriesOutput[Model]{
+		Body: result,
+	}, nil
+}